@@ -36,6 +36,8 @@ type Client struct {
 	payloadsClient oapi.HttpRequestDoer
 	serverURL      *url.URL
 
+	messageTypeDetector MessageTypeDetector
+
 	oapiOptions []oapi.ClientOption
 }
 
@@ -65,6 +67,10 @@ func NewClient(serverURL string, opts ...ClientOption) (*Client, error) {
 		client.payloadsClient = http.DefaultClient
 	}
 
+	if client.messageTypeDetector == nil {
+		client.messageTypeDetector = DetectMessageType
+	}
+
 	return client, nil
 }
 
@@ -134,7 +140,9 @@ func (c *Client) SendMessages(
 	params *SendMessagesParams,
 	body io.Reader,
 ) error {
-	res, err := c.oapiClient.SendMessagesWithBodyWithResponse(ctx, params, "application/octet-stream", body)
+	res, err := c.oapiClient.SendMessagesWithBodyWithResponse(
+		ctx, params, "application/octet-stream", body, withContentLength(params),
+	)
 	if err != nil {
 		return fmt.Errorf("%w: %w", ErrAPICallFailed, err)
 	}
@@ -143,7 +151,19 @@ func (c *Client) SendMessages(
 		return nil
 	}
 
-	return fmt.Errorf("%w: unexpected status code %d, body: %s", ErrFailedStatusCode, res.StatusCode(), string(res.Body))
+	return fmt.Errorf("%w: %w", ErrFailedStatusCode, newAPIError(res.HTTPResponse, res.Body))
+}
+
+// withContentLength sets the content length of the request from params, as
+// net/http ignores the content-length header and would otherwise send bodies
+// of unknown length, f.e files, chunked.
+func withContentLength(params *SendMessagesParams) RequestEditorFn {
+	return func(_ context.Context, req *http.Request) error {
+		if params != nil && params.ContentLength > 0 {
+			req.ContentLength = params.ContentLength
+		}
+		return nil
+	}
 }
 
 // ListAuthorizedTenants returns all tenants for which the current application
@@ -200,20 +220,51 @@ func (c *Client) ConfirmMessages(
 		return nil
 	}
 
-	return fmt.Errorf("%w: unexpected status code %d, body: %s", ErrFailedStatusCode, res.StatusCode(), string(res.Body))
+	return fmt.Errorf("%w: %w", ErrFailedStatusCode, newAPIError(res.HTTPResponse, res.Body))
+}
+
+// APIError describes an unexpected response received from the agrirouter API.
+//
+// It is wrapped into the errors returned by [Client] methods, use [errors.As]
+// or [APIStatusCode] to inspect it.
+type APIError struct {
+	StatusCode  int    // StatusCode is the HTTP status code of the response
+	Body        []byte // Body is the body of the response, typically a JSON error message
+	ContentType string // ContentType is the content type of the response body
+}
+
+// Error implements the error interface.
+func (e *APIError) Error() string {
+	if e.ContentType == "" {
+		return fmt.Sprintf("unexpected status code %d, body: %s", e.StatusCode, e.Body)
+	}
+	return fmt.Sprintf("unexpected status code %d, body: %s, contentType: %s", e.StatusCode, e.Body, e.ContentType)
+}
+
+// APIStatusCode returns the HTTP status code of the [APIError] wrapped in err,
+// and false if err does not wrap an [APIError].
+func APIStatusCode(err error) (int, bool) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode, true
+	}
+	return 0, false
+}
+
+func newAPIError(res *http.Response, body []byte) *APIError {
+	apiErr := &APIError{Body: body}
+	if res != nil {
+		apiErr.StatusCode = res.StatusCode
+		apiErr.ContentType = res.Header.Get("Content-Type")
+	}
+	return apiErr
 }
 
 func httpResponseToErr(res *http.Response, body []byte) error {
 	if res == nil {
 		return fmt.Errorf("%w: response is nil", ErrAPICallFailed)
 	}
-	return fmt.Errorf(
-		"%w: error body: %s, status code: %d, contentType: %s",
-		ErrAPICallFailed,
-		body,
-		res.StatusCode,
-		res.Header.Get("Content-Type"),
-	)
+	return fmt.Errorf("%w: %w", ErrAPICallFailed, newAPIError(res, body))
 }
 
 func putEndpointError(err error, err2 error) error {
@@ -0,0 +1,157 @@
+package agrirouter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+var (
+	// ErrNoDecoder is returned when decoding a payload of a message type for
+	// which no decoder is registered.
+	ErrNoDecoder = errors.New("no decoder registered for message type")
+
+	// ErrDecodeFailed is returned when decoding a payload failed, or when the
+	// decoder returned a value of an unexpected type.
+	ErrDecodeFailed = errors.New("failed to decode payload")
+)
+
+// Decoder decodes a message or file payload.
+type Decoder func(ctx context.Context, payload io.Reader) (any, error)
+
+// CodecRegistry maps message types to decoders of their payloads.
+//
+// Decoders are registered by message type patterns as used by [MessageRoute],
+// the most specific matching pattern is used for decoding. Registries are
+// safe for concurrent use, so that a single registry can be shared.
+type CodecRegistry struct {
+	mu       sync.RWMutex
+	decoders []registeredDecoder
+}
+
+type registeredDecoder struct {
+	pattern string
+	decode  Decoder
+}
+
+// NewCodecRegistry creates an empty [CodecRegistry].
+func NewCodecRegistry() *CodecRegistry {
+	return &CodecRegistry{}
+}
+
+// Register registers decoder for payloads of message types matching pattern,
+// see [MessageRoute.MessageType].
+func (r *CodecRegistry) Register(pattern string, decoder Decoder) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.decoders = append(r.decoders, registeredDecoder{pattern: pattern, decode: decoder})
+}
+
+// RegisterDecoder registers decode for payloads of message types matching
+// pattern in r, f.e RegisterDecoder(r, "gps:info", DecodeJSON[Position]).
+func RegisterDecoder[T any](r *CodecRegistry, pattern string, decode func(ctx context.Context, payload io.Reader) (T, error)) {
+	r.Register(pattern, func(ctx context.Context, payload io.Reader) (any, error) {
+		return decode(ctx, payload)
+	})
+}
+
+// Decode decodes payload of a message of type messageType.
+//
+// It fails with [ErrNoDecoder] if no decoder is registered for messageType
+// and with [ErrDecodeFailed] if decoding failed.
+func (r *CodecRegistry) Decode(ctx context.Context, messageType string, payload io.Reader) (any, error) {
+	decode := r.decoder(messageType)
+	if decode == nil {
+		return nil, fmt.Errorf("%w: %q", ErrNoDecoder, messageType)
+	}
+	value, err := decode(ctx, payload)
+	if err != nil {
+		return nil, fmt.Errorf("%w: message type %q: %w", ErrDecodeFailed, messageType, err)
+	}
+	return value, nil
+}
+
+func (r *CodecRegistry) decoder(messageType string) Decoder {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var best Decoder
+	bestScore := -1
+	for _, d := range r.decoders {
+		if score, ok := messageTypeScore(d.pattern, messageType); ok && score > bestScore {
+			best, bestScore = d.decode, score
+		}
+	}
+	return best
+}
+
+// DecodeJSON decodes a JSON payload into a value of type T. It can be
+// registered as decoder with [RegisterDecoder].
+func DecodeJSON[T any](_ context.Context, payload io.Reader) (T, error) {
+	var value T
+	err := json.NewDecoder(payload).Decode(&value)
+	return value, err
+}
+
+// WithCodecs sets the codec registry used by handlers registered with
+// [HandleTyped] and [HandleTypedFile]. Defaults to an empty registry, see
+// [MessageMux.Codecs].
+func WithCodecs(registry *CodecRegistry) MessageMuxOption {
+	return func(m *MessageMux) {
+		m.codecs = registry
+	}
+}
+
+// Codecs returns the codec registry of the mux.
+func (m *MessageMux) Codecs() *CodecRegistry {
+	return m.codecs
+}
+
+// HandleTyped registers handler for messages matching the message type
+// pattern, see [MessageRoute.MessageType], passing it the payload decoded by
+// the codec registry of mux.
+//
+// Messages whose payload cannot be decoded into a T are not passed to handler,
+// the decode error is returned instead, see [MessageMux.ProcessMessage].
+func HandleTyped[T any](mux *MessageMux, pattern string, handler func(ctx context.Context, message *Message, value T) error) {
+	mux.HandleType(pattern, func(ctx context.Context, message *Message) error {
+		value, err := decodeTyped[T](ctx, mux.codecs, message.MessageType, bytes.NewReader(message.Payload))
+		if err != nil {
+			return err
+		}
+		return handler(ctx, message, value)
+	})
+}
+
+// HandleTypedFile registers handler for files matching the message type
+// pattern, see [MessageRoute.MessageType], passing it the payload decoded by
+// the codec registry of mux.
+//
+// The payload of the file is consumed by decoding. Files whose payload cannot
+// be decoded into a T are not passed to handler, the decode error is returned
+// instead, see [MessageMux.ProcessFile].
+func HandleTypedFile[T any](mux *MessageMux, pattern string, handler func(ctx context.Context, file *File, value T) error) {
+	mux.HandleFileType(pattern, func(ctx context.Context, file *File) error {
+		value, err := decodeTyped[T](ctx, mux.codecs, file.MessageType, file.Payload)
+		if err != nil {
+			return err
+		}
+		return handler(ctx, file, value)
+	})
+}
+
+func decodeTyped[T any](ctx context.Context, codecs *CodecRegistry, messageType string, payload io.Reader) (T, error) {
+	var zero T
+	decoded, err := codecs.Decode(ctx, messageType, payload)
+	if err != nil {
+		return zero, err
+	}
+	value, ok := decoded.(T)
+	if !ok {
+		return zero, fmt.Errorf("%w: message type %q: decoded %T instead of %T", ErrDecodeFailed, messageType, decoded, zero)
+	}
+	return value, nil
+}
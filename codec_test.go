@@ -0,0 +1,89 @@
+package agrirouter_test
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/DKE-Data/agrirouter-sdk-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type position struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+func TestHandleTyped_DecodesPayload(t *testing.T) {
+	mux := agrirouter.NewMessageMux()
+	agrirouter.RegisterDecoder(mux.Codecs(), "gps:*", agrirouter.DecodeJSON[position])
+	var got []position
+	agrirouter.HandleTyped(mux, "gps:info", func(_ context.Context, _ *agrirouter.Message, p position) error {
+		got = append(got, p)
+		return nil
+	})
+
+	err := mux.ProcessMessage(context.Background(), &agrirouter.Message{
+		MessageType: "gps:info",
+		Payload:     []byte(`{"lat":52.5,"lon":13.4}`),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []position{{Lat: 52.5, Lon: 13.4}}, got)
+}
+
+func TestHandleTypedFile_UsesMostSpecificDecoder(t *testing.T) {
+	codecs := agrirouter.NewCodecRegistry()
+	agrirouter.RegisterDecoder(codecs, "*", func(context.Context, io.Reader) (string, error) {
+		return "generic", nil
+	})
+	agrirouter.RegisterDecoder(codecs, "iso:11783:-10:taskdata:zip", func(_ context.Context, payload io.Reader) (string, error) {
+		data, err := io.ReadAll(payload)
+		return "taskdata " + string(data), err
+	})
+	mux := agrirouter.NewMessageMux(agrirouter.WithCodecs(codecs))
+	var got string
+	agrirouter.HandleTypedFile(mux, "iso:*", func(_ context.Context, _ *agrirouter.File, value string) error {
+		got = value
+		return nil
+	})
+
+	err := mux.ProcessFile(context.Background(), &agrirouter.File{
+		MessageType: "iso:11783:-10:taskdata:zip",
+		Payload:     strings.NewReader("zip"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "taskdata zip", got)
+}
+
+func TestHandleTyped_ReportsDecodeFailures(t *testing.T) {
+	mux := agrirouter.NewMessageMux()
+	agrirouter.RegisterDecoder(mux.Codecs(), "gps:info", agrirouter.DecodeJSON[position])
+	agrirouter.RegisterDecoder(mux.Codecs(), "img:png", agrirouter.DecodeJSON[string])
+	called := false
+	handler := func(context.Context, *agrirouter.Message, position) error {
+		called = true
+		return nil
+	}
+	agrirouter.HandleTyped(mux, "gps:info", handler)
+	agrirouter.HandleTyped(mux, "img:png", handler)
+	agrirouter.HandleTyped(mux, "doc:pdf", handler)
+
+	var reported []error
+	handle := mux.MessageHandler(func(err error) { reported = append(reported, err) })
+	ctx := context.Background()
+	broken := &agrirouter.Message{MessageType: "gps:info", Payload: []byte("{")}
+	handle(ctx, broken)
+	handle(ctx, &agrirouter.Message{MessageType: "img:png", Payload: []byte(`"png"`)})
+	handle(ctx, &agrirouter.Message{MessageType: "doc:pdf"})
+
+	assert.False(t, called)
+	require.Len(t, reported, 3)
+	var processingError *agrirouter.MessageProcessingError
+	require.ErrorAs(t, reported[0], &processingError)
+	assert.Same(t, broken, processingError.Message)
+	assert.ErrorIs(t, reported[0], agrirouter.ErrDecodeFailed)
+	assert.ErrorIs(t, reported[1], agrirouter.ErrDecodeFailed, "decoded value has the wrong type")
+	assert.ErrorIs(t, reported[2], agrirouter.ErrNoDecoder)
+}
@@ -0,0 +1,111 @@
+package agrirouter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrMissingTenantID is returned when a received message or file carries
+	// no tenant ID, so that it cannot be confirmed.
+	ErrMissingTenantID = errors.New("tenant ID is missing")
+
+	// ErrInvalidTenantID is returned when the tenant ID of a received message
+	// or file is not a valid UUID.
+	ErrInvalidTenantID = errors.New("tenant ID is invalid")
+)
+
+// TenantConfirmations are confirmations of messages received by endpoints of
+// a single tenant, as required by [Client.ConfirmMessages].
+type TenantConfirmations struct {
+	TenantID      uuid.UUID             // TenantID is the tenant the confirmed messages were received in
+	Confirmations []MessageConfirmation // Confirmations are the confirmations of the received messages
+}
+
+// Params returns the parameters to pass to [Client.ConfirmMessages].
+func (t *TenantConfirmations) Params() *ConfirmMessagesParams {
+	return &ConfirmMessagesParams{XAgrirouterTenantId: t.TenantID}
+}
+
+// Request returns the request to pass to [Client.ConfirmMessages].
+func (t *TenantConfirmations) Request() ConfirmMessagesRequest {
+	return ConfirmMessagesRequest{Confirmations: t.Confirmations}
+}
+
+// Confirmation returns the confirmation of the message in its tenant.
+//
+// It fails with [ErrMissingTenantID] or [ErrInvalidTenantID] if the tenant
+// ID of the message is missing or malformed.
+func (m *Message) Confirmation() (*TenantConfirmations, error) {
+	tenantID, err := parseTenantID(m.TenantID)
+	if err != nil {
+		return nil, fmt.Errorf("message %s: %w", m.ID, err)
+	}
+	return &TenantConfirmations{
+		TenantID: tenantID,
+		Confirmations: []MessageConfirmation{
+			{MessageId: m.ID, EndpointId: m.ReceivingEndpointID},
+		},
+	}, nil
+}
+
+// Confirmations returns the confirmations of all messages that carried the
+// payload of the file, in its tenant.
+//
+// It fails with [ErrMissingTenantID] or [ErrInvalidTenantID] if the tenant
+// ID of the file is missing or malformed.
+func (f *File) Confirmations() (*TenantConfirmations, error) {
+	tenantID, err := parseTenantID(f.TenantID)
+	if err != nil {
+		return nil, fmt.Errorf("file with message IDs %v: %w", f.MessageIDs, err)
+	}
+	confirmations := make([]MessageConfirmation, len(f.MessageIDs))
+	for i, id := range f.MessageIDs {
+		confirmations[i] = MessageConfirmation{MessageId: id, EndpointId: f.ReceivingEndpointID}
+	}
+	return &TenantConfirmations{TenantID: tenantID, Confirmations: confirmations}, nil
+}
+
+// ConfirmMessage confirms that message has been received and processed.
+//
+// See [Message.Confirmation] and [Client.ConfirmMessages] for details.
+func (c *Client) ConfirmMessage(ctx context.Context, message *Message) error {
+	confirmations, err := message.Confirmation()
+	if err != nil {
+		return err
+	}
+	return c.confirm(ctx, confirmations)
+}
+
+// ConfirmFile confirms that file has been received and processed, by
+// confirming all messages that carried its payload.
+//
+// See [File.Confirmations] and [Client.ConfirmMessages] for details.
+func (c *Client) ConfirmFile(ctx context.Context, file *File) error {
+	confirmations, err := file.Confirmations()
+	if err != nil {
+		return err
+	}
+	return c.confirm(ctx, confirmations)
+}
+
+func (c *Client) confirm(ctx context.Context, confirmations *TenantConfirmations) error {
+	if len(confirmations.Confirmations) == 0 {
+		return nil
+	}
+	return c.ConfirmMessages(ctx, confirmations.Params(), confirmations.Request())
+}
+
+func parseTenantID(tenantID *string) (uuid.UUID, error) {
+	if tenantID == nil || *tenantID == "" {
+		return uuid.Nil, ErrMissingTenantID
+	}
+	parsed, err := uuid.Parse(*tenantID)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("%w: %q: %w", ErrInvalidTenantID, *tenantID, err)
+	}
+	return parsed, nil
+}
@@ -0,0 +1,80 @@
+package agrirouter_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DKE-Data/agrirouter-sdk-go"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessage_Confirmation(t *testing.T) {
+	tenantID := uuid.New()
+	tenant := tenantID.String()
+	message := &agrirouter.Message{ID: uuid.New(), ReceivingEndpointID: uuid.New(), TenantID: &tenant}
+
+	confirmations, err := message.Confirmation()
+	require.NoError(t, err)
+	assert.Equal(t, tenantID, confirmations.Params().XAgrirouterTenantId)
+	assert.Equal(t, []agrirouter.MessageConfirmation{
+		{MessageId: message.ID, EndpointId: message.ReceivingEndpointID},
+	}, confirmations.Request().Confirmations)
+}
+
+func TestConfirmations_FailOnBadTenantID(t *testing.T) {
+	invalid := "not-a-uuid"
+	empty := ""
+	cases := []struct {
+		tenantID *string
+		want     error
+	}{
+		{nil, agrirouter.ErrMissingTenantID},
+		{&empty, agrirouter.ErrMissingTenantID},
+		{&invalid, agrirouter.ErrInvalidTenantID},
+	}
+	for _, tc := range cases {
+		_, err := (&agrirouter.Message{TenantID: tc.tenantID}).Confirmation()
+		assert.ErrorIs(t, err, tc.want)
+		_, err = (&agrirouter.File{TenantID: tc.tenantID}).Confirmations()
+		assert.ErrorIs(t, err, tc.want)
+	}
+}
+
+func TestClient_ConfirmFile(t *testing.T) {
+	api := newFakeAPI(t)
+	acceptConfirmations(api)
+	tenantID := uuid.New()
+	tenant := tenantID.String()
+	file := &agrirouter.File{
+		ReceivingEndpointID: uuid.New(),
+		MessageIDs:          []uuid.UUID{uuid.New(), uuid.New()},
+		TenantID:            &tenant,
+	}
+
+	require.NoError(t, api.client().ConfirmFile(context.Background(), file))
+
+	requests := confirmationRequests(api)
+	require.Len(t, requests, 1)
+	assert.Equal(t, tenant, requests[0].Header.Get("X-Agrirouter-Tenant-Id"))
+	assert.Equal(t, []agrirouter.MessageConfirmation{
+		{MessageId: file.MessageIDs[0], EndpointId: file.ReceivingEndpointID},
+		{MessageId: file.MessageIDs[1], EndpointId: file.ReceivingEndpointID},
+	}, decodeConfirmations(t, requests[0]))
+}
+
+func TestClient_ConfirmMessage(t *testing.T) {
+	api := newFakeAPI(t)
+	acceptConfirmations(api)
+	client := api.client()
+
+	err := client.ConfirmMessage(context.Background(), &agrirouter.Message{ID: uuid.New()})
+	require.ErrorIs(t, err, agrirouter.ErrMissingTenantID)
+	assert.Empty(t, api.recorded())
+
+	tenant := uuid.NewString()
+	message := &agrirouter.Message{ID: uuid.New(), ReceivingEndpointID: uuid.New(), TenantID: &tenant}
+	require.NoError(t, client.ConfirmMessage(context.Background(), message))
+	require.Len(t, confirmationRequests(api), 1)
+}
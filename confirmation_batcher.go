@@ -0,0 +1,288 @@
+package agrirouter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrConfirmationBatcherClosed is returned by [ConfirmationBatcher.Add] once
+// the batcher was closed.
+var ErrConfirmationBatcherClosed = errors.New("confirmation batcher is closed")
+
+// ConfirmationBatcher collects message confirmations of many tenants and
+// confirms them in batches, one request per tenant and batch.
+//
+// A tenant's batch is flushed once it reaches the batch size, or once its
+// oldest confirmation waited for the flush interval. Failed flushes are
+// retried with exponential backoff. Confirmations that could not be flushed
+// after all attempts, or that were rejected permanently, are reported to the
+// failure handler, see [WithConfirmationFailureHandler].
+//
+// [ConfirmationBatcher.Close] must be called on shutdown, so that pending
+// confirmations are flushed.
+type ConfirmationBatcher struct {
+	client *Client
+	cfg    confirmationBatcherConfig
+
+	mu      sync.Mutex
+	pending map[uuid.UUID]*confirmationBatch
+	closed  bool
+
+	wake   chan struct{}
+	stop   chan struct{}
+	done   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+type confirmationBatch struct {
+	confirmations []MessageConfirmation
+	since         time.Time
+}
+
+type confirmationBatcherConfig struct {
+	batchSize     int
+	flushInterval time.Duration
+	maxAttempts   int
+	minBackoff    time.Duration
+	maxBackoff    time.Duration
+	onFailure     func(tenantID uuid.UUID, confirmations []MessageConfirmation, err error)
+}
+
+// ConfirmationBatcherOption configures a [ConfirmationBatcher].
+type ConfirmationBatcherOption func(*confirmationBatcherConfig)
+
+// WithConfirmationBatchSize sets how many confirmations are sent in one
+// request at most. Defaults to 100.
+func WithConfirmationBatchSize(size int) ConfirmationBatcherOption {
+	return func(cfg *confirmationBatcherConfig) {
+		cfg.batchSize = size
+	}
+}
+
+// WithConfirmationFlushInterval sets how long a confirmation waits at most
+// for its batch to fill up. Defaults to 1 second.
+func WithConfirmationFlushInterval(interval time.Duration) ConfirmationBatcherOption {
+	return func(cfg *confirmationBatcherConfig) {
+		cfg.flushInterval = interval
+	}
+}
+
+// WithConfirmationRetries sets how often flushing a batch is attempted at
+// most, and the bounds of the exponential backoff between attempts. Defaults
+// to 5 attempts with a backoff between 500 milliseconds and 30 seconds.
+func WithConfirmationRetries(maxAttempts int, minBackoff, maxBackoff time.Duration) ConfirmationBatcherOption {
+	return func(cfg *confirmationBatcherConfig) {
+		cfg.maxAttempts = maxAttempts
+		cfg.minBackoff = minBackoff
+		cfg.maxBackoff = maxBackoff
+	}
+}
+
+// WithConfirmationFailureHandler sets a callback invoked with confirmations
+// that failed permanently, together with the error of the last attempt.
+func WithConfirmationFailureHandler(
+	handler func(tenantID uuid.UUID, confirmations []MessageConfirmation, err error),
+) ConfirmationBatcherOption {
+	return func(cfg *confirmationBatcherConfig) {
+		cfg.onFailure = handler
+	}
+}
+
+// NewConfirmationBatcher creates a [ConfirmationBatcher] confirming messages
+// with client and starts flushing in the background.
+func NewConfirmationBatcher(client *Client, opts ...ConfirmationBatcherOption) *ConfirmationBatcher {
+	cfg := confirmationBatcherConfig{
+		batchSize:     100,
+		flushInterval: time.Second,
+		maxAttempts:   5,
+		minBackoff:    500 * time.Millisecond,
+		maxBackoff:    30 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	cfg.batchSize = max(cfg.batchSize, 1)
+	cfg.maxAttempts = max(cfg.maxAttempts, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &ConfirmationBatcher{
+		client:  client,
+		cfg:     cfg,
+		pending: map[uuid.UUID]*confirmationBatch{},
+		wake:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+	go b.run()
+	return b
+}
+
+// Add queues confirmations of messages received by endpoints of the tenant
+// identified by tenantID.
+func (b *ConfirmationBatcher) Add(tenantID uuid.UUID, confirmations ...MessageConfirmation) error {
+	if len(confirmations) == 0 {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return ErrConfirmationBatcherClosed
+	}
+	batch, ok := b.pending[tenantID]
+	if !ok {
+		batch = &confirmationBatch{since: time.Now()}
+		b.pending[tenantID] = batch
+	}
+	batch.confirmations = append(batch.confirmations, confirmations...)
+	if len(batch.confirmations) >= b.cfg.batchSize {
+		select {
+		case b.wake <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Pending returns the number of confirmations not flushed yet.
+func (b *ConfirmationBatcher) Pending() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var n int
+	for _, batch := range b.pending {
+		n += len(batch.confirmations)
+	}
+	return n
+}
+
+// Close stops accepting confirmations and flushes all pending ones.
+//
+// If ctx is canceled before flushing completes, flushing is aborted, the
+// remaining confirmations are reported to the failure handler and the error
+// of ctx is returned. Further calls wait for the first one to complete, or
+// return the error of their ctx without aborting the flush if it is canceled
+// first.
+func (b *ConfirmationBatcher) Close(ctx context.Context) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		select {
+		case <-b.done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	b.closed = true
+	b.mu.Unlock()
+	close(b.stop)
+
+	select {
+	case <-b.done:
+		return nil
+	case <-ctx.Done():
+		b.cancel()
+		<-b.done
+		return ctx.Err()
+	}
+}
+
+func (b *ConfirmationBatcher) run() {
+	defer close(b.done)
+	defer b.cancel()
+	for {
+		timer := time.NewTimer(b.nextFlushDelay())
+		select {
+		case <-b.stop:
+			timer.Stop()
+			b.flush(true)
+			return
+		case <-b.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+		b.flush(false)
+	}
+}
+
+// nextFlushDelay returns the time until the oldest batch is due.
+func (b *ConfirmationBatcher) nextFlushDelay() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delay := b.cfg.flushInterval
+	now := time.Now()
+	for _, batch := range b.pending {
+		delay = min(delay, max(batch.since.Add(b.cfg.flushInterval).Sub(now), 0))
+	}
+	return delay
+}
+
+// flush sends all batches that are full or due, or all batches if all is set.
+func (b *ConfirmationBatcher) flush(all bool) {
+	for tenantID, confirmations := range b.takeBatches(all) {
+		for start := 0; start < len(confirmations); start += b.cfg.batchSize {
+			chunk := confirmations[start:min(start+b.cfg.batchSize, len(confirmations))]
+			if err := b.send(tenantID, chunk); err != nil && b.cfg.onFailure != nil {
+				b.cfg.onFailure(tenantID, chunk, err)
+			}
+		}
+	}
+}
+
+func (b *ConfirmationBatcher) takeBatches(all bool) map[uuid.UUID][]MessageConfirmation {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	taken := map[uuid.UUID][]MessageConfirmation{}
+	now := time.Now()
+	for tenantID, batch := range b.pending {
+		due := now.Sub(batch.since) >= b.cfg.flushInterval
+		if all || due || len(batch.confirmations) >= b.cfg.batchSize {
+			taken[tenantID] = batch.confirmations
+			delete(b.pending, tenantID)
+		}
+	}
+	return taken
+}
+
+// send confirms a chunk of a tenant, retrying transient failures.
+func (b *ConfirmationBatcher) send(tenantID uuid.UUID, confirmations []MessageConfirmation) error {
+	for attempt := 1; ; attempt++ {
+		err := b.client.ConfirmMessages(b.ctx, &ConfirmMessagesParams{
+			XAgrirouterTenantId: tenantID,
+		}, ConfirmMessagesRequest{Confirmations: confirmations})
+		if err == nil {
+			return nil
+		}
+		if attempt >= b.cfg.maxAttempts || isPermanentConfirmError(err) {
+			return err
+		}
+		if !sleep(b.ctx, exponentialBackoff(attempt, b.cfg.minBackoff, b.cfg.maxBackoff)) {
+			return fmt.Errorf("%w: %w", err, b.ctx.Err())
+		}
+	}
+}
+
+// isPermanentConfirmError reports whether confirming again cannot succeed,
+// as agrirouter rejected the request as invalid.
+func isPermanentConfirmError(err error) bool {
+	status, ok := APIStatusCode(err)
+	return ok && status >= http.StatusBadRequest && status < http.StatusInternalServerError &&
+		status != http.StatusUnauthorized && status != http.StatusRequestTimeout && status != http.StatusTooManyRequests
+}
+
+// WithConfirmationBatcher makes [WithAutoConfirm] add confirmations to batcher
+// instead of confirming every message and file with its own request.
+// Failures are then reported to the failure handler of the batcher.
+func WithConfirmationBatcher(batcher *ConfirmationBatcher) ReceiveOption {
+	return func(cfg *receiveConfig) {
+		cfg.confirmationBatcher = batcher
+	}
+}
@@ -0,0 +1,165 @@
+package agrirouter_test
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DKE-Data/agrirouter-sdk-go"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newConfirmation() agrirouter.MessageConfirmation {
+	return agrirouter.MessageConfirmation{MessageId: uuid.New(), EndpointId: uuid.New()}
+}
+
+func TestConfirmationBatcher_GroupsByTenant(t *testing.T) {
+	api := newFakeAPI(t)
+	acceptConfirmations(api)
+	batcher := agrirouter.NewConfirmationBatcher(api.client(),
+		agrirouter.WithConfirmationBatchSize(2),
+		agrirouter.WithConfirmationFlushInterval(time.Hour),
+	)
+	tenantA, tenantB := uuid.New(), uuid.New()
+	a1, a2, b1 := newConfirmation(), newConfirmation(), newConfirmation()
+
+	require.NoError(t, batcher.Add(tenantA, a1))
+	require.NoError(t, batcher.Add(tenantB, b1))
+	require.NoError(t, batcher.Add(tenantA, a2))
+
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		assert.Len(c, confirmationRequests(api), 1, "the full batch of tenant A is flushed")
+	}, 5*time.Second, 10*time.Millisecond)
+	first := confirmationRequests(api)[0]
+	assert.Equal(t, tenantA.String(), first.Header.Get("X-Agrirouter-Tenant-Id"))
+	assert.Equal(t, []agrirouter.MessageConfirmation{a1, a2}, decodeConfirmations(t, first))
+	assert.Equal(t, 1, batcher.Pending())
+
+	require.NoError(t, batcher.Close(context.Background()))
+	requests := confirmationRequests(api)
+	require.Len(t, requests, 2, "closing flushes the remaining batch of tenant B")
+	assert.Equal(t, tenantB.String(), requests[1].Header.Get("X-Agrirouter-Tenant-Id"))
+	assert.Equal(t, []agrirouter.MessageConfirmation{b1}, decodeConfirmations(t, requests[1]))
+	assert.ErrorIs(t, batcher.Add(tenantA, newConfirmation()), agrirouter.ErrConfirmationBatcherClosed)
+}
+
+func TestConfirmationBatcher_FlushesAfterInterval(t *testing.T) {
+	api := newFakeAPI(t)
+	acceptConfirmations(api)
+	batcher := agrirouter.NewConfirmationBatcher(api.client(), agrirouter.WithConfirmationFlushInterval(20*time.Millisecond))
+	defer batcher.Close(context.Background())
+
+	require.NoError(t, batcher.Add(uuid.New(), newConfirmation()))
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		assert.Len(c, confirmationRequests(api), 1)
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Zero(t, batcher.Pending())
+}
+
+func TestConfirmationBatcher_RetriesTransientFailures(t *testing.T) {
+	api := newFakeAPI(t)
+	var calls atomic.Int32
+	api.handle(http.MethodPost, "/confirmations", func(w http.ResponseWriter, _ *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+	var failures atomic.Int32
+	batcher := agrirouter.NewConfirmationBatcher(api.client(),
+		agrirouter.WithConfirmationRetries(3, time.Millisecond, time.Millisecond),
+		agrirouter.WithConfirmationFailureHandler(func(uuid.UUID, []agrirouter.MessageConfirmation, error) {
+			failures.Add(1)
+		}),
+	)
+
+	require.NoError(t, batcher.Add(uuid.New(), newConfirmation()))
+	require.NoError(t, batcher.Close(context.Background()))
+	assert.Len(t, confirmationRequests(api), 2)
+	assert.Zero(t, failures.Load())
+}
+
+func TestConfirmationBatcher_ReportsPermanentFailures(t *testing.T) {
+	api := newFakeAPI(t)
+	api.setDefaultStatus(http.StatusBadRequest)
+	var mu sync.Mutex
+	var failed []agrirouter.MessageConfirmation
+	var failedTenant uuid.UUID
+	batcher := agrirouter.NewConfirmationBatcher(api.client(),
+		agrirouter.WithConfirmationRetries(3, time.Millisecond, time.Millisecond),
+		agrirouter.WithConfirmationFailureHandler(func(tenantID uuid.UUID, confirmations []agrirouter.MessageConfirmation, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			failedTenant = tenantID
+			failed = append(failed, confirmations...)
+			status, _ := agrirouter.APIStatusCode(err)
+			assert.Equal(t, http.StatusBadRequest, status)
+		}),
+	)
+	tenantID, confirmation := uuid.New(), newConfirmation()
+
+	require.NoError(t, batcher.Add(tenantID, confirmation))
+	require.NoError(t, batcher.Close(context.Background()))
+	assert.Len(t, confirmationRequests(api), 1, "permanent failures are not retried")
+	assert.Equal(t, tenantID, failedTenant)
+	assert.Equal(t, []agrirouter.MessageConfirmation{confirmation}, failed)
+}
+
+func TestReceiveEvents_AutoConfirmsWithBatcher(t *testing.T) {
+	api := newFakeAPI(t)
+	acceptConfirmations(api)
+	tenantID, endpointID := uuid.New(), uuid.New()
+	first, second := uuid.New(), uuid.New()
+	api.serveEvents(
+		messageEvent(tenantID, endpointID, first, "1"),
+		messageEvent(tenantID, endpointID, second, "2"),
+	)
+	client := api.client()
+	batcher := agrirouter.NewConfirmationBatcher(client,
+		agrirouter.WithConfirmationBatchSize(2),
+		agrirouter.WithConfirmationFlushInterval(time.Hour),
+	)
+	defer batcher.Close(context.Background())
+
+	startReceiving(t, func(ctx context.Context, errorHandler func(err error)) error {
+		return client.ReceiveEvents(ctx, nil, agrirouter.EventHandlers{
+			ProcessMessage: func(context.Context, *agrirouter.Message) error { return nil },
+		}, errorHandler, agrirouter.WithAutoConfirm(), agrirouter.WithConfirmationBatcher(batcher))
+	})
+
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		assert.Len(c, confirmationRequests(api), 1)
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []agrirouter.MessageConfirmation{
+		{MessageId: first, EndpointId: endpointID},
+		{MessageId: second, EndpointId: endpointID},
+	}, decodeConfirmations(t, confirmationRequests(api)[0]))
+}
+
+func TestConfirmationBatcher_ConcurrentCloseHonorsItsContext(t *testing.T) {
+	api := newFakeAPI(t)
+	api.setDefaultStatus(http.StatusBadGateway)
+	batcher := agrirouter.NewConfirmationBatcher(api.client(),
+		agrirouter.WithConfirmationRetries(2, 300*time.Millisecond, 300*time.Millisecond),
+	)
+	require.NoError(t, batcher.Add(uuid.New(), newConfirmation()))
+
+	firstClosed := make(chan error, 1)
+	go func() { firstClosed <- batcher.Close(context.Background()) }()
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		assert.Len(c, confirmationRequests(api), 1)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, batcher.Close(ctx), context.DeadlineExceeded, "the second Close does not wait for the retries")
+
+	require.NoError(t, <-firstClosed)
+	assert.Len(t, confirmationRequests(api), 2, "the flush of the first Close is not aborted")
+}
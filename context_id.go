@@ -0,0 +1,115 @@
+package agrirouter
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/google/uuid"
+)
+
+// derivedContextIDBytes is the number of hash bytes encoded into a derived
+// context ID. Hex encoded, this results in 40 characters, well within
+// [ContextIDMaxLength] while keeping the collision probability negligible.
+const derivedContextIDBytes = 20
+
+// ContextIDSource lists the values a deterministic context ID is derived from,
+// see [DeriveContextID].
+type ContextIDSource struct {
+	// EndpointID is the agrirouter ID of the sending endpoint.
+	EndpointID uuid.UUID
+	// MessageType is the URN type of the sent message.
+	MessageType string
+	// PayloadHash is the hash of the payload, f.e as returned by [HashPayload].
+	PayloadHash []byte
+	// BusinessKey optionally distinguishes payloads that are identical, but
+	// must nevertheless be delivered as separate messages, f.e the ID of an
+	// order in the sending application. It may be left empty.
+	BusinessKey string
+}
+
+// DeriveContextID returns a context ID that is stable for the given source
+// values and at most [ContextIDMaxLength] characters long.
+//
+// agrirouter allows to reuse the context ID when resending the same payload,
+// f.e when retrying after a crash, so that no duplicate messages are created
+// downstream. Deriving the context ID instead of generating a random one
+// allows such retries without having to persist the ID before sending.
+func DeriveContextID(source ContextIDSource) string {
+	h := sha256.New()
+	_, _ = h.Write(source.EndpointID[:])
+	writeLengthPrefixed(h, []byte(source.MessageType))
+	writeLengthPrefixed(h, source.PayloadHash)
+	writeLengthPrefixed(h, []byte(source.BusinessKey))
+	return hex.EncodeToString(h.Sum(nil)[:derivedContextIDBytes])
+}
+
+// writeLengthPrefixed writes b prefixed with its length, so that the
+// boundaries between subsequent values are unambiguous.
+func writeLengthPrefixed(h hash.Hash, b []byte) {
+	var length [8]byte
+	binary.BigEndian.PutUint64(length[:], uint64(len(b)))
+	_, _ = h.Write(length[:])
+	_, _ = h.Write(b)
+}
+
+// PayloadHasher is an [io.Reader] that computes the hash of the payload
+// read through it, so that bodies can be hashed while being streamed.
+type PayloadHasher struct {
+	reader io.Reader
+	hash   hash.Hash
+	size   int64
+}
+
+// NewPayloadHasher returns a [PayloadHasher] reading from r.
+func NewPayloadHasher(r io.Reader) *PayloadHasher {
+	return &PayloadHasher{reader: r, hash: sha256.New()}
+}
+
+// Read reads from the underlying reader, adding the read bytes to the hash.
+func (p *PayloadHasher) Read(b []byte) (int, error) {
+	n, err := p.reader.Read(b)
+	_, _ = p.hash.Write(b[:n])
+	p.size += int64(n)
+	return n, err
+}
+
+// Sum returns the hash of all bytes read so far.
+func (p *PayloadHasher) Sum() []byte {
+	return p.hash.Sum(nil)
+}
+
+// Size returns the number of bytes read so far.
+func (p *PayloadHasher) Size() int64 {
+	return p.size
+}
+
+// HashPayload reads r until EOF and returns the hash of its content.
+func HashPayload(r io.Reader) ([]byte, error) {
+	hasher := NewPayloadHasher(r)
+	if _, err := io.Copy(io.Discard, hasher); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFailedToReadPayload, err)
+	}
+	return hasher.Sum(), nil
+}
+
+// DeriveContextIDForPayload hashes the remaining content of body, rewinds it
+// to where it was and returns the context ID derived from the hash and source,
+// ignoring source.PayloadHash. See [DeriveContextID].
+func DeriveContextIDForPayload(body io.ReadSeeker, source ContextIDSource) (string, error) {
+	offset, err := body.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrFailedToReadPayload, err)
+	}
+	source.PayloadHash, err = HashPayload(body)
+	if err != nil {
+		return "", err
+	}
+	if _, err := body.Seek(offset, io.SeekStart); err != nil {
+		return "", fmt.Errorf("%w: %w", ErrFailedToReadPayload, err)
+	}
+	return DeriveContextID(source), nil
+}
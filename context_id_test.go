@@ -0,0 +1,77 @@
+package agrirouter_test
+
+import (
+	"crypto/sha256"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/DKE-Data/agrirouter-sdk-go"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeriveContextID(t *testing.T) {
+	hash := sha256.Sum256([]byte("payload"))
+	source := agrirouter.ContextIDSource{
+		EndpointID:  uuid.New(),
+		MessageType: agrirouter.MessageTypeTaskDataZip,
+		PayloadHash: hash[:],
+	}
+
+	id := agrirouter.DeriveContextID(source)
+	assert.LessOrEqual(t, len(id), agrirouter.ContextIDMaxLength)
+	assert.Equal(t, id, agrirouter.DeriveContextID(source), "derivation must be deterministic")
+
+	withKey := source
+	withKey.BusinessKey = "order-42"
+	otherEndpoint := source
+	otherEndpoint.EndpointID = uuid.New()
+	otherType := source
+	otherType.MessageType = agrirouter.MessageTypeShapeZip
+
+	for _, other := range []agrirouter.ContextIDSource{withKey, otherEndpoint, otherType} {
+		assert.NotEqual(t, id, agrirouter.DeriveContextID(other))
+	}
+}
+
+func TestDeriveContextID_FieldBoundariesAreUnambiguous(t *testing.T) {
+	endpointID := uuid.New()
+	a := agrirouter.DeriveContextID(agrirouter.ContextIDSource{EndpointID: endpointID, MessageType: "ab", BusinessKey: "c"})
+	b := agrirouter.DeriveContextID(agrirouter.ContextIDSource{EndpointID: endpointID, MessageType: "a", BusinessKey: "bc"})
+	assert.NotEqual(t, a, b)
+}
+
+func TestPayloadHasher(t *testing.T) {
+	hasher := agrirouter.NewPayloadHasher(strings.NewReader("payload"))
+	read, err := io.ReadAll(hasher)
+	require.NoError(t, err)
+
+	want := sha256.Sum256([]byte("payload"))
+	assert.Equal(t, "payload", string(read))
+	assert.Equal(t, want[:], hasher.Sum())
+	assert.Equal(t, int64(7), hasher.Size())
+
+	hashed, err := agrirouter.HashPayload(strings.NewReader("payload"))
+	require.NoError(t, err)
+	assert.Equal(t, want[:], hashed)
+}
+
+func TestDeriveContextIDForPayload_RewindsBody(t *testing.T) {
+	body := strings.NewReader("header|payload")
+	_, err := body.Seek(7, io.SeekStart)
+	require.NoError(t, err)
+	source := agrirouter.ContextIDSource{EndpointID: uuid.New(), MessageType: "gps:info"}
+
+	id, err := agrirouter.DeriveContextIDForPayload(body, source)
+	require.NoError(t, err)
+
+	rest, err := io.ReadAll(body)
+	require.NoError(t, err)
+	assert.Equal(t, "payload", string(rest))
+
+	hash := sha256.Sum256([]byte("payload"))
+	source.PayloadHash = hash[:]
+	assert.Equal(t, agrirouter.DeriveContextID(source), id)
+}
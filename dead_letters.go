@@ -0,0 +1,429 @@
+package agrirouter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrDeadLetterNotFound is returned when a dead letter does not exist.
+	ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+	// ErrDeadLetterStoreFailed is returned when persisting or reading dead
+	// letters failed.
+	ErrDeadLetterStoreFailed = errors.New("dead letter store failed")
+
+	// ErrReplayFailed is returned by [Client.ReplayDeadLetter] when processing
+	// the dead letter failed again.
+	ErrReplayFailed = errors.New("replaying dead letter failed")
+)
+
+// DeadLetterKind tells whether a [DeadLetter] is a message or a file.
+type DeadLetterKind string
+
+const (
+	DeadLetterMessage DeadLetterKind = "message" // DeadLetterMessage is a dead-lettered [Message]
+	DeadLetterFile    DeadLetterKind = "file"    // DeadLetterFile is a dead-lettered [File]
+)
+
+// DeadLetter is a received message or file that failed to be processed,
+// persisted together with its payload, see [WithDeadLetters].
+type DeadLetter struct {
+	// ID identifies the dead letter in its store. Deliveries of the same
+	// message to the same endpoint share the ID.
+	ID string `json:"id"`
+	// Kind tells whether a message or a file failed.
+	Kind DeadLetterKind `json:"kind"`
+	// MessageIDs are the agrirouter IDs of the failed message, or of the
+	// messages that carried the payload of the failed file.
+	MessageIDs []uuid.UUID `json:"message_ids"`
+	// AppMessageID is the ID assigned by the sending endpoint, only set for
+	// messages.
+	AppMessageID string `json:"app_message_id,omitempty"`
+	// MessageType is the URN type of the message or file.
+	MessageType string `json:"message_type"`
+	// ReceivingEndpointID is the agrirouter ID of the receiving endpoint.
+	ReceivingEndpointID uuid.UUID `json:"receiving_endpoint_id"`
+	// Filename is the filename as sent by the sender endpoint, if any.
+	Filename *string `json:"filename,omitempty"`
+	// TenantID is the tenant to which the receiving endpoint belongs.
+	TenantID *string `json:"tenant_id,omitempty"`
+	// TeamsetContextID is the teamset context ID provided by the sending
+	// application, if any.
+	TeamsetContextID *string `json:"teamset_context_id,omitempty"`
+	// Size is the size of the payload in bytes.
+	Size int64 `json:"size"`
+	// Error describes why processing failed.
+	Error string `json:"error"`
+	// FailedAt is the time processing failed.
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// DeadLetterStore persists dead letters together with their payloads.
+//
+// Implementations must be safe for concurrent use. [FileDeadLetterStore] is
+// an implementation persisting dead letters in a local directory.
+type DeadLetterStore interface {
+	// Put persists a dead letter together with its payload, replacing any
+	// dead letter with the same ID.
+	Put(ctx context.Context, letter *DeadLetter, payload io.Reader) error
+	// List returns all dead letters, oldest failures first.
+	List(ctx context.Context) ([]*DeadLetter, error)
+	// Get returns the dead letter with the given ID, or fails with
+	// [ErrDeadLetterNotFound].
+	Get(ctx context.Context, id string) (*DeadLetter, error)
+	// OpenPayload opens the payload of the dead letter with the given ID.
+	OpenPayload(ctx context.Context, id string) (io.ReadCloser, error)
+	// Remove removes the dead letter with the given ID and its payload.
+	Remove(ctx context.Context, id string) error
+}
+
+// WithDeadLetters makes [Client.ReceiveEvents] persist messages and files
+// that failed to be processed by [EventHandlers.ProcessMessage] or
+// [EventHandlers.ProcessFile] in store, so that they can be inspected and
+// replayed with [Client.ReplayDeadLetter] later, f.e after the payload URI of
+// a file expired.
+//
+// Payloads of files are buffered in a temporary file while being processed.
+// Dead-lettered messages and files are not confirmed, redeliveries replace the
+// dead letter. Failures to persist dead letters are reported to the error
+// handler.
+func WithDeadLetters(store DeadLetterStore) ReceiveOption {
+	return func(cfg *receiveConfig) {
+		cfg.deadLetters = store
+	}
+}
+
+func deadLetterID(endpointID uuid.UUID, messageIDs []uuid.UUID) string {
+	if len(messageIDs) == 0 {
+		return endpointID.String()
+	}
+	return endpointID.String() + "_" + messageIDs[0].String()
+}
+
+// deadLetterMessage persists message as dead letter, if configured in cfg.
+func (cfg *receiveConfig) deadLetterMessage(ctx context.Context, message *Message, cause error, errorHandler func(err error)) {
+	if cfg.deadLetters == nil {
+		return
+	}
+	letter := &DeadLetter{
+		ID:                  deadLetterID(message.ReceivingEndpointID, []uuid.UUID{message.ID}),
+		Kind:                DeadLetterMessage,
+		MessageIDs:          []uuid.UUID{message.ID},
+		AppMessageID:        message.AppMessageID,
+		MessageType:         message.MessageType,
+		ReceivingEndpointID: message.ReceivingEndpointID,
+		Filename:            message.Filename,
+		TenantID:            message.TenantID,
+		TeamsetContextID:    message.TeamsetContextID,
+		Size:                int64(len(message.Payload)),
+		Error:               cause.Error(),
+		FailedAt:            time.Now(),
+	}
+	if err := cfg.deadLetters.Put(ctx, letter, bytes.NewReader(message.Payload)); err != nil {
+		errorHandler(err)
+	}
+}
+
+// deadLetterFile persists file as dead letter with the payload buffered in
+// buffer, if configured in cfg.
+func (cfg *receiveConfig) deadLetterFile(
+	ctx context.Context,
+	file *File,
+	buffer *payloadBuffer,
+	cause error,
+	errorHandler func(err error),
+) {
+	if cfg.deadLetters == nil || buffer == nil {
+		return
+	}
+	payload, size, err := buffer.rewind()
+	if err != nil {
+		errorHandler(fmt.Errorf("%w: %w", ErrDeadLetterStoreFailed, err))
+		return
+	}
+	letter := &DeadLetter{
+		ID:                  deadLetterID(file.ReceivingEndpointID, file.MessageIDs),
+		Kind:                DeadLetterFile,
+		MessageIDs:          file.MessageIDs,
+		MessageType:         file.MessageType,
+		ReceivingEndpointID: file.ReceivingEndpointID,
+		Filename:            file.Filename,
+		TenantID:            file.TenantID,
+		TeamsetContextID:    file.TeamsetContextID,
+		Size:                size,
+		Error:               cause.Error(),
+		FailedAt:            time.Now(),
+	}
+	if err := cfg.deadLetters.Put(ctx, letter, payload); err != nil {
+		errorHandler(err)
+	}
+}
+
+// payloadBuffer copies a file payload to a temporary file while it is read,
+// so that it is still available once the payload URI expired.
+type payloadBuffer struct {
+	source io.Reader
+	file   *os.File
+}
+
+// bufferPayload replaces the payload of file by a reader buffering it.
+func bufferPayload(file *File) (*payloadBuffer, error) {
+	tmp, err := os.CreateTemp("", "agrirouter-dead-letter-*")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDeadLetterStoreFailed, err)
+	}
+	buffer := &payloadBuffer{source: file.Payload, file: tmp}
+	file.Payload = io.TeeReader(file.Payload, tmp)
+	return buffer, nil
+}
+
+// rewind reads the part of the payload not read yet into the buffer and
+// returns a reader of the whole payload together with its size.
+func (b *payloadBuffer) rewind() (io.Reader, int64, error) {
+	if _, err := io.Copy(b.file, b.source); err != nil {
+		return nil, 0, err
+	}
+	size, err := b.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, 0, err
+	}
+	if _, err := b.file.Seek(0, io.SeekStart); err != nil {
+		return nil, 0, err
+	}
+	return b.file, size, nil
+}
+
+// close closes the original payload and removes the temporary file.
+func (b *payloadBuffer) close() {
+	if closer, ok := b.source.(io.Closer); ok {
+		_ = closer.Close()
+	}
+	_ = b.file.Close()
+	_ = os.Remove(b.file.Name())
+}
+
+// ReplayDeadLetter processes the dead letter with the given ID from store
+// again, by passing it to [EventHandlers.ProcessMessage] or
+// [EventHandlers.ProcessFile] of handlers, and removes it from store once
+// processed successfully.
+//
+// opts are applied as by [Client.ReceiveEvents], f.e [WithAutoConfirm] to
+// confirm the message once replayed. It fails with [ErrReplayFailed] if
+// processing failed again, the dead letter is kept in that case.
+func (c *Client) ReplayDeadLetter(
+	ctx context.Context,
+	store DeadLetterStore,
+	id string,
+	handlers EventHandlers,
+	opts ...ReceiveOption,
+) error {
+	letter, err := store.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	payload, err := store.OpenPayload(ctx, id)
+	if err != nil {
+		return err
+	}
+	cfg := newReceiveConfig(opts)
+	cfg.deadLetters = nil
+	var errs []error
+	errorHandler := func(err error) { errs = append(errs, err) }
+
+	var processed bool
+	switch letter.Kind {
+	case DeadLetterMessage:
+		if handlers.ProcessMessage == nil {
+			_ = payload.Close()
+			return fmt.Errorf("%w: no message processor", ErrReplayFailed)
+		}
+		data, err := io.ReadAll(payload)
+		_ = payload.Close()
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrDeadLetterStoreFailed, err)
+		}
+		processed = c.processMessage(ctx, letter.message(data), handlers.ProcessMessage, cfg, errorHandler)
+	case DeadLetterFile:
+		if handlers.ProcessFile == nil {
+			_ = payload.Close()
+			return fmt.Errorf("%w: no file processor", ErrReplayFailed)
+		}
+		processed = c.processFile(ctx, letter.file(payload), handlers.ProcessFile, cfg, errorHandler)
+	default:
+		_ = payload.Close()
+		return fmt.Errorf("%w: unknown kind %q", ErrReplayFailed, letter.Kind)
+	}
+	if !processed {
+		return fmt.Errorf("%w: %w", ErrReplayFailed, errors.Join(errs...))
+	}
+	if err := store.Remove(ctx, id); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func (l *DeadLetter) message(payload []byte) *Message {
+	var id uuid.UUID
+	if len(l.MessageIDs) > 0 {
+		id = l.MessageIDs[0]
+	}
+	return &Message{
+		ID:                  id,
+		MessageType:         l.MessageType,
+		Payload:             payload,
+		AppMessageID:        l.AppMessageID,
+		ReceivingEndpointID: l.ReceivingEndpointID,
+		Filename:            l.Filename,
+		TenantID:            l.TenantID,
+		TeamsetContextID:    l.TeamsetContextID,
+	}
+}
+
+func (l *DeadLetter) file(payload io.Reader) *File {
+	return &File{
+		ReceivingEndpointID: l.ReceivingEndpointID,
+		Payload:             payload,
+		Filename:            l.Filename,
+		MessageType:         l.MessageType,
+		Size:                l.Size,
+		MessageIDs:          l.MessageIDs,
+		TenantID:            l.TenantID,
+		TeamsetContextID:    l.TeamsetContextID,
+	}
+}
+
+const (
+	deadLetterSuffix        = ".json"
+	deadLetterPayloadSuffix = ".payload"
+)
+
+// FileDeadLetterStore is a [DeadLetterStore] persisting dead letters in a
+// directory.
+//
+// Every dead letter is stored as a JSON metadata file next to a file holding
+// its payload, both written atomically.
+type FileDeadLetterStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+var _ DeadLetterStore = (*FileDeadLetterStore)(nil)
+
+// NewFileDeadLetterStore creates a [FileDeadLetterStore] persisting dead
+// letters in dir, which is created if it does not exist yet.
+func NewFileDeadLetterStore(dir string) (*FileDeadLetterStore, error) {
+	if err := os.MkdirAll(dir, outboxDirPerm); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDeadLetterStoreFailed, err)
+	}
+	return &FileDeadLetterStore{dir: dir}, nil
+}
+
+// Put implements [DeadLetterStore].
+func (s *FileDeadLetterStore) Put(_ context.Context, letter *DeadLetter, payload io.Reader) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// The payload is written first, so that metadata always has a payload.
+	err := writeFileAtomically(s.path(letter.ID, deadLetterPayloadSuffix), func(w io.Writer) error {
+		_, err := io.Copy(w, payload)
+		return err
+	})
+	if err == nil {
+		err = writeFileAtomically(s.path(letter.ID, deadLetterSuffix), func(w io.Writer) error {
+			return json.NewEncoder(w).Encode(letter)
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrDeadLetterStoreFailed, err)
+	}
+	return nil
+}
+
+// List implements [DeadLetterStore].
+func (s *FileDeadLetterStore) List(_ context.Context) ([]*DeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDeadLetterStoreFailed, err)
+	}
+	var letters []*DeadLetter
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), deadLetterSuffix) {
+			continue
+		}
+		letter, err := s.read(strings.TrimSuffix(entry.Name(), deadLetterSuffix))
+		if err != nil {
+			return nil, err
+		}
+		letters = append(letters, letter)
+	}
+	sort.SliceStable(letters, func(i, j int) bool {
+		return letters[i].FailedAt.Before(letters[j].FailedAt)
+	})
+	return letters, nil
+}
+
+// Get implements [DeadLetterStore].
+func (s *FileDeadLetterStore) Get(_ context.Context, id string) (*DeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.read(id)
+}
+
+// OpenPayload implements [DeadLetterStore].
+func (s *FileDeadLetterStore) OpenPayload(_ context.Context, id string) (io.ReadCloser, error) {
+	file, err := os.Open(s.path(id, deadLetterPayloadSuffix))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrDeadLetterNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDeadLetterStoreFailed, err)
+	}
+	return file, nil
+}
+
+// Remove implements [DeadLetterStore].
+func (s *FileDeadLetterStore) Remove(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Metadata goes first, so that a crash in between leaves an ignored payload.
+	for _, suffix := range []string{deadLetterSuffix, deadLetterPayloadSuffix} {
+		if err := os.Remove(s.path(id, suffix)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("%w: %w", ErrDeadLetterStoreFailed, err)
+		}
+	}
+	return nil
+}
+
+func (s *FileDeadLetterStore) path(id, suffix string) string {
+	return filepath.Join(s.dir, filepath.Base(id)+suffix)
+}
+
+func (s *FileDeadLetterStore) read(id string) (*DeadLetter, error) {
+	data, err := os.ReadFile(s.path(id, deadLetterSuffix))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrDeadLetterNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDeadLetterStoreFailed, err)
+	}
+	letter := &DeadLetter{}
+	if err := json.Unmarshal(data, letter); err != nil {
+		return nil, fmt.Errorf("%w: failed to parse %s: %w", ErrDeadLetterStoreFailed, id, err)
+	}
+	return letter, nil
+}
@@ -0,0 +1,143 @@
+package agrirouter_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DKE-Data/agrirouter-sdk-go"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// waitForDeadLetters waits until store holds n dead letters and returns them.
+func waitForDeadLetters(t *testing.T, store agrirouter.DeadLetterStore, n int) []*agrirouter.DeadLetter {
+	t.Helper()
+	var letters []*agrirouter.DeadLetter
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		var err error
+		letters, err = store.List(context.Background())
+		require.NoError(c, err)
+		assert.Len(c, letters, n)
+	}, 5*time.Second, 10*time.Millisecond)
+	return letters
+}
+
+func readDeadLetterPayload(t *testing.T, store agrirouter.DeadLetterStore, id string) string {
+	t.Helper()
+	payload, err := store.OpenPayload(context.Background(), id)
+	require.NoError(t, err)
+	defer payload.Close()
+	data, err := io.ReadAll(payload)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestReceiveEvents_DeadLettersFailedMessages(t *testing.T) {
+	api := newFakeAPI(t)
+	acceptConfirmations(api)
+	tenantID, endpointID, messageID := uuid.New(), uuid.New(), uuid.New()
+	api.serveEvents(messageEvent(tenantID, endpointID, messageID, "position"))
+	client := api.client()
+	store, err := agrirouter.NewFileDeadLetterStore(t.TempDir())
+	require.NoError(t, err)
+
+	run := startReceiving(t, func(ctx context.Context, errorHandler func(err error)) error {
+		return client.ReceiveEvents(ctx, nil, agrirouter.EventHandlers{
+			ProcessMessage: func(context.Context, *agrirouter.Message) error {
+				return errors.New("database unavailable")
+			},
+		}, errorHandler, agrirouter.WithAutoConfirm(), agrirouter.WithDeadLetters(store))
+	})
+
+	letter := waitForDeadLetters(t, store, 1)[0]
+	run.stop()
+	assert.Equal(t, agrirouter.DeadLetterMessage, letter.Kind)
+	assert.Equal(t, []uuid.UUID{messageID}, letter.MessageIDs)
+	assert.Equal(t, endpointID, letter.ReceivingEndpointID)
+	assert.Equal(t, "gps:info", letter.MessageType)
+	assert.Equal(t, "database unavailable", letter.Error)
+	assert.Equal(t, "position", readDeadLetterPayload(t, store, letter.ID))
+	assert.Empty(t, confirmationRequests(api))
+
+	var replayed *agrirouter.Message
+	err = client.ReplayDeadLetter(context.Background(), store, letter.ID, agrirouter.EventHandlers{
+		ProcessMessage: func(_ context.Context, message *agrirouter.Message) error {
+			replayed = message
+			return nil
+		},
+	}, agrirouter.WithAutoConfirm())
+	require.NoError(t, err)
+	require.NotNil(t, replayed)
+	assert.Equal(t, messageID, replayed.ID)
+	assert.Equal(t, "position", string(replayed.Payload))
+	require.Len(t, confirmationRequests(api), 1)
+	assert.Equal(t, []agrirouter.MessageConfirmation{{MessageId: messageID, EndpointId: endpointID}},
+		decodeConfirmations(t, confirmationRequests(api)[0]))
+	_, err = store.Get(context.Background(), letter.ID)
+	assert.ErrorIs(t, err, agrirouter.ErrDeadLetterNotFound)
+}
+
+func TestReceiveEvents_DeadLettersWholePayloadOfFailedFiles(t *testing.T) {
+	api := newFakeAPI(t)
+	tenantID, endpointID := uuid.New(), uuid.New()
+	messageIDs := []uuid.UUID{uuid.New(), uuid.New()}
+	api.serveEvents(fileEvent(api, tenantID, endpointID, messageIDs, "taskdata archive"))
+	client := api.client()
+	store, err := agrirouter.NewFileDeadLetterStore(t.TempDir())
+	require.NoError(t, err)
+
+	startReceiving(t, func(ctx context.Context, errorHandler func(err error)) error {
+		return client.ReceiveEvents(ctx, nil, agrirouter.EventHandlers{
+			ProcessFile: func(_ context.Context, file *agrirouter.File) error {
+				_, err := io.ReadFull(file.Payload, make([]byte, 4))
+				require.NoError(t, err)
+				return errors.New("corrupt archive")
+			},
+		}, errorHandler, agrirouter.WithDeadLetters(store))
+	})
+
+	letter := waitForDeadLetters(t, store, 1)[0]
+	assert.Equal(t, agrirouter.DeadLetterFile, letter.Kind)
+	assert.Equal(t, messageIDs, letter.MessageIDs)
+	assert.Equal(t, int64(len("taskdata archive")), letter.Size)
+	assert.Equal(t, "taskdata archive", readDeadLetterPayload(t, store, letter.ID))
+
+	var replayed string
+	err = client.ReplayDeadLetter(context.Background(), store, letter.ID, agrirouter.EventHandlers{
+		ProcessFile: func(_ context.Context, file *agrirouter.File) error {
+			data, err := io.ReadAll(file.Payload)
+			replayed = string(data)
+			return err
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "taskdata archive", replayed)
+}
+
+func TestClient_ReplayDeadLetterKeepsFailedLetters(t *testing.T) {
+	store, err := agrirouter.NewFileDeadLetterStore(t.TempDir())
+	require.NoError(t, err)
+	ctx := context.Background()
+	letter := &agrirouter.DeadLetter{ID: "letter", Kind: agrirouter.DeadLetterMessage, MessageIDs: []uuid.UUID{uuid.New()}}
+	require.NoError(t, store.Put(ctx, letter, strings.NewReader("payload")))
+	client := newFakeAPI(t).client()
+	processingErr := errors.New("still failing")
+
+	err = client.ReplayDeadLetter(ctx, store, "letter", agrirouter.EventHandlers{
+		ProcessMessage: func(context.Context, *agrirouter.Message) error { return processingErr },
+	})
+	require.ErrorIs(t, err, agrirouter.ErrReplayFailed)
+	assert.ErrorIs(t, err, processingErr)
+	_, err = store.Get(ctx, "letter")
+	require.NoError(t, err)
+
+	err = client.ReplayDeadLetter(ctx, store, "letter", agrirouter.EventHandlers{})
+	assert.ErrorIs(t, err, agrirouter.ErrReplayFailed, "no message processor")
+	err = client.ReplayDeadLetter(ctx, store, "unknown", agrirouter.EventHandlers{})
+	assert.ErrorIs(t, err, agrirouter.ErrDeadLetterNotFound)
+}
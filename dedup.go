@@ -0,0 +1,358 @@
+package agrirouter
+
+import (
+	"bufio"
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrSeenStoreFailed is reported when a [SeenStore] fails, f.e because its
+// file could not be written.
+var ErrSeenStoreFailed = errors.New("seen store failed")
+
+// SeenKey identifies a delivery of a message to an endpoint. The same message
+// may be received by several endpoints, each delivery is tracked separately.
+type SeenKey struct {
+	MessageID  uuid.UUID // MessageID is the agrirouter message ID
+	EndpointID uuid.UUID // EndpointID is the agrirouter ID of the receiving endpoint
+}
+
+// SeenStore remembers which messages were handled already, see
+// [WithDeduplication].
+//
+// Implementations must be safe for concurrent use. [MemorySeenStore] and
+// [FileSeenStore] are included implementations.
+type SeenStore interface {
+	// Seen reports whether key was marked as seen before.
+	Seen(ctx context.Context, key SeenKey) (bool, error)
+	// MarkSeen marks key as seen.
+	MarkSeen(ctx context.Context, key SeenKey) error
+}
+
+// WithDeduplication makes [Client.ReceiveEvents] drop messages and files that
+// were handled before, as remembered by store.
+//
+// agrirouter delivers messages again until they are confirmed, and as
+// confirmations are processed asynchronously, a message may be delivered
+// again, f.e after reconnecting. Duplicates are detected before fetching the
+// payload and never reach the handlers.
+//
+// A message is marked as seen once OnMessage returned, or once ProcessMessage
+// returned nil, so that messages that failed to be processed are handled
+// again when redelivered. A file is considered seen when all messages that
+// carried its payload were seen. Errors of store are reported to the error
+// handler, and the message is handled as if it was not seen.
+//
+// With [WithAutoConfirm], duplicates of messages and files processed by
+// ProcessMessage or ProcessFile are confirmed again without being processed,
+// as their redelivery means that confirming them failed, f.e when the
+// confirmation request or a flush of the [ConfirmationBatcher] failed.
+func WithDeduplication(store SeenStore) ReceiveOption {
+	return func(cfg *receiveConfig) {
+		cfg.seenStore = store
+	}
+}
+
+// seen reports whether all keys were seen before according to the seen store
+// of cfg, and false if no seen store is configured.
+func (cfg *receiveConfig) seen(ctx context.Context, errorHandler func(err error), keys ...SeenKey) bool {
+	if cfg.seenStore == nil || len(keys) == 0 {
+		return false
+	}
+	for _, key := range keys {
+		seen, err := cfg.seenStore.Seen(ctx, key)
+		if err != nil {
+			errorHandler(fmt.Errorf("%w: %w", ErrSeenStoreFailed, err))
+			return false
+		}
+		if !seen {
+			return false
+		}
+	}
+	return true
+}
+
+// markSeen marks keys as seen in the seen store of cfg, if configured.
+func (cfg *receiveConfig) markSeen(ctx context.Context, errorHandler func(err error), keys ...SeenKey) {
+	if cfg.seenStore == nil {
+		return
+	}
+	for _, key := range keys {
+		if err := cfg.seenStore.MarkSeen(ctx, key); err != nil {
+			errorHandler(fmt.Errorf("%w: %w", ErrSeenStoreFailed, err))
+		}
+	}
+}
+
+func fileSeenKeys(endpointID uuid.UUID, messageIDs []uuid.UUID) []SeenKey {
+	keys := make([]SeenKey, len(messageIDs))
+	for i, id := range messageIDs {
+		keys[i] = SeenKey{MessageID: id, EndpointID: endpointID}
+	}
+	return keys
+}
+
+// MemorySeenStore is a [SeenStore] keeping keys in memory.
+//
+// It remembers at most a fixed number of keys, evicting the least recently
+// used ones first, and forgets keys after a time to live.
+type MemorySeenStore struct {
+	capacity int
+	ttl      time.Duration
+
+	mu      sync.Mutex
+	entries map[SeenKey]*list.Element
+	order   *list.List // most recently used first
+}
+
+type seenEntry struct {
+	key     SeenKey
+	expires time.Time
+}
+
+var _ SeenStore = (*MemorySeenStore)(nil)
+
+// NewMemorySeenStore creates a [MemorySeenStore] remembering at most capacity
+// keys for ttl each. A zero ttl remembers keys until they are evicted.
+func NewMemorySeenStore(capacity int, ttl time.Duration) *MemorySeenStore {
+	return &MemorySeenStore{
+		capacity: max(capacity, 1),
+		ttl:      ttl,
+		entries:  map[SeenKey]*list.Element{},
+		order:    list.New(),
+	}
+}
+
+// Seen implements [SeenStore].
+func (s *MemorySeenStore) Seen(_ context.Context, key SeenKey) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	element, ok := s.entries[key]
+	if !ok {
+		return false, nil
+	}
+	if entry := element.Value.(*seenEntry); !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		s.order.Remove(element)
+		delete(s.entries, key)
+		return false, nil
+	}
+	s.order.MoveToFront(element)
+	return true, nil
+}
+
+// MarkSeen implements [SeenStore].
+func (s *MemorySeenStore) MarkSeen(_ context.Context, key SeenKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var expires time.Time
+	if s.ttl > 0 {
+		expires = time.Now().Add(s.ttl)
+	}
+	if element, ok := s.entries[key]; ok {
+		element.Value.(*seenEntry).expires = expires
+		s.order.MoveToFront(element)
+		return nil
+	}
+	s.entries[key] = s.order.PushFront(&seenEntry{key: key, expires: expires})
+	for s.order.Len() > s.capacity {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*seenEntry).key)
+	}
+	return nil
+}
+
+// Len returns the number of remembered keys, including expired ones not
+// evicted yet.
+func (s *MemorySeenStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.order.Len()
+}
+
+// FileSeenStore is a [SeenStore] persisting keys in a file, so that they are
+// remembered across restarts.
+//
+// Keys are appended to the file as they are marked. Expired keys are dropped
+// from memory and the file by rewriting the file when the store is opened,
+// and whenever as many keys were marked since as were kept by the last
+// rewrite, but at least 1024, so that the store stays bounded by the keys
+// that did not expire.
+type FileSeenStore struct {
+	path string
+	ttl  time.Duration
+
+	mu        sync.Mutex
+	file      *os.File
+	expires   map[SeenKey]time.Time
+	lines     int // lines is the number of entries in the file
+	compactAt int // compactAt is the number of lines at which the file is compacted
+}
+
+// seenStoreMinCompactLines is the minimum number of lines of the file of a
+// [FileSeenStore] before it is compacted.
+const seenStoreMinCompactLines = 1024
+
+var _ SeenStore = (*FileSeenStore)(nil)
+
+// NewFileSeenStore opens or creates a [FileSeenStore] persisting keys in the
+// file at path, remembering each key for ttl. A zero ttl remembers keys
+// forever. [FileSeenStore.Close] must be called once the store is not
+// needed anymore.
+func NewFileSeenStore(path string, ttl time.Duration) (*FileSeenStore, error) {
+	s := &FileSeenStore{path: path, ttl: ttl, expires: map[SeenKey]time.Time{}}
+	if err := s.load(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSeenStoreFailed, err)
+	}
+	if err := s.compact(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSeenStoreFailed, err)
+	}
+	return s, nil
+}
+
+// Seen implements [SeenStore].
+func (s *FileSeenStore) Seen(_ context.Context, key SeenKey) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expires, ok := s.expires[key]
+	if !ok {
+		return false, nil
+	}
+	if !expires.IsZero() && time.Now().After(expires) {
+		delete(s.expires, key)
+		return false, nil
+	}
+	return true, nil
+}
+
+// MarkSeen implements [SeenStore].
+func (s *FileSeenStore) MarkSeen(_ context.Context, key SeenKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var expires time.Time
+	if s.ttl > 0 {
+		expires = time.Now().Add(s.ttl)
+	}
+	if _, err := io.WriteString(s.file, formatSeenEntry(key, expires)); err != nil {
+		return fmt.Errorf("%w: %w", ErrSeenStoreFailed, err)
+	}
+	s.expires[key] = expires
+	s.lines++
+	if s.lines < s.compactAt {
+		return nil
+	}
+	if err := s.compact(); err != nil {
+		// keep appending to the file, and try again later
+		s.compactAt = s.lines + seenStoreMinCompactLines
+		return fmt.Errorf("%w: %w", ErrSeenStoreFailed, err)
+	}
+	return nil
+}
+
+// Close closes the file of the store.
+func (s *FileSeenStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+func (s *FileSeenStore) load() error {
+	file, err := os.Open(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, expires, ok := parseSeenEntry(scanner.Text())
+		if !ok {
+			// skip lines that were only partially written, f.e on a crash
+			continue
+		}
+		s.expires[key] = expires
+	}
+	return scanner.Err()
+}
+
+// compact drops expired keys, rewrites the file with the remaining ones and
+// opens it for appending, replacing the file opened before, if any.
+func (s *FileSeenStore) compact() error {
+	now := time.Now()
+	err := writeFileAtomically(s.path, func(w io.Writer) error {
+		buffered := bufio.NewWriter(w)
+		for key, expires := range s.expires {
+			if !expires.IsZero() && now.After(expires) {
+				delete(s.expires, key)
+				continue
+			}
+			if _, err := buffered.WriteString(formatSeenEntry(key, expires)); err != nil {
+				return err
+			}
+		}
+		return buffered.Flush()
+	})
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	if s.file != nil {
+		_ = s.file.Close()
+	}
+	s.file = file
+	s.lines = len(s.expires)
+	s.compactAt = max(2*s.lines, seenStoreMinCompactLines)
+	return nil
+}
+
+// formatSeenEntry formats a line of the file of a [FileSeenStore]:
+// the message ID, the endpoint ID and the expiry as unix timestamp in
+// seconds, zero if the key never expires.
+func formatSeenEntry(key SeenKey, expires time.Time) string {
+	var unix int64
+	if !expires.IsZero() {
+		unix = expires.Unix()
+	}
+	return fmt.Sprintf("%s %s %d\n", key.MessageID, key.EndpointID, unix)
+}
+
+func parseSeenEntry(line string) (SeenKey, time.Time, bool) {
+	fields := strings.Fields(line)
+	if len(fields) != 3 {
+		return SeenKey{}, time.Time{}, false
+	}
+	messageID, err := uuid.Parse(fields[0])
+	if err != nil {
+		return SeenKey{}, time.Time{}, false
+	}
+	endpointID, err := uuid.Parse(fields[1])
+	if err != nil {
+		return SeenKey{}, time.Time{}, false
+	}
+	unix, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return SeenKey{}, time.Time{}, false
+	}
+	var expires time.Time
+	if unix != 0 {
+		expires = time.Unix(unix, 0)
+	}
+	return SeenKey{MessageID: messageID, EndpointID: endpointID}, expires, true
+}
@@ -0,0 +1,248 @@
+package agrirouter_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DKE-Data/agrirouter-sdk-go"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReceiveEvents_DropsRedeliveredMessages(t *testing.T) {
+	api := newFakeAPI(t)
+	tenantID, endpointID, otherEndpointID := uuid.New(), uuid.New(), uuid.New()
+	messageID := uuid.New()
+	api.serveEvents(
+		messageEvent(tenantID, endpointID, messageID, "first"),
+		messageEvent(tenantID, endpointID, messageID, "again"),
+		messageEvent(tenantID, otherEndpointID, messageID, "other endpoint"),
+	)
+	client := api.client()
+
+	var mu sync.Mutex
+	var payloads []string
+	startReceiving(t, func(ctx context.Context, errorHandler func(err error)) error {
+		return client.ReceiveEvents(ctx, nil, agrirouter.EventHandlers{
+			OnMessage: func(_ context.Context, message *agrirouter.Message) {
+				mu.Lock()
+				defer mu.Unlock()
+				payloads = append(payloads, string(message.Payload))
+			},
+		}, errorHandler, agrirouter.WithDeduplication(agrirouter.NewMemorySeenStore(10, time.Hour)))
+	})
+
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(c, []string{"first", "other endpoint"}, payloads)
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestReceiveEvents_HandlesFailedMessagesAgain(t *testing.T) {
+	api := newFakeAPI(t)
+	tenantID, endpointID, messageID := uuid.New(), uuid.New(), uuid.New()
+	api.serveEvents(
+		messageEvent(tenantID, endpointID, messageID, "fails"),
+		messageEvent(tenantID, endpointID, messageID, "succeeds"),
+		messageEvent(tenantID, endpointID, messageID, "duplicate"),
+	)
+	client := api.client()
+
+	var mu sync.Mutex
+	var payloads []string
+	startReceiving(t, func(ctx context.Context, errorHandler func(err error)) error {
+		return client.ReceiveEvents(ctx, nil, agrirouter.EventHandlers{
+			ProcessMessage: func(_ context.Context, message *agrirouter.Message) error {
+				mu.Lock()
+				defer mu.Unlock()
+				payloads = append(payloads, string(message.Payload))
+				if len(payloads) == 1 {
+					return errors.New("temporary failure")
+				}
+				return nil
+			},
+		}, errorHandler, agrirouter.WithDeduplication(agrirouter.NewMemorySeenStore(10, 0)))
+	})
+
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(c, []string{"fails", "succeeds"}, payloads)
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestReceiveEvents_ConfirmsRedeliveriesOfProcessedMessages(t *testing.T) {
+	api := newFakeAPI(t)
+	var confirmRequests int
+	api.handle(http.MethodPost, "/confirmations", func(w http.ResponseWriter, _ *http.Request) {
+		confirmRequests++
+		if confirmRequests == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+	tenantID, endpointID, messageID := uuid.New(), uuid.New(), uuid.New()
+	api.serveEvents(
+		messageEvent(tenantID, endpointID, messageID, "first"),
+		messageEvent(tenantID, endpointID, messageID, "redelivered"),
+	)
+	client := api.client()
+
+	var mu sync.Mutex
+	var payloads []string
+	run := startReceiving(t, func(ctx context.Context, errorHandler func(err error)) error {
+		return client.ReceiveEvents(ctx, nil, agrirouter.EventHandlers{
+			ProcessMessage: func(_ context.Context, message *agrirouter.Message) error {
+				mu.Lock()
+				defer mu.Unlock()
+				payloads = append(payloads, string(message.Payload))
+				return nil
+			},
+		}, errorHandler, agrirouter.WithAutoConfirm(), agrirouter.WithDeduplication(agrirouter.NewMemorySeenStore(10, 0)))
+	})
+
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		assert.Len(c, confirmationRequests(api), 2)
+	}, 5*time.Second, 10*time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"first"}, payloads, "the redelivery is not processed again")
+	for _, request := range confirmationRequests(api) {
+		assert.Equal(t, []agrirouter.MessageConfirmation{{MessageId: messageID, EndpointId: endpointID}},
+			decodeConfirmations(t, request))
+	}
+	require.Len(t, run.reported(), 1)
+	assert.ErrorIs(t, run.reported()[0], agrirouter.ErrAutoConfirmFailed)
+}
+
+func TestReceiveEvents_DropsRedeliveredFilesBeforeFetching(t *testing.T) {
+	api := newFakeAPI(t)
+	tenantID, endpointID := uuid.New(), uuid.New()
+	messageIDs := []uuid.UUID{uuid.New(), uuid.New()}
+	store := agrirouter.NewMemorySeenStore(10, time.Hour)
+	require.NoError(t, store.MarkSeen(context.Background(), agrirouter.SeenKey{MessageID: messageIDs[0], EndpointID: endpointID}))
+	api.serveEvents(
+		fileEvent(api, tenantID, endpointID, messageIDs, "first"),
+		fileEvent(api, tenantID, endpointID, messageIDs, "again"),
+	)
+	client := api.client()
+
+	var mu sync.Mutex
+	var files int
+	startReceiving(t, func(ctx context.Context, errorHandler func(err error)) error {
+		return client.ReceiveEvents(ctx, nil, agrirouter.EventHandlers{
+			OnFile: func(context.Context, *agrirouter.File) {
+				mu.Lock()
+				defer mu.Unlock()
+				files++
+			},
+		}, errorHandler, agrirouter.WithDeduplication(store))
+	})
+
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(c, 1, files, "a file is handled unless all its messages were seen")
+	}, 5*time.Second, 10*time.Millisecond)
+	time.Sleep(50 * time.Millisecond)
+
+	var fetched int
+	for _, request := range api.recorded() {
+		if strings.HasPrefix(request.Path, "/payloads/") {
+			fetched++
+		}
+	}
+	assert.Equal(t, 1, fetched)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 1, files)
+}
+
+func TestMemorySeenStore_EvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	store := agrirouter.NewMemorySeenStore(2, 0)
+	a, b, c := seenKey(), seenKey(), seenKey()
+
+	require.NoError(t, store.MarkSeen(ctx, a))
+	require.NoError(t, store.MarkSeen(ctx, b))
+	seen, _ := store.Seen(ctx, a)
+	require.True(t, seen)
+	require.NoError(t, store.MarkSeen(ctx, c))
+
+	assert.Equal(t, 2, store.Len())
+	for key, want := range map[agrirouter.SeenKey]bool{a: true, b: false, c: true} {
+		seen, err := store.Seen(ctx, key)
+		require.NoError(t, err)
+		assert.Equal(t, want, seen)
+	}
+}
+
+func TestMemorySeenStore_ForgetsExpiredKeys(t *testing.T) {
+	ctx := context.Background()
+	store := agrirouter.NewMemorySeenStore(10, 10*time.Millisecond)
+	key := seenKey()
+
+	require.NoError(t, store.MarkSeen(ctx, key))
+	seen, _ := store.Seen(ctx, key)
+	assert.True(t, seen)
+	time.Sleep(20 * time.Millisecond)
+	seen, _ = store.Seen(ctx, key)
+	assert.False(t, seen)
+}
+
+func TestFileSeenStore_RemembersAcrossReopening(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "seen")
+	kept, expiring := seenKey(), seenKey()
+
+	store, err := agrirouter.NewFileSeenStore(path, 0)
+	require.NoError(t, err)
+	require.NoError(t, store.MarkSeen(ctx, kept))
+	require.NoError(t, store.Close())
+
+	store, err = agrirouter.NewFileSeenStore(path, time.Millisecond)
+	require.NoError(t, err)
+	require.NoError(t, store.MarkSeen(ctx, expiring))
+	require.NoError(t, store.Close())
+	time.Sleep(1100 * time.Millisecond)
+
+	store, err = agrirouter.NewFileSeenStore(path, 0)
+	require.NoError(t, err)
+	defer store.Close()
+	seen, err := store.Seen(ctx, kept)
+	require.NoError(t, err)
+	assert.True(t, seen)
+	seen, err = store.Seen(ctx, expiring)
+	require.NoError(t, err)
+	assert.False(t, seen)
+}
+
+func seenKey() agrirouter.SeenKey {
+	return agrirouter.SeenKey{MessageID: uuid.New(), EndpointID: uuid.New()}
+}
+
+func TestFileSeenStore_CompactsWhileRunning(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "seen")
+	store, err := agrirouter.NewFileSeenStore(path, time.Nanosecond)
+	require.NoError(t, err)
+	defer store.Close()
+
+	for range 5000 {
+		require.NoError(t, store.MarkSeen(ctx, seenKey()))
+	}
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Less(t, strings.Count(string(content), "\n"), 2048, "expired keys are dropped from the file")
+}
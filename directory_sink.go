@@ -0,0 +1,330 @@
+package agrirouter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrDiskUsageExceeded is returned by [DirectorySink] when saving a
+	// payload would exceed the maximum disk usage, see [WithMaxDiskUsage].
+	ErrDiskUsageExceeded = errors.New("maximum disk usage exceeded")
+
+	// ErrDirectorySinkFailed is returned by [DirectorySink] when writing to
+	// the file system fails.
+	ErrDirectorySinkFailed = errors.New("directory sink failed")
+)
+
+const (
+	sinkMetadataSuffix = ".json"
+	sinkUnknownTenant  = "unknown-tenant"
+)
+
+// SavedPayload describes a payload saved by [DirectorySink], it is also
+// written as JSON sidecar next to the payload.
+type SavedPayload struct {
+	// Path is the path of the payload file.
+	Path string `json:"path"`
+	// MetadataPath is the path of the JSON sidecar.
+	MetadataPath string `json:"-"`
+	// MessageIDs are the agrirouter IDs of the message, or of the messages
+	// that carried the payload of a file.
+	MessageIDs []uuid.UUID `json:"message_ids"`
+	// AppMessageID is the ID assigned by the sending endpoint, only set for
+	// messages.
+	AppMessageID string `json:"app_message_id,omitempty"`
+	// MessageType is the URN type of the message or file.
+	MessageType string `json:"message_type"`
+	// ReceivingEndpointID is the agrirouter ID of the receiving endpoint.
+	ReceivingEndpointID uuid.UUID `json:"receiving_endpoint_id"`
+	// Filename is the filename as sent by the sender endpoint, if any.
+	Filename *string `json:"filename,omitempty"`
+	// TenantID is the tenant to which the receiving endpoint belongs.
+	TenantID *string `json:"tenant_id,omitempty"`
+	// TeamsetContextID is the teamset context ID provided by the sending
+	// application, if any.
+	TeamsetContextID *string `json:"teamset_context_id,omitempty"`
+	// Size is the size of the payload in bytes.
+	Size int64 `json:"size"`
+	// SavedAt is the time the payload was saved.
+	SavedAt time.Time `json:"saved_at"`
+}
+
+// DirectorySink saves payloads of received messages and files to a
+// directory.
+//
+// Payloads are saved as <dir>/<tenant ID>/<endpoint ID>/<message ID>_<name>,
+// where name is the filename given by the sender, or the app message ID
+// followed by the extension of the message type, see
+// [FileExtensionForMessageType]. All parts are sanitized, so that senders
+// cannot write outside of the directory. If the file exists already, f.e
+// because a message was delivered again, a counter is appended to the name.
+// Every payload is accompanied by a JSON sidecar named like the payload with
+// ".json" appended, holding its [SavedPayload] metadata.
+//
+// Payloads and sidecars are written atomically, by writing to temporary files
+// that are renamed once complete. A sink must not share its directory with
+// other sinks.
+type DirectorySink struct {
+	dir          string
+	maxDiskUsage int64
+
+	mu   sync.Mutex
+	used int64
+}
+
+// DirectorySinkOption configures a [DirectorySink].
+type DirectorySinkOption func(*DirectorySink)
+
+// WithMaxDiskUsage limits the total size of the files in the directory of a
+// [DirectorySink] to maxBytes. Payloads that would exceed the limit fail with
+// [ErrDiskUsageExceeded]. Payloads and their sidecars count towards the
+// limit. By default the disk usage is not limited.
+func WithMaxDiskUsage(maxBytes int64) DirectorySinkOption {
+	return func(s *DirectorySink) {
+		s.maxDiskUsage = maxBytes
+	}
+}
+
+// NewDirectorySink creates a [DirectorySink] saving payloads to dir, which is
+// created if it does not exist yet. Files already in dir count towards the
+// maximum disk usage.
+func NewDirectorySink(dir string, opts ...DirectorySinkOption) (*DirectorySink, error) {
+	s := &DirectorySink{dir: dir}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if err := os.MkdirAll(dir, outboxDirPerm); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDirectorySinkFailed, err)
+	}
+	err := filepath.WalkDir(dir, func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		s.used += info.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDirectorySinkFailed, err)
+	}
+	return s, nil
+}
+
+// DiskUsage returns the total size of the files in the directory of the sink.
+func (s *DirectorySink) DiskUsage() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.used
+}
+
+// SaveMessage saves the payload of message.
+func (s *DirectorySink) SaveMessage(_ context.Context, message *Message) (*SavedPayload, error) {
+	name := message.AppMessageID + FileExtensionForMessageType(message.MessageType)
+	if message.Filename != nil && *message.Filename != "" {
+		name = *message.Filename
+	}
+	saved := &SavedPayload{
+		MessageIDs:          []uuid.UUID{message.ID},
+		AppMessageID:        message.AppMessageID,
+		MessageType:         message.MessageType,
+		ReceivingEndpointID: message.ReceivingEndpointID,
+		Filename:            message.Filename,
+		TenantID:            message.TenantID,
+		TeamsetContextID:    message.TeamsetContextID,
+	}
+	if err := s.save(saved, message.ID, name, bytes.NewReader(message.Payload)); err != nil {
+		return nil, err
+	}
+	return saved, nil
+}
+
+// SaveFile saves the payload of file, consuming it.
+func (s *DirectorySink) SaveFile(_ context.Context, file *File) (*SavedPayload, error) {
+	var messageID uuid.UUID
+	if len(file.MessageIDs) > 0 {
+		messageID = file.MessageIDs[0]
+	}
+	name := FileExtensionForMessageType(file.MessageType)
+	if file.Filename != nil && *file.Filename != "" {
+		name = *file.Filename
+	}
+	saved := &SavedPayload{
+		MessageIDs:          file.MessageIDs,
+		MessageType:         file.MessageType,
+		ReceivingEndpointID: file.ReceivingEndpointID,
+		Filename:            file.Filename,
+		TenantID:            file.TenantID,
+		TeamsetContextID:    file.TeamsetContextID,
+	}
+	if err := s.save(saved, messageID, name, file.Payload); err != nil {
+		return nil, err
+	}
+	return saved, nil
+}
+
+// ProcessMessage saves the payload of message. It implements
+// [MessageProcessor].
+func (s *DirectorySink) ProcessMessage(ctx context.Context, message *Message) error {
+	_, err := s.SaveMessage(ctx, message)
+	return err
+}
+
+// ProcessFile saves the payload of file. It implements [FileProcessor].
+func (s *DirectorySink) ProcessFile(ctx context.Context, file *File) error {
+	_, err := s.SaveFile(ctx, file)
+	return err
+}
+
+func (s *DirectorySink) save(saved *SavedPayload, messageID uuid.UUID, name string, payload io.Reader) error {
+	tenant := sinkUnknownTenant
+	if saved.TenantID != nil {
+		// tenant IDs like ".." sanitize to nothing
+		if sanitized := sanitizeFilename(*saved.TenantID); sanitized != "" {
+			tenant = sanitized
+		}
+	}
+	dir := filepath.Join(s.dir, tenant, saved.ReceivingEndpointID.String())
+	base := messageID.String()
+	if name = sanitizeFilename(name); name != "" {
+		if strings.HasPrefix(name, ".") {
+			base += name
+		} else {
+			base += "_" + name
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := os.MkdirAll(dir, outboxDirPerm); err != nil {
+		return fmt.Errorf("%w: %w", ErrDirectorySinkFailed, err)
+	}
+	path, err := availablePath(dir, base)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrDirectorySinkFailed, err)
+	}
+
+	limited := s.maxDiskUsage > 0
+	remaining := s.maxDiskUsage - s.used
+	if limited && remaining <= 0 {
+		return fmt.Errorf("%w: saving payload of message %s", ErrDiskUsageExceeded, messageID)
+	}
+	var size int64
+	err = writeFileAtomically(path, func(w io.Writer) error {
+		if !limited {
+			n, err := io.Copy(w, payload)
+			size = n
+			return err
+		}
+		// One byte more than allowed is copied to detect exceeding the limit.
+		n, err := io.Copy(w, io.LimitReader(payload, remaining+1))
+		size = n
+		if err == nil && n > remaining {
+			return fmt.Errorf("%w: saving payload of message %s", ErrDiskUsageExceeded, messageID)
+		}
+		return err
+	})
+	if errors.Is(err, ErrDiskUsageExceeded) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrDirectorySinkFailed, err)
+	}
+
+	saved.Path = path
+	saved.MetadataPath = path + sinkMetadataSuffix
+	saved.Size = size
+	saved.SavedAt = time.Now()
+	metadata, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		_ = os.Remove(path)
+		return fmt.Errorf("%w: %w", ErrDirectorySinkFailed, err)
+	}
+	if limited && size+int64(len(metadata)) > remaining {
+		_ = os.Remove(path)
+		return fmt.Errorf("%w: saving payload of message %s", ErrDiskUsageExceeded, messageID)
+	}
+	err = writeFileAtomically(saved.MetadataPath, func(w io.Writer) error {
+		_, err := w.Write(metadata)
+		return err
+	})
+	if err != nil {
+		_ = os.Remove(path)
+		return fmt.Errorf("%w: %w", ErrDirectorySinkFailed, err)
+	}
+	s.used += size + int64(len(metadata))
+	return nil
+}
+
+// availablePath returns a path in dir named base, or base with a counter
+// appended to its stem if that path or its sidecar exists already.
+func availablePath(dir, base string) (string, error) {
+	ext := filepath.Ext(base)
+	stem := strings.TrimSuffix(base, ext)
+	for i := 0; ; i++ {
+		name := base
+		if i > 0 {
+			name = stem + "-" + strconv.Itoa(i) + ext
+		}
+		path := filepath.Join(dir, name)
+		exists, err := fileExists(path)
+		if err == nil && !exists {
+			exists, err = fileExists(path + sinkMetadataSuffix)
+		}
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return path, nil
+		}
+	}
+}
+
+func fileExists(path string) (bool, error) {
+	_, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// sanitizeFilename turns name into a safe file name by replacing everything
+// but ASCII letters, digits, '.', '-' and '_' by '_', so that it can neither
+// contain path separators nor refer to a parent directory. Leading dots
+// are removed, except for a single one, and the result is truncated to
+// [FilenameMaxLength] characters.
+func sanitizeFilename(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	sanitized := b.String()
+	if trimmed := strings.TrimLeft(sanitized, "."); trimmed != sanitized {
+		sanitized = "." + trimmed
+	}
+	if sanitized == "." {
+		return ""
+	}
+	return truncateFilename(sanitized)
+}
@@ -0,0 +1,158 @@
+package agrirouter_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DKE-Data/agrirouter-sdk-go"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirectorySink_SavesMessageWithSidecar(t *testing.T) {
+	dir := t.TempDir()
+	sink, err := agrirouter.NewDirectorySink(dir)
+	require.NoError(t, err)
+	tenant := uuid.NewString()
+	message := &agrirouter.Message{
+		ID:                  uuid.New(),
+		MessageType:         agrirouter.MessageTypeGPSInfo,
+		Payload:             []byte("position"),
+		AppMessageID:        "context-1",
+		ReceivingEndpointID: uuid.New(),
+		TenantID:            &tenant,
+	}
+
+	saved, err := sink.SaveMessage(context.Background(), message)
+	require.NoError(t, err)
+
+	assert.Equal(t, filepath.Join(dir, tenant, message.ReceivingEndpointID.String(),
+		message.ID.String()+"_context-1.gps.info.pb"), saved.Path)
+	payload, err := os.ReadFile(saved.Path)
+	require.NoError(t, err)
+	assert.Equal(t, "position", string(payload))
+
+	metadata, err := os.ReadFile(saved.Path + ".json")
+	require.NoError(t, err)
+	var sidecar agrirouter.SavedPayload
+	require.NoError(t, json.Unmarshal(metadata, &sidecar))
+	assert.Equal(t, []uuid.UUID{message.ID}, sidecar.MessageIDs)
+	assert.Equal(t, "context-1", sidecar.AppMessageID)
+	assert.Equal(t, agrirouter.MessageTypeGPSInfo, sidecar.MessageType)
+	assert.Equal(t, int64(len("position")), sidecar.Size)
+	assert.Equal(t, saved.Path, sidecar.Path)
+	assert.Equal(t, int64(len(payload)+len(metadata)), sink.DiskUsage())
+}
+
+func TestDirectorySink_SanitizesNames(t *testing.T) {
+	dir := t.TempDir()
+	sink, err := agrirouter.NewDirectorySink(dir)
+	require.NoError(t, err)
+	tenant := "../../tenant"
+	filename := "../../etc/pass wd"
+	ctx := context.Background()
+
+	saved, err := sink.SaveMessage(ctx, &agrirouter.Message{ID: uuid.New(), AppMessageID: "../escape", TenantID: &tenant})
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(saved.Path, dir+string(filepath.Separator)), saved.Path)
+	for _, element := range strings.Split(strings.TrimPrefix(saved.Path, dir), string(filepath.Separator)) {
+		assert.NotEqual(t, "..", element, "no parent directory references")
+	}
+
+	saved, err = sink.SaveFile(ctx, &agrirouter.File{
+		MessageIDs: []uuid.UUID{uuid.New()},
+		Filename:   &filename,
+		Payload:    strings.NewReader("file"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, dir, filepath.Dir(filepath.Dir(filepath.Dir(saved.Path))))
+	assert.NotContains(t, filepath.Base(saved.Path), " ")
+}
+
+func TestDirectorySink_AppendsCounterOnCollision(t *testing.T) {
+	sink, err := agrirouter.NewDirectorySink(t.TempDir())
+	require.NoError(t, err)
+	filename := "taskdata.zip"
+	file := func() *agrirouter.File {
+		return &agrirouter.File{
+			MessageIDs: []uuid.UUID{uuid.Nil},
+			Filename:   &filename,
+			Payload:    strings.NewReader("zip"),
+		}
+	}
+
+	first, err := sink.SaveFile(context.Background(), file())
+	require.NoError(t, err)
+	second, err := sink.SaveFile(context.Background(), file())
+	require.NoError(t, err)
+
+	assert.Equal(t, uuid.Nil.String()+"_taskdata.zip", filepath.Base(first.Path))
+	assert.Equal(t, uuid.Nil.String()+"_taskdata-1.zip", filepath.Base(second.Path))
+}
+
+func TestDirectorySink_EnforcesMaxDiskUsage(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "existing"), make([]byte, 600), 0o600))
+	sink, err := agrirouter.NewDirectorySink(dir, agrirouter.WithMaxDiskUsage(1000))
+	require.NoError(t, err)
+	assert.Equal(t, int64(600), sink.DiskUsage())
+
+	err = sink.ProcessFile(context.Background(), &agrirouter.File{
+		MessageIDs: []uuid.UUID{uuid.New()},
+		Payload:    strings.NewReader(strings.Repeat("x", 401)),
+	})
+	require.ErrorIs(t, err, agrirouter.ErrDiskUsageExceeded)
+	assert.Equal(t, int64(600), sink.DiskUsage())
+	entries, err := os.ReadDir(filepath.Join(dir, "unknown-tenant", uuid.Nil.String()))
+	require.NoError(t, err)
+	assert.Empty(t, entries, "no partial payload is left behind")
+
+	require.NoError(t, sink.ProcessMessage(context.Background(), &agrirouter.Message{ID: uuid.New(), Payload: []byte("small")}))
+}
+
+func TestDirectorySink_StaysWithinMaxDiskUsage(t *testing.T) {
+	dir := t.TempDir()
+	sink, err := agrirouter.NewDirectorySink(dir, agrirouter.WithMaxDiskUsage(400))
+	require.NoError(t, err)
+	message := func(size int) *agrirouter.Message {
+		return &agrirouter.Message{ID: uuid.New(), Payload: make([]byte, size)}
+	}
+
+	require.ErrorIs(t, sink.ProcessMessage(context.Background(), message(350)), agrirouter.ErrDiskUsageExceeded,
+		"the payload fits, but not together with its sidecar")
+	assert.Zero(t, sink.DiskUsage())
+	require.NoError(t, sink.ProcessMessage(context.Background(), message(10)))
+	assert.LessOrEqual(t, sink.DiskUsage(), int64(400))
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "existing"), make([]byte, 500), 0o600))
+	sink, err = agrirouter.NewDirectorySink(dir, agrirouter.WithMaxDiskUsage(400))
+	require.NoError(t, err)
+	usage := sink.DiskUsage()
+	require.ErrorIs(t, sink.ProcessMessage(context.Background(), message(1)), agrirouter.ErrDiskUsageExceeded,
+		"nothing is saved once the usage exceeds the limit")
+	require.ErrorIs(t, sink.ProcessFile(context.Background(), &agrirouter.File{
+		MessageIDs: []uuid.UUID{uuid.New()},
+		Payload:    strings.NewReader(strings.Repeat("x", 10000)),
+	}), agrirouter.ErrDiskUsageExceeded)
+	assert.Equal(t, usage, sink.DiskUsage())
+}
+
+func TestDirectorySink_SavesUnsanitizableTenantsAsUnknown(t *testing.T) {
+	dir := t.TempDir()
+	sink, err := agrirouter.NewDirectorySink(dir)
+	require.NoError(t, err)
+	endpointID := uuid.New()
+
+	for _, tenant := range []string{".", ".."} {
+		saved, err := sink.SaveMessage(context.Background(), &agrirouter.Message{
+			ID: uuid.New(), ReceivingEndpointID: endpointID, TenantID: &tenant,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, filepath.Join(dir, "unknown-tenant", endpointID.String()), filepath.Dir(saved.Path))
+	}
+}
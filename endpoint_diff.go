@@ -0,0 +1,249 @@
+package agrirouter
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// EndpointChangeKind tells how an endpoint changed, see [EndpointChange].
+type EndpointChangeKind string
+
+const (
+	EndpointAdded               EndpointChangeKind = "endpoint_added"       // EndpointAdded is an endpoint that was not listed before
+	EndpointRemoved             EndpointChangeKind = "endpoint_removed"     // EndpointRemoved is an endpoint that is not listed anymore
+	EndpointRenamed             EndpointChangeKind = "endpoint_renamed"     // EndpointRenamed is an endpoint whose name changed
+	EndpointCapabilitiesChanged EndpointChangeKind = "capabilities_changed" // EndpointCapabilitiesChanged is an endpoint whose capabilities changed
+	EndpointRoutesChanged       EndpointChangeKind = "routes_changed"       // EndpointRoutesChanged is an endpoint that gained or lost routes
+)
+
+// RouteDirection tells whether a [Route] leads to or from an endpoint.
+type RouteDirection string
+
+const (
+	RouteSendTo      RouteDirection = "send_to"      // RouteSendTo is a route to a peer, see [RoutedEndpoints.CanSendTo]
+	RouteReceiveFrom RouteDirection = "receive_from" // RouteReceiveFrom is a route from a peer, see [RoutedEndpoints.CanReceiveFrom]
+)
+
+// Route is a route of an endpoint to or from a peer endpoint for a message
+// type, as listed in [RoutedEndpoints].
+type Route struct {
+	Direction   RouteDirection // Direction tells whether messages are sent to or received from the peer
+	PeerID      uuid.UUID      // PeerID is the agrirouter ID of the peer endpoint
+	MessageType string         // MessageType is the routed message type
+}
+
+// EndpointChange is a change of an endpoint between two endpoint lists of a
+// tenant, see [DiffEndpoints].
+type EndpointChange struct {
+	Kind       EndpointChangeKind
+	EndpointID uuid.UUID
+	// Previous is the endpoint as listed before, nil if it was added.
+	Previous *TenantEndpointInfo
+	// Current is the endpoint as listed now, nil if it was removed.
+	Current *TenantEndpointInfo
+
+	// CanSendAdded and CanSendRemoved are the message types added to or
+	// removed from [TenantEndpointCapabilities.CanSend], set for
+	// [EndpointCapabilitiesChanged].
+	CanSendAdded, CanSendRemoved []string
+	// CanReceiveAdded and CanReceiveRemoved are the message types added to or
+	// removed from [TenantEndpointCapabilities.CanReceive], set for
+	// [EndpointCapabilitiesChanged].
+	CanReceiveAdded, CanReceiveRemoved []string
+
+	// RoutesGained and RoutesLost are the routes the endpoint gained or lost,
+	// set for [EndpointRoutesChanged].
+	RoutesGained, RoutesLost []Route
+}
+
+// DiffEndpoints compares two successive endpoint lists of a tenant and
+// returns what changed. An endpoint that changed in several ways has one
+// change per kind. Changes of endpoints in current come first in the order of
+// current, followed by removed endpoints in the order of previous.
+func DiffEndpoints(previous, current []TenantEndpointInfo) []EndpointChange {
+	previousByID := make(map[uuid.UUID]*TenantEndpointInfo, len(previous))
+	for i := range previous {
+		previousByID[previous[i].Id] = &previous[i]
+	}
+	listed := make(map[uuid.UUID]bool, len(current))
+	var changes []EndpointChange
+	for i := range current {
+		after := &current[i]
+		listed[after.Id] = true
+		before, ok := previousByID[after.Id]
+		if !ok {
+			changes = append(changes, EndpointChange{Kind: EndpointAdded, EndpointID: after.Id, Current: after})
+			continue
+		}
+		changes = append(changes, diffEndpoint(before, after)...)
+	}
+	for i := range previous {
+		if !listed[previous[i].Id] {
+			changes = append(changes, EndpointChange{Kind: EndpointRemoved, EndpointID: previous[i].Id, Previous: &previous[i]})
+		}
+	}
+	return changes
+}
+
+func diffEndpoint(before, after *TenantEndpointInfo) []EndpointChange {
+	var changes []EndpointChange
+	change := func(kind EndpointChangeKind) EndpointChange {
+		return EndpointChange{Kind: kind, EndpointID: after.Id, Previous: before, Current: after}
+	}
+	if before.Name != after.Name {
+		changes = append(changes, change(EndpointRenamed))
+	}
+	capabilities := change(EndpointCapabilitiesChanged)
+	capabilities.CanSendAdded = missingFrom(after.Capabilities.CanSend, before.Capabilities.CanSend)
+	capabilities.CanSendRemoved = missingFrom(before.Capabilities.CanSend, after.Capabilities.CanSend)
+	capabilities.CanReceiveAdded = missingFrom(after.Capabilities.CanReceive, before.Capabilities.CanReceive)
+	capabilities.CanReceiveRemoved = missingFrom(before.Capabilities.CanReceive, after.Capabilities.CanReceive)
+	if capabilities.CanSendAdded != nil || capabilities.CanSendRemoved != nil ||
+		capabilities.CanReceiveAdded != nil || capabilities.CanReceiveRemoved != nil {
+		changes = append(changes, capabilities)
+	}
+	routesBefore, routesAfter := endpointRoutes(before), endpointRoutes(after)
+	routes := change(EndpointRoutesChanged)
+	routes.RoutesGained = missingFrom(routesAfter, routesBefore)
+	routes.RoutesLost = missingFrom(routesBefore, routesAfter)
+	if routes.RoutesGained != nil || routes.RoutesLost != nil {
+		changes = append(changes, routes)
+	}
+	return changes
+}
+
+// endpointRoutes returns the routes of endpoint, ordered by direction, peer
+// and message type.
+func endpointRoutes(endpoint *TenantEndpointInfo) []Route {
+	if endpoint.RoutedEndpoints == nil {
+		return nil
+	}
+	var routes []Route
+	add := func(direction RouteDirection, routeMap *EndpointRouteMap) {
+		if routeMap == nil {
+			return
+		}
+		for peer, messageTypes := range *routeMap {
+			peerID, err := uuid.Parse(peer)
+			if err != nil {
+				continue
+			}
+			for _, messageType := range messageTypes {
+				routes = append(routes, Route{Direction: direction, PeerID: peerID, MessageType: messageType})
+			}
+		}
+	}
+	add(RouteSendTo, endpoint.RoutedEndpoints.CanSendTo)
+	add(RouteReceiveFrom, endpoint.RoutedEndpoints.CanReceiveFrom)
+	slices.SortFunc(routes, func(a, b Route) int {
+		return cmp.Or(
+			cmp.Compare(a.Direction, b.Direction),
+			cmp.Compare(a.PeerID.String(), b.PeerID.String()),
+			cmp.Compare(a.MessageType, b.MessageType),
+		)
+	})
+	return routes
+}
+
+// missingFrom returns the elements of a that are not in b, in the order of a,
+// or nil if there are none.
+func missingFrom[T comparable](a, b []T) []T {
+	var missing []T
+	for _, element := range a {
+		if !slices.Contains(b, element) && !slices.Contains(missing, element) {
+			missing = append(missing, element)
+		}
+	}
+	return missing
+}
+
+// EndpointDiffHandler is called with the changes of the endpoints of a tenant,
+// see [WithEndpointDiffs].
+type EndpointDiffHandler func(ctx context.Context, tenantID uuid.UUID, changes []EndpointChange)
+
+// EndpointDiffer remembers the last endpoint list of each tenant to diff it
+// with the next one, see [WithEndpointDiffs].
+//
+// Differs are safe for concurrent use.
+type EndpointDiffer struct {
+	mu        sync.Mutex
+	endpoints map[uuid.UUID][]TenantEndpointInfo
+}
+
+// NewEndpointDiffer creates an [EndpointDiffer] knowing no endpoints.
+func NewEndpointDiffer() *EndpointDiffer {
+	return &EndpointDiffer{endpoints: map[uuid.UUID][]TenantEndpointInfo{}}
+}
+
+// Seed sets the endpoints of tenantID the next list is compared to, f.e as
+// listed by [Client.ListTenantEndpoints] on start.
+func (d *EndpointDiffer) Seed(tenantID uuid.UUID, endpoints []TenantEndpointInfo) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.endpoints[tenantID] = endpoints
+}
+
+// Diff returns the changes from the last endpoint list of tenantID to
+// endpoints, and remembers endpoints for the next call. All endpoints are
+// reported as added if no list of tenantID was seen before.
+func (d *EndpointDiffer) Diff(tenantID uuid.UUID, endpoints []TenantEndpointInfo) []EndpointChange {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	previous := d.endpoints[tenantID]
+	d.endpoints[tenantID] = endpoints
+	return DiffEndpoints(previous, endpoints)
+}
+
+// Forget drops the endpoints remembered for tenantID.
+func (d *EndpointDiffer) Forget(tenantID uuid.UUID) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.endpoints, tenantID)
+}
+
+// WithEndpointDiffs makes [Client.ReceiveEvents] diff the endpoint list of
+// every ENDPOINTS_LIST_CHANGED event with the previous list of the tenant
+// remembered by differ, and call handler with the changes, if any, before
+// [EventHandlers.OnEndpointsListChanged]. The endpoints of a tenant are
+// forgotten when its authorization is revoked.
+//
+// Seed differ with the current endpoint lists on start, as all endpoints of
+// the first list of a tenant are reported as added otherwise. The option has
+// no effect if differ or handler is nil.
+func WithEndpointDiffs(differ *EndpointDiffer, handler EndpointDiffHandler) ReceiveOption {
+	return func(cfg *receiveConfig) {
+		if differ == nil || handler == nil {
+			return
+		}
+		cfg.endpointDiffer = differ
+		cfg.endpointDiffHandler = handler
+	}
+}
+
+// diffHandlers wraps the handlers of endpoint list changes and revoked
+// authorizations, so that the endpoint differ of cfg is kept up to date.
+func (cfg *receiveConfig) diffHandlers(handlers EventHandlers) EventHandlers {
+	if cfg.endpointDiffer == nil {
+		return handlers
+	}
+	wrapped := handlers
+	wrapped.OnEndpointsListChanged = func(ctx context.Context, event *EndpointsListChangedEventData) {
+		if changes := cfg.endpointDiffer.Diff(event.TenantId, event.Endpoints); len(changes) > 0 {
+			cfg.endpointDiffHandler(ctx, event.TenantId, changes)
+		}
+		if handlers.OnEndpointsListChanged != nil {
+			handlers.OnEndpointsListChanged(ctx, event)
+		}
+	}
+	wrapped.OnAuthorizationRevoked = func(ctx context.Context, event *AuthorizationRevokedEventData) {
+		cfg.endpointDiffer.Forget(event.TenantId)
+		if handlers.OnAuthorizationRevoked != nil {
+			handlers.OnAuthorizationRevoked(ctx, event)
+		}
+	}
+	return wrapped
+}
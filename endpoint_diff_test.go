@@ -0,0 +1,175 @@
+package agrirouter_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DKE-Data/agrirouter-sdk-go"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffEndpoints(t *testing.T) {
+	tenantID, peer := uuid.New(), uuid.New()
+	endpoint := func(id uuid.UUID, name string, canSend, canReceive []string, sendTo []string) agrirouter.TenantEndpointInfo {
+		routes := agrirouter.EndpointRouteMap{peer.String(): sendTo}
+		return agrirouter.TenantEndpointInfo{
+			Id:              id,
+			TenantId:        tenantID,
+			Name:            name,
+			Capabilities:    agrirouter.TenantEndpointCapabilities{CanSend: canSend, CanReceive: canReceive},
+			RoutedEndpoints: &agrirouter.RoutedEndpoints{CanSendTo: &routes},
+		}
+	}
+	kept, renamed, removed, added := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	previous := []agrirouter.TenantEndpointInfo{
+		endpoint(kept, "kept", []string{"gps:info", "img:png"}, []string{"iso:11783:-10:taskdata:zip"}, []string{"gps:info"}),
+		endpoint(renamed, "old", nil, nil, nil),
+		endpoint(removed, "removed", nil, nil, nil),
+	}
+	current := []agrirouter.TenantEndpointInfo{
+		endpoint(kept, "kept", []string{"gps:info", "img:jpeg"}, nil, []string{"img:jpeg"}),
+		endpoint(renamed, "new", nil, nil, nil),
+		endpoint(added, "added", nil, nil, nil),
+	}
+
+	changes := agrirouter.DiffEndpoints(previous, current)
+
+	require.Len(t, changes, 5)
+	assert.Equal(t, agrirouter.EndpointCapabilitiesChanged, changes[0].Kind)
+	assert.Equal(t, kept, changes[0].EndpointID)
+	assert.Equal(t, []string{"img:jpeg"}, changes[0].CanSendAdded)
+	assert.Equal(t, []string{"img:png"}, changes[0].CanSendRemoved)
+	assert.Nil(t, changes[0].CanReceiveAdded)
+	assert.Equal(t, []string{"iso:11783:-10:taskdata:zip"}, changes[0].CanReceiveRemoved)
+
+	assert.Equal(t, agrirouter.EndpointRoutesChanged, changes[1].Kind)
+	assert.Equal(t, []agrirouter.Route{{Direction: agrirouter.RouteSendTo, PeerID: peer, MessageType: "img:jpeg"}}, changes[1].RoutesGained)
+	assert.Equal(t, []agrirouter.Route{{Direction: agrirouter.RouteSendTo, PeerID: peer, MessageType: "gps:info"}}, changes[1].RoutesLost)
+
+	assert.Equal(t, agrirouter.EndpointRenamed, changes[2].Kind)
+	assert.Equal(t, "old", changes[2].Previous.Name)
+	assert.Equal(t, "new", changes[2].Current.Name)
+
+	assert.Equal(t, agrirouter.EndpointAdded, changes[3].Kind)
+	assert.Equal(t, added, changes[3].EndpointID)
+	assert.Nil(t, changes[3].Previous)
+
+	assert.Equal(t, agrirouter.EndpointRemoved, changes[4].Kind)
+	assert.Equal(t, removed, changes[4].EndpointID)
+	assert.Nil(t, changes[4].Current)
+
+	assert.Empty(t, agrirouter.DiffEndpoints(current, current))
+}
+
+func TestReceiveEvents_DiffsEndpointLists(t *testing.T) {
+	api := newFakeAPI(t)
+	tenantID, kept, added := uuid.New(), uuid.New(), uuid.New()
+	api.serveEvents(
+		map[string]any{
+			"event_type": "ENDPOINTS_LIST_CHANGED",
+			"tenant_id":  tenantID,
+			"endpoints":  []any{tenantEndpoint(tenantID, kept, "kept", true), tenantEndpoint(tenantID, added, "added", false)},
+		},
+		map[string]any{"event_type": "AUTHORIZATION_REVOKED", "scope": "endpoints:manage", "tenant_id": tenantID},
+		map[string]any{
+			"event_type": "ENDPOINTS_LIST_CHANGED",
+			"tenant_id":  tenantID,
+			"endpoints":  []any{tenantEndpoint(tenantID, kept, "kept", true)},
+		},
+	)
+	client := api.client()
+	differ := agrirouter.NewEndpointDiffer()
+	differ.Seed(tenantID, []agrirouter.TenantEndpointInfo{{
+		Id:                     kept,
+		TenantId:               tenantID,
+		Name:                   "endpoint kept",
+		EndpointType:           "cloud_software",
+		OwnedByYourApplication: true,
+	}})
+
+	var mu sync.Mutex
+	var diffs [][]agrirouter.EndpointChangeKind
+	var lists int
+	startReceiving(t, func(ctx context.Context, errorHandler func(err error)) error {
+		return client.ReceiveEvents(ctx, nil, agrirouter.EventHandlers{
+			OnEndpointsListChanged: func(context.Context, *agrirouter.EndpointsListChangedEventData) {
+				mu.Lock()
+				defer mu.Unlock()
+				lists++
+			},
+		}, errorHandler, agrirouter.WithEndpointDiffs(differ,
+			func(_ context.Context, changedTenant uuid.UUID, changes []agrirouter.EndpointChange) {
+				mu.Lock()
+				defer mu.Unlock()
+				assert.Equal(t, tenantID, changedTenant)
+				var kinds []agrirouter.EndpointChangeKind
+				for _, change := range changes {
+					kinds = append(kinds, change.Kind)
+				}
+				diffs = append(diffs, kinds)
+			}))
+	})
+
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(c, 2, lists)
+	}, 5*time.Second, 10*time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, [][]agrirouter.EndpointChangeKind{
+		{agrirouter.EndpointAdded},
+		{agrirouter.EndpointAdded},
+	}, diffs, "the list after the revocation is compared to no list")
+}
+
+func TestReceiveEvents_IgnoresEndpointDiffsWithoutHandler(t *testing.T) {
+	api := newFakeAPI(t)
+	tenantID := uuid.New()
+	api.serveEvents(map[string]any{
+		"event_type": "ENDPOINTS_LIST_CHANGED",
+		"tenant_id":  tenantID,
+		"endpoints":  []any{tenantEndpoint(tenantID, uuid.New(), "added", true)},
+	})
+	client := api.client()
+
+	lists := make(chan uuid.UUID, 1)
+	startReceiving(t, func(ctx context.Context, errorHandler func(err error)) error {
+		return client.ReceiveEvents(ctx, nil, agrirouter.EventHandlers{
+			OnEndpointsListChanged: func(_ context.Context, event *agrirouter.EndpointsListChangedEventData) {
+				lists <- event.TenantId
+			},
+		}, errorHandler, agrirouter.WithEndpointDiffs(agrirouter.NewEndpointDiffer(), nil))
+	})
+
+	select {
+	case changedTenant := <-lists:
+		assert.Equal(t, tenantID, changedTenant)
+	case <-time.After(5 * time.Second):
+		t.Fatal("endpoint list was not handled")
+	}
+}
+
+func TestTenantRegistry_ReportsEndpointChanges(t *testing.T) {
+	api := newFakeAPI(t)
+	tenantID, endpointID := uuid.New(), uuid.New()
+	serveTenants(t, api, map[uuid.UUID][]any{tenantID: {}})
+	registry := agrirouter.NewTenantRegistry(api.client())
+	require.NoError(t, registry.Sync(context.Background()))
+	var changes []*agrirouter.TenantChange
+	registry.Subscribe(func(_ context.Context, change *agrirouter.TenantChange) {
+		changes = append(changes, change)
+	})
+
+	serveTenants(t, api, map[uuid.UUID][]any{tenantID: {tenantEndpoint(tenantID, endpointID, "new", true)}})
+	require.NoError(t, registry.Sync(context.Background()))
+
+	require.Len(t, changes, 1)
+	require.Len(t, changes[0].EndpointChanges, 1)
+	assert.Equal(t, agrirouter.EndpointAdded, changes[0].EndpointChanges[0].Kind)
+	assert.Equal(t, endpointID, changes[0].EndpointChanges[0].EndpointID)
+}
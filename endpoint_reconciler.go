@@ -0,0 +1,292 @@
+package agrirouter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+const defaultReconcileConcurrency = 4
+
+var (
+	// ErrInvalidDesiredEndpoints is returned by [Client.PlanEndpoints] when
+	// desired endpoints lack an external ID or share one within a tenant.
+	ErrInvalidDesiredEndpoints = errors.New("invalid desired endpoints")
+
+	// ErrApplyEndpointPlanFailed is returned by [Client.ApplyEndpointPlan]
+	// when actions of the plan failed.
+	ErrApplyEndpointPlanFailed = errors.New("failed to apply endpoint plan")
+)
+
+// DesiredEndpoint is an endpoint that should exist in a tenant, see
+// [Client.ReconcileEndpoints].
+type DesiredEndpoint struct {
+	// ExternalID identifies the endpoint, see [Client.PutEndpoint].
+	ExternalID string
+	// Request is the complete configuration of the endpoint, as put when
+	// the endpoint is created or updated.
+	Request PutEndpointRequest
+}
+
+// EndpointActionKind tells what an [EndpointAction] does.
+type EndpointActionKind string
+
+const (
+	EndpointCreate EndpointActionKind = "create" // EndpointCreate puts an endpoint that does not exist
+	EndpointUpdate EndpointActionKind = "update" // EndpointUpdate puts an endpoint that differs from its desired configuration
+	EndpointDelete EndpointActionKind = "delete" // EndpointDelete deletes an owned endpoint that is not desired
+)
+
+// EndpointAction is a change to an endpoint planned by [Client.PlanEndpoints].
+type EndpointAction struct {
+	Kind       EndpointActionKind
+	TenantID   uuid.UUID
+	ExternalID string
+	// Desired is the desired endpoint, nil for [EndpointDelete].
+	Desired *DesiredEndpoint
+	// Current is the endpoint as listed, nil for [EndpointCreate].
+	Current *TenantEndpointInfo
+	// Differences name what differs for [EndpointUpdate], f.e "name" or
+	// "capabilities", or "forced" if [EndpointReconcileOptions.ForceUpdate]
+	// is set and nothing that is listed differs.
+	Differences []string
+}
+
+func (a *EndpointAction) String() string {
+	return fmt.Sprintf("%s endpoint %s in tenant %s", a.Kind, a.ExternalID, a.TenantID)
+}
+
+// EndpointPlan is the list of actions that make the endpoints of tenants
+// match the desired endpoints, see [Client.PlanEndpoints].
+type EndpointPlan struct {
+	// Actions are the actions to apply, ordered by tenant ID, with creates
+	// and updates in the order of the desired endpoints first, followed by
+	// deletes.
+	Actions []EndpointAction
+	// Protected are the deletes that are not applied, because
+	// [EndpointReconcileOptions.PruneProtection] is set.
+	Protected []EndpointAction
+}
+
+// IsEmpty reports whether the plan has no actions to apply.
+func (p *EndpointPlan) IsEmpty() bool {
+	return len(p.Actions) == 0
+}
+
+// EndpointReconcileOptions configure [Client.ReconcileEndpoints]. The zero
+// value is valid and uses the documented defaults.
+type EndpointReconcileOptions struct {
+	// Concurrency is the maximum number of actions applied at the same
+	// time, defaults to 4.
+	Concurrency int
+	// DryRun makes [Client.ReconcileEndpoints] only plan the actions
+	// without applying them.
+	DryRun bool
+	// PruneProtection keeps owned endpoints that are not desired instead of
+	// deleting them. They are listed in [EndpointPlan.Protected].
+	PruneProtection bool
+	// ForceUpdate puts every desired endpoint that already exists. Only the
+	// name, type and capabilities of endpoints are listed, so differences in
+	// subscriptions or flags are only applied when forced.
+	ForceUpdate bool
+}
+
+// ReconcileEndpoints makes the endpoints owned by the application in the
+// tenants of desired match the desired endpoints: it plans the actions with
+// [Client.PlanEndpoints] and applies them with [Client.ApplyEndpointPlan],
+// unless [EndpointReconcileOptions.DryRun] is set.
+//
+// The plan is returned also when applying it failed.
+func (c *Client) ReconcileEndpoints(
+	ctx context.Context,
+	desired map[uuid.UUID][]DesiredEndpoint,
+	opts EndpointReconcileOptions,
+) (*EndpointPlan, error) {
+	plan, err := c.PlanEndpoints(ctx, desired, opts)
+	if err != nil || opts.DryRun {
+		return plan, err
+	}
+	return plan, c.ApplyEndpointPlan(ctx, plan, opts)
+}
+
+// PlanEndpoints compares the desired endpoints of each tenant with the
+// endpoints owned by the application, as listed by
+// [Client.ListTenantEndpoints], matching them by external ID.
+//
+// Desired endpoints that do not exist are created, and those whose name, type
+// or capabilities differ are updated. Owned endpoints that are not desired are
+// deleted, so that a tenant with no desired endpoints has all owned endpoints
+// deleted. Tenants not in desired are left untouched. Names are only compared
+// when the desired endpoint sets one. Note that names set by users in the
+// agrirouter web interface take precedence and are listed instead, so their
+// endpoints are updated on every reconciliation.
+func (c *Client) PlanEndpoints(
+	ctx context.Context,
+	desired map[uuid.UUID][]DesiredEndpoint,
+	opts EndpointReconcileOptions,
+) (*EndpointPlan, error) {
+	tenantIDs := slices.SortedFunc(maps.Keys(desired), func(a, b uuid.UUID) int {
+		return bytes.Compare(a[:], b[:])
+	})
+	plan := &EndpointPlan{}
+	for _, tenantID := range tenantIDs {
+		if err := validateDesiredEndpoints(tenantID, desired[tenantID]); err != nil {
+			return nil, err
+		}
+		endpoints, err := c.ListTenantEndpoints(ctx, tenantID)
+		if err != nil {
+			return nil, err
+		}
+		planTenantEndpoints(plan, tenantID, desired[tenantID], endpoints, &opts)
+	}
+	return plan, nil
+}
+
+func validateDesiredEndpoints(tenantID uuid.UUID, desired []DesiredEndpoint) error {
+	seen := map[string]bool{}
+	for _, endpoint := range desired {
+		if endpoint.ExternalID == "" {
+			return fmt.Errorf("%w: endpoint without external ID in tenant %s", ErrInvalidDesiredEndpoints, tenantID)
+		}
+		if seen[endpoint.ExternalID] {
+			return fmt.Errorf("%w: external ID %s is desired twice in tenant %s",
+				ErrInvalidDesiredEndpoints, endpoint.ExternalID, tenantID)
+		}
+		seen[endpoint.ExternalID] = true
+	}
+	return nil
+}
+
+func planTenantEndpoints(
+	plan *EndpointPlan,
+	tenantID uuid.UUID,
+	desired []DesiredEndpoint,
+	endpoints []TenantEndpointInfo,
+	opts *EndpointReconcileOptions,
+) {
+	owned := map[string]*TenantEndpointInfo{}
+	for i := range endpoints {
+		// endpoints without external ID cannot be put or deleted
+		if endpoints[i].OwnedByYourApplication && endpoints[i].ExternalId != nil {
+			owned[*endpoints[i].ExternalId] = &endpoints[i]
+		}
+	}
+	for i := range desired {
+		action := EndpointAction{TenantID: tenantID, ExternalID: desired[i].ExternalID, Desired: &desired[i]}
+		current, ok := owned[desired[i].ExternalID]
+		if !ok {
+			action.Kind = EndpointCreate
+			plan.Actions = append(plan.Actions, action)
+			continue
+		}
+		action.Current = current
+		action.Differences = endpointDifferences(&desired[i].Request, current)
+		if len(action.Differences) == 0 && opts.ForceUpdate {
+			action.Differences = []string{"forced"}
+		}
+		if len(action.Differences) > 0 {
+			action.Kind = EndpointUpdate
+			plan.Actions = append(plan.Actions, action)
+		}
+	}
+	desiredIDs := make(map[string]bool, len(desired))
+	for _, endpoint := range desired {
+		desiredIDs[endpoint.ExternalID] = true
+	}
+	for i := range endpoints {
+		externalID := endpoints[i].ExternalId
+		if !endpoints[i].OwnedByYourApplication || externalID == nil || desiredIDs[*externalID] {
+			continue
+		}
+		action := EndpointAction{Kind: EndpointDelete, TenantID: tenantID, ExternalID: *externalID, Current: &endpoints[i]}
+		if opts.PruneProtection {
+			plan.Protected = append(plan.Protected, action)
+		} else {
+			plan.Actions = append(plan.Actions, action)
+		}
+	}
+}
+
+// endpointDifferences names the listed properties of current that differ
+// from desired.
+func endpointDifferences(desired *PutEndpointRequest, current *TenantEndpointInfo) []string {
+	var differences []string
+	if desired.Name != nil && *desired.Name != current.Name {
+		differences = append(differences, "name")
+	}
+	if desired.EndpointType != current.EndpointType {
+		differences = append(differences, "endpoint_type")
+	}
+	var canSend, canReceive []string
+	for _, capability := range desired.Capabilities {
+		if capability.Direction == CapabilityDirectionSend || capability.Direction == CapabilityDirectionSendReceive {
+			canSend = append(canSend, capability.MessageType)
+		}
+		if capability.Direction == CapabilityDirectionReceive || capability.Direction == CapabilityDirectionSendReceive {
+			canReceive = append(canReceive, capability.MessageType)
+		}
+	}
+	if missingFrom(canSend, current.Capabilities.CanSend) != nil ||
+		missingFrom(current.Capabilities.CanSend, canSend) != nil ||
+		missingFrom(canReceive, current.Capabilities.CanReceive) != nil ||
+		missingFrom(current.Capabilities.CanReceive, canReceive) != nil {
+		differences = append(differences, "capabilities")
+	}
+	return differences
+}
+
+// ApplyEndpointPlan applies the actions of plan with [Client.PutEndpoint] and
+// [Client.DeleteEndpoint], with at most [EndpointReconcileOptions.Concurrency]
+// actions at the same time.
+//
+// All actions are attempted, also when some of them fail. The errors of
+// failed actions are joined and wrapped with [ErrApplyEndpointPlanFailed].
+func (c *Client) ApplyEndpointPlan(ctx context.Context, plan *EndpointPlan, opts EndpointReconcileOptions) error {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = defaultReconcileConcurrency
+	}
+	actions := make(chan *EndpointAction)
+	var mu sync.Mutex
+	var errs []error
+	var wg sync.WaitGroup
+	for range min(opts.Concurrency, len(plan.Actions)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for action := range actions {
+				if err := c.applyEndpointAction(ctx, action); err != nil {
+					mu.Lock()
+					errs = append(errs, fmt.Errorf("%s: %w", action, err))
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for i := range plan.Actions {
+		actions <- &plan.Actions[i]
+	}
+	close(actions)
+	wg.Wait()
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %w", ErrApplyEndpointPlanFailed, errors.Join(errs...))
+}
+
+func (c *Client) applyEndpointAction(ctx context.Context, action *EndpointAction) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if action.Kind == EndpointDelete {
+		return c.DeleteEndpoint(ctx, action.ExternalID, &DeleteEndpointParams{XAgrirouterTenantId: action.TenantID})
+	}
+	_, err := c.PutEndpoint(ctx, action.ExternalID, &PutEndpointParams{XAgrirouterTenantId: action.TenantID}, &action.Desired.Request)
+	return err
+}
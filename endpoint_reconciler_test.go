@@ -0,0 +1,176 @@
+package agrirouter_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/DKE-Data/agrirouter-sdk-go"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// reconcileFixture is a tenant with the owned endpoints "kept", "renamed" and
+// "stale", an owned endpoint without external ID and an endpoint of another
+// application.
+type reconcileFixture struct {
+	tenantID uuid.UUID
+	desired  map[uuid.UUID][]agrirouter.DesiredEndpoint
+}
+
+func newReconcileFixture(t *testing.T, api *fakeAPI) *reconcileFixture {
+	t.Helper()
+	f := &reconcileFixture{tenantID: uuid.New()}
+	owned := func(externalID string, name string) map[string]any {
+		endpoint := tenantEndpoint(f.tenantID, uuid.New(), externalID, true)
+		endpoint["name"] = name
+		endpoint["capabilities"] = map[string]any{"can_send": []string{"gps:info"}, "can_receive": []string{"gps:info"}}
+		return endpoint
+	}
+	withoutExternalID := owned("", "anonymous")
+	delete(withoutExternalID, "external_id")
+	body, err := json.Marshal(map[string]any{"endpoints": []any{
+		owned("kept", "Kept"),
+		owned("renamed", "Old name"),
+		owned("stale", "Stale"),
+		withoutExternalID,
+		tenantEndpoint(f.tenantID, uuid.New(), "foreign", false),
+	}})
+	require.NoError(t, err)
+	api.respondJSON(http.MethodGet, "/tenants/"+f.tenantID.String()+"/endpoints", http.StatusOK, string(body))
+	for _, externalID := range []string{"kept", "renamed", "created"} {
+		api.respondJSON(http.MethodPut, "/endpoints/"+externalID, http.StatusOK, `{"external_id":"`+externalID+`"}`)
+	}
+	api.handle(http.MethodDelete, "/endpoints/stale", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	desired := func(externalID, name string) agrirouter.DesiredEndpoint {
+		return agrirouter.DesiredEndpoint{
+			ExternalID: externalID,
+			Request: agrirouter.PutEndpointRequest{
+				Name:         &name,
+				EndpointType: agrirouter.CloudSoftware,
+				Capabilities: []agrirouter.EndpointCapability{
+					{Direction: agrirouter.CapabilityDirectionSendReceive, MessageType: "gps:info"},
+				},
+				Subscriptions: []agrirouter.EndpointSubscription{{MessageType: "gps:info"}},
+			},
+		}
+	}
+	f.desired = map[uuid.UUID][]agrirouter.DesiredEndpoint{f.tenantID: {
+		desired("kept", "Kept"),
+		desired("renamed", "New name"),
+		desired("created", "Created"),
+	}}
+	return f
+}
+
+// endpointRequests returns the endpoints put or deleted on api as method and
+// path.
+func endpointRequests(api *fakeAPI) []string {
+	var requests []string
+	for _, request := range api.recorded() {
+		if request.Method == http.MethodPut || request.Method == http.MethodDelete {
+			requests = append(requests, request.Method+" "+request.Path)
+		}
+	}
+	return requests
+}
+
+// actionSummaries returns the kinds and external IDs of actions.
+func actionSummaries(actions []agrirouter.EndpointAction) []string {
+	var summaries []string
+	for _, action := range actions {
+		summaries = append(summaries, string(action.Kind)+" "+action.ExternalID)
+	}
+	return summaries
+}
+
+func TestReconcileEndpoints_DryRun(t *testing.T) {
+	api := newFakeAPI(t)
+	f := newReconcileFixture(t, api)
+
+	plan, err := api.client().ReconcileEndpoints(context.Background(), f.desired,
+		agrirouter.EndpointReconcileOptions{DryRun: true})
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"update renamed", "create created", "delete stale"}, actionSummaries(plan.Actions))
+	assert.Equal(t, []string{"name"}, plan.Actions[0].Differences)
+	assert.Equal(t, "Old name", plan.Actions[0].Current.Name)
+	assert.Empty(t, plan.Protected)
+	assert.Empty(t, endpointRequests(api), "dry runs change nothing")
+}
+
+func TestReconcileEndpoints_Applies(t *testing.T) {
+	api := newFakeAPI(t)
+	f := newReconcileFixture(t, api)
+
+	plan, err := api.client().ReconcileEndpoints(context.Background(), f.desired, agrirouter.EndpointReconcileOptions{})
+
+	require.NoError(t, err)
+	assert.Len(t, plan.Actions, 3)
+	assert.ElementsMatch(t, []string{
+		"PUT /endpoints/renamed",
+		"PUT /endpoints/created",
+		"DELETE /endpoints/stale",
+	}, endpointRequests(api))
+	for _, request := range api.recorded() {
+		if request.Method != http.MethodGet {
+			assert.Equal(t, f.tenantID.String(), request.Header.Get("X-Agrirouter-Tenant-Id"))
+		}
+	}
+}
+
+func TestReconcileEndpoints_PruneProtectionAndForcedUpdates(t *testing.T) {
+	api := newFakeAPI(t)
+	f := newReconcileFixture(t, api)
+
+	plan, err := api.client().ReconcileEndpoints(context.Background(), f.desired,
+		agrirouter.EndpointReconcileOptions{PruneProtection: true, ForceUpdate: true, Concurrency: 1})
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"update kept", "update renamed", "create created"}, actionSummaries(plan.Actions))
+	assert.Equal(t, []string{"forced"}, plan.Actions[0].Differences)
+	assert.Equal(t, []string{"delete stale"}, actionSummaries(plan.Protected))
+	assert.Equal(t, []string{
+		"PUT /endpoints/kept",
+		"PUT /endpoints/renamed",
+		"PUT /endpoints/created",
+	}, endpointRequests(api))
+}
+
+func TestReconcileEndpoints_AggregatesErrors(t *testing.T) {
+	api := newFakeAPI(t)
+	f := newReconcileFixture(t, api)
+	api.respondJSON(http.MethodPut, "/endpoints/created", http.StatusBadRequest, `{"message":"invalid capabilities"}`)
+	api.respondJSON(http.MethodDelete, "/endpoints/stale", http.StatusForbidden, `{"message":"not allowed"}`)
+
+	plan, err := api.client().ReconcileEndpoints(context.Background(), f.desired, agrirouter.EndpointReconcileOptions{})
+
+	require.ErrorIs(t, err, agrirouter.ErrApplyEndpointPlanFailed)
+	assert.ErrorIs(t, err, agrirouter.ErrDeleteEndpointFailed)
+	assert.ErrorContains(t, err, "create endpoint created in tenant "+f.tenantID.String())
+	assert.ErrorContains(t, err, "delete endpoint stale in tenant "+f.tenantID.String())
+	assert.NotContains(t, err.Error(), "renamed")
+	assert.Len(t, plan.Actions, 3)
+	assert.Len(t, endpointRequests(api), 3, "all actions are attempted")
+}
+
+func TestPlanEndpoints_RejectsInvalidDesiredEndpoints(t *testing.T) {
+	api := newFakeAPI(t)
+	tenantID := uuid.New()
+
+	_, err := api.client().PlanEndpoints(context.Background(), map[uuid.UUID][]agrirouter.DesiredEndpoint{
+		tenantID: {{ExternalID: "twice"}, {ExternalID: "twice"}},
+	}, agrirouter.EndpointReconcileOptions{})
+	assert.ErrorIs(t, err, agrirouter.ErrInvalidDesiredEndpoints)
+
+	_, err = api.client().PlanEndpoints(context.Background(), map[uuid.UUID][]agrirouter.DesiredEndpoint{
+		tenantID: {{}},
+	}, agrirouter.EndpointReconcileOptions{})
+	assert.ErrorIs(t, err, agrirouter.ErrInvalidDesiredEndpoints)
+	assert.Empty(t, api.recorded(), "endpoints are not listed for invalid desired endpoints")
+}
@@ -0,0 +1,181 @@
+package agrirouter
+
+import (
+	"context"
+	"slices"
+
+	"github.com/google/uuid"
+)
+
+// EventFilter selects the events [Client.ReceiveEvents] handles, see
+// [WithEventFilter]. Empty fields match everything, an event has to match all
+// fields that are set.
+//
+// TenantIDs also apply to ENDPOINTS_LIST_CHANGED, AUTHORIZATION_ADDED and
+// AUTHORIZATION_REVOKED events. All other fields only apply to messages and
+// files. ENDPOINT_DELETED events carry neither, they are always handled.
+type EventFilter struct {
+	// TenantIDs are the tenants whose events are handled.
+	TenantIDs []uuid.UUID
+	// EndpointIDs are the agrirouter IDs of the receiving endpoints whose
+	// messages and files are handled.
+	EndpointIDs []uuid.UUID
+	// ExternalIDs are the external IDs of the receiving endpoints whose
+	// messages and files are handled. They require ExternalIDResolver.
+	ExternalIDs []string
+	// ExternalIDResolver resolves the external IDs of receiving endpoints,
+	// see [NewExternalIDResolver].
+	ExternalIDResolver ExternalIDResolver
+	// MessageTypes are patterns of the message types handled, see
+	// [MessageRoute.MessageType].
+	MessageTypes []string
+	// Match is an additional predicate for messages and files, which are
+	// handled if it returns true.
+	Match func(ctx context.Context, event *FilteredEvent) bool
+	// ConfirmDropped makes messages and files not matching the filter be
+	// confirmed, so that agrirouter does not deliver them again. They are
+	// only confirmed if all filters they do not match set ConfirmDropped.
+	ConfirmDropped bool
+}
+
+// FilteredEvent describes a received message or file before its payload is
+// fetched, as passed to [EventFilter.Match].
+type FilteredEvent struct {
+	Type                EventType   // Type is either [EventTypeMessageReceived] or [EventTypeFileReceived]
+	MessageIDs          []uuid.UUID // MessageIDs are the agrirouter IDs of the message, or of the messages that carried a file
+	MessageType         string      // MessageType is the URN type of the message or file
+	ReceivingEndpointID uuid.UUID   // ReceivingEndpointID is the agrirouter ID of the receiving endpoint
+	TenantID            *string     // TenantID is the tenant to which the receiving endpoint belongs
+}
+
+// WithEventFilter makes [Client.ReceiveEvents] drop events not matching
+// filter. Messages and files are dropped before their payload is fetched, so
+// that payloads of unwanted messages are never downloaded. If the option is
+// given several times, events have to match all filters.
+//
+// Dropped messages and files are not confirmed, so that agrirouter delivers
+// them again, f.e on every reconnect, and they pile up in the feed of the
+// endpoint until they expire. Set [EventFilter.ConfirmDropped] to confirm
+// them, either directly or with the [ConfirmationBatcher] if one is
+// configured. Failures to confirm are reported as [ErrAutoConfirmFailed].
+//
+// Failures to resolve external IDs are reported to the error handler and the
+// message or file is dropped without being confirmed.
+func WithEventFilter(filter EventFilter) ReceiveOption {
+	return func(cfg *receiveConfig) {
+		cfg.filters = append(cfg.filters, filter)
+	}
+}
+
+// accepts reports whether event matches all filters of cfg and, if it does
+// not, whether it is to be confirmed, see [EventFilter.ConfirmDropped].
+func (cfg *receiveConfig) accepts(
+	ctx context.Context,
+	event *FilteredEvent,
+	errorHandler func(err error),
+) (accepted, confirm bool) {
+	accepted = true
+	for _, filter := range cfg.filters {
+		ok, err := filter.matches(ctx, event)
+		if err != nil {
+			errorHandler(err)
+			return false, false
+		}
+		if !ok {
+			if !filter.ConfirmDropped {
+				return false, false
+			}
+			accepted = false
+		}
+	}
+	return accepted, !accepted
+}
+
+// acceptEvent reports whether event matches all filters of cfg, and confirms
+// it with confirmations if it was dropped by filters that confirm dropped
+// events.
+func (c *Client) acceptEvent(
+	ctx context.Context,
+	cfg *receiveConfig,
+	event *FilteredEvent,
+	confirmations func() (*TenantConfirmations, error),
+	errorHandler func(err error),
+) bool {
+	accepted, confirm := cfg.accepts(ctx, event, errorHandler)
+	if confirm {
+		c.confirmProcessed(ctx, cfg, confirmations, errorHandler)
+	}
+	return accepted
+}
+
+// acceptsTenant reports whether events of tenantID match all filters of cfg.
+func (cfg *receiveConfig) acceptsTenant(tenantID uuid.UUID) bool {
+	for _, filter := range cfg.filters {
+		if len(filter.TenantIDs) > 0 && !slices.Contains(filter.TenantIDs, tenantID) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *EventFilter) matches(ctx context.Context, event *FilteredEvent) (bool, error) {
+	if len(f.TenantIDs) > 0 {
+		tenantID, err := parseTenantID(event.TenantID)
+		if err != nil || !slices.Contains(f.TenantIDs, tenantID) {
+			return false, nil
+		}
+	}
+	if len(f.EndpointIDs) > 0 && !slices.Contains(f.EndpointIDs, event.ReceivingEndpointID) {
+		return false, nil
+	}
+	if len(f.MessageTypes) > 0 && !slices.ContainsFunc(f.MessageTypes, func(pattern string) bool {
+		_, ok := messageTypeScore(pattern, event.MessageType)
+		return ok
+	}) {
+		return false, nil
+	}
+	if len(f.ExternalIDs) > 0 {
+		externalID, err := resolveExternalID(ctx, f.ExternalIDResolver, event.TenantID, event.ReceivingEndpointID)
+		if err != nil {
+			return false, err
+		}
+		if !slices.Contains(f.ExternalIDs, externalID) {
+			return false, nil
+		}
+	}
+	if f.Match != nil && !f.Match(ctx, event) {
+		return false, nil
+	}
+	return true, nil
+}
+
+// filterHandlers wraps the handlers of events that are not messages or files,
+// so that events of tenants not matching the filters of cfg are dropped.
+func (cfg *receiveConfig) filterHandlers(handlers EventHandlers) EventHandlers {
+	if len(cfg.filters) == 0 {
+		return handlers
+	}
+	filtered := handlers
+	if handlers.OnEndpointsListChanged != nil {
+		filtered.OnEndpointsListChanged = func(ctx context.Context, event *EndpointsListChangedEventData) {
+			if cfg.acceptsTenant(event.TenantId) {
+				handlers.OnEndpointsListChanged(ctx, event)
+			}
+		}
+	}
+	if handlers.OnAuthorizationAdded != nil {
+		filtered.OnAuthorizationAdded = func(ctx context.Context, event *AuthorizationAddedEventData) {
+			if cfg.acceptsTenant(event.Tenant.TenantId) {
+				handlers.OnAuthorizationAdded(ctx, event)
+			}
+		}
+	}
+	if handlers.OnAuthorizationRevoked != nil {
+		filtered.OnAuthorizationRevoked = func(ctx context.Context, event *AuthorizationRevokedEventData) {
+			if cfg.acceptsTenant(event.TenantId) {
+				handlers.OnAuthorizationRevoked(ctx, event)
+			}
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,158 @@
+package agrirouter_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DKE-Data/agrirouter-sdk-go"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// payloadRequests returns the number of payloads fetched from api.
+func payloadRequests(api *fakeAPI) int {
+	var n int
+	for _, request := range api.recorded() {
+		if strings.HasPrefix(request.Path, "/payloads/") {
+			n++
+		}
+	}
+	return n
+}
+
+func TestReceiveEvents_FiltersBeforeFetchingPayloads(t *testing.T) {
+	api := newFakeAPI(t)
+	tenantID, otherTenantID := uuid.New(), uuid.New()
+	endpointID, otherEndpointID := uuid.New(), uuid.New()
+	rejectedID := uuid.New()
+	otherType := messageEvent(tenantID, endpointID, uuid.New(), "other type")
+	otherType["message_type"] = "img:png"
+	api.serveEvents(
+		fileEvent(api, otherTenantID, endpointID, []uuid.UUID{uuid.New()}, "other tenant"),
+		fileEvent(api, tenantID, otherEndpointID, []uuid.UUID{uuid.New()}, "other endpoint"),
+		otherType,
+		messageEvent(tenantID, endpointID, rejectedID, "rejected by predicate"),
+		map[string]any{"event_type": "ENDPOINTS_LIST_CHANGED", "tenant_id": otherTenantID, "endpoints": []any{}},
+		map[string]any{"event_type": "ENDPOINTS_LIST_CHANGED", "tenant_id": tenantID, "endpoints": []any{}},
+		messageEvent(tenantID, endpointID, uuid.New(), "wanted"),
+	)
+	client := api.client()
+
+	var mu sync.Mutex
+	var handled []string
+	startReceiving(t, func(ctx context.Context, errorHandler func(err error)) error {
+		return client.ReceiveEvents(ctx, nil, agrirouter.EventHandlers{
+			OnMessage: func(_ context.Context, message *agrirouter.Message) {
+				mu.Lock()
+				defer mu.Unlock()
+				handled = append(handled, string(message.Payload))
+			},
+			OnFile: func(context.Context, *agrirouter.File) {
+				mu.Lock()
+				defer mu.Unlock()
+				handled = append(handled, "file")
+			},
+			OnEndpointsListChanged: func(_ context.Context, event *agrirouter.EndpointsListChangedEventData) {
+				mu.Lock()
+				defer mu.Unlock()
+				handled = append(handled, "list of "+event.TenantId.String())
+			},
+		}, errorHandler,
+			agrirouter.WithEventFilter(agrirouter.EventFilter{TenantIDs: []uuid.UUID{tenantID}}),
+			agrirouter.WithEventFilter(agrirouter.EventFilter{
+				EndpointIDs:  []uuid.UUID{endpointID},
+				MessageTypes: []string{"gps:*", "iso:11783:-10:*"},
+				Match: func(_ context.Context, event *agrirouter.FilteredEvent) bool {
+					return event.MessageIDs[0] != rejectedID
+				},
+			}),
+		)
+	})
+
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(c, []string{"list of " + tenantID.String(), "wanted"}, handled)
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Zero(t, payloadRequests(api))
+}
+
+func TestTenantClient_DoesNotFetchPayloadsOfOtherTenants(t *testing.T) {
+	api := newFakeAPI(t)
+	tenantID, endpointID := uuid.New(), uuid.New()
+	api.serveEvents(
+		fileEvent(api, uuid.New(), endpointID, []uuid.UUID{uuid.New()}, "other tenant"),
+		fileEvent(api, tenantID, endpointID, []uuid.UUID{uuid.New()}, "own tenant"),
+	)
+	tenantClient := api.client().Tenant(tenantID)
+
+	var mu sync.Mutex
+	var files int
+	startReceiving(t, func(ctx context.Context, errorHandler func(err error)) error {
+		return tenantClient.ReceiveEvents(ctx, nil, agrirouter.EventHandlers{
+			OnFile: func(context.Context, *agrirouter.File) {
+				mu.Lock()
+				defer mu.Unlock()
+				files++
+			},
+		}, errorHandler)
+	})
+
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(c, 1, files)
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, 1, payloadRequests(api))
+}
+
+func TestReceiveEvents_ConfirmsDroppedDeliveries(t *testing.T) {
+	api := newFakeAPI(t)
+	acceptConfirmations(api)
+	tenantID, endpointID := uuid.New(), uuid.New()
+	droppedMessage, fileMessages := uuid.New(), []uuid.UUID{uuid.New(), uuid.New()}
+	otherType := messageEvent(tenantID, endpointID, droppedMessage, "other type")
+	otherType["message_type"] = "img:png"
+	otherTenantType := messageEvent(uuid.New(), endpointID, uuid.New(), "other tenant")
+	otherTenantType["message_type"] = "img:png"
+	api.serveEvents(
+		otherType,
+		otherTenantType,
+		fileEvent(api, tenantID, endpointID, fileMessages, "other type"),
+		messageEvent(tenantID, endpointID, uuid.New(), "wanted"),
+	)
+	client := api.client()
+
+	handled := make(chan string, 4)
+	startReceiving(t, func(ctx context.Context, errorHandler func(err error)) error {
+		return client.ReceiveEvents(ctx, nil, agrirouter.EventHandlers{
+			OnMessage: func(_ context.Context, message *agrirouter.Message) {
+				handled <- string(message.Payload)
+			},
+			OnFile: func(context.Context, *agrirouter.File) { handled <- "file" },
+		}, errorHandler,
+			agrirouter.WithEventFilter(agrirouter.EventFilter{TenantIDs: []uuid.UUID{tenantID}}),
+			agrirouter.WithEventFilter(agrirouter.EventFilter{MessageTypes: []string{"gps:*"}, ConfirmDropped: true}),
+		)
+	})
+
+	select {
+	case payload := <-handled:
+		assert.Equal(t, "wanted", payload)
+	case <-time.After(5 * time.Second):
+		t.Fatal("message was not handled")
+	}
+	requests := confirmationRequests(api)
+	require.Len(t, requests, 2, "only deliveries dropped by filters confirming them are confirmed")
+	assert.Equal(t, []agrirouter.MessageConfirmation{{MessageId: droppedMessage, EndpointId: endpointID}},
+		decodeConfirmations(t, requests[0]))
+	assert.Equal(t, []agrirouter.MessageConfirmation{
+		{MessageId: fileMessages[0], EndpointId: endpointID},
+		{MessageId: fileMessages[1], EndpointId: endpointID},
+	}, decodeConfirmations(t, requests[1]))
+	assert.Zero(t, payloadRequests(api))
+}
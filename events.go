@@ -51,9 +51,15 @@ const (
 // itself filter on handler presence — events are filtered server-side via the
 // types argument. If a handler is nil for an event type that was requested,
 // matching events still arrive but are discarded.
+//
+// ProcessMessage and ProcessFile are alternatives to OnMessage and OnFile that
+// report whether processing succeeded, see [WithAutoConfirm]. When set, they
+// are used instead of OnMessage and OnFile respectively.
 type EventHandlers struct {
 	OnMessage              MessageHandler
 	OnFile                 func(ctx context.Context, file *File)
+	ProcessMessage         MessageProcessor
+	ProcessFile            FileProcessor
 	OnEndpointDeleted      EndpointDeletionHandler
 	OnEndpointsListChanged func(ctx context.Context, event *EndpointsListChangedEventData)
 	OnAuthorizationAdded   func(ctx context.Context, event *AuthorizationAddedEventData)
@@ -66,6 +72,8 @@ type EventHandlers struct {
 // types restricts which event types the server streams. If types is empty or
 // nil, the server streams all supported event types.
 //
+// opts configure how events are handled, f.e [WithAutoConfirm].
+//
 // This function blocks until the context is canceled or an error occurs.
 // It is recommended to run this function in a separate goroutine.
 func (c *Client) ReceiveEvents(
@@ -73,21 +81,38 @@ func (c *Client) ReceiveEvents(
 	types []EventType,
 	handlers EventHandlers,
 	errorHandler func(err error),
+	opts ...ReceiveOption,
 ) error {
+	cfg := newReceiveConfig(opts)
 	var typesParam *[]internal_models.ReceiveEventsParamsTypes
 	if len(types) > 0 {
 		t := append([]internal_models.ReceiveEventsParamsTypes(nil), types...)
 		typesParam = &t
 	}
-	return c.receiveAndHandleEvents(ctx, typesParam, func(event internal_models.GenericEventData) {
-		c.dispatchEvent(ctx, event, handlers, errorHandler)
-	}, errorHandler)
+	client := c.withRecorder(cfg, errorHandler)
+	handlers = cfg.filterHandlers(cfg.diffHandlers(handlers))
+	receive := func(ctx context.Context) error {
+		return c.receiveRawEvents(ctx, typesParam, func(raw sse.Event) {
+			cfg.record(raw, errorHandler)
+			var event internal_models.GenericEventData
+			if err := json.Unmarshal([]byte(raw.Data), &event); err != nil {
+				errorHandler(err)
+				return
+			}
+			client.dispatchEvent(ctx, event, handlers, cfg, errorHandler)
+		}, cfg.connected(ctx), errorHandler)
+	}
+	if cfg.leaderElection != nil {
+		return cfg.leaderElection.run(ctx, receive, errorHandler)
+	}
+	return receive(ctx)
 }
 
 func (c *Client) dispatchEvent(
 	ctx context.Context,
 	event internal_models.GenericEventData,
 	handlers EventHandlers,
+	cfg *receiveConfig,
 	errorHandler func(err error),
 ) {
 	discriminator, err := event.Discriminator()
@@ -97,9 +122,9 @@ func (c *Client) dispatchEvent(
 	}
 	switch EventType(discriminator) {
 	case EventTypeMessageReceived:
-		c.dispatchMessageReceived(ctx, event, handlers.OnMessage, errorHandler)
+		c.dispatchMessageReceived(ctx, event, handlers, cfg, errorHandler)
 	case EventTypeFileReceived:
-		c.dispatchFileReceived(ctx, event, handlers.OnFile, errorHandler)
+		c.dispatchFileReceived(ctx, event, handlers, cfg, errorHandler)
 	case EventTypeEndpointDeleted:
 		dispatchEndpointDeleted(ctx, event, handlers.OnEndpointDeleted, errorHandler)
 	case EventTypeEndpointsListChanged:
@@ -114,10 +139,11 @@ func (c *Client) dispatchEvent(
 func (c *Client) dispatchMessageReceived(
 	ctx context.Context,
 	event internal_models.GenericEventData,
-	handler MessageHandler,
+	handlers EventHandlers,
+	cfg *receiveConfig,
 	errorHandler func(err error),
 ) {
-	if handler == nil {
+	if handlers.OnMessage == nil && handlers.ProcessMessage == nil {
 		return
 	}
 	data, err := event.AsMessageReceivedEventData()
@@ -125,21 +151,47 @@ func (c *Client) dispatchMessageReceived(
 		errorHandler(err)
 		return
 	}
+	confirmations := (&Message{ID: data.Id, ReceivingEndpointID: data.ReceivingEndpointId, TenantID: data.TenantId}).Confirmation
+	if !c.acceptEvent(ctx, cfg, &FilteredEvent{
+		Type:                EventTypeMessageReceived,
+		MessageIDs:          []uuid.UUID{data.Id},
+		MessageType:         data.MessageType,
+		ReceivingEndpointID: data.ReceivingEndpointId,
+		TenantID:            data.TenantId,
+	}, confirmations, errorHandler) {
+		return
+	}
+	key := SeenKey{MessageID: data.Id, EndpointID: data.ReceivingEndpointId}
+	if cfg.seen(ctx, errorHandler, key) {
+		if cfg.autoConfirm && handlers.ProcessMessage != nil {
+			// redelivered although processed, so confirming it failed
+			c.confirmProcessed(ctx, cfg, confirmations, errorHandler)
+		}
+		return
+	}
 	message, err := c.messageFromEventData(ctx, &data, errorHandler)
 	if err != nil {
 		errorHandler(err)
 		return
 	}
-	handler(ctx, message)
+	if handlers.ProcessMessage != nil {
+		if c.processMessage(ctx, message, handlers.ProcessMessage, cfg, errorHandler) {
+			cfg.markSeen(ctx, errorHandler, key)
+		}
+		return
+	}
+	handlers.OnMessage(ctx, message)
+	cfg.markSeen(ctx, errorHandler, key)
 }
 
 func (c *Client) dispatchFileReceived(
 	ctx context.Context,
 	event internal_models.GenericEventData,
-	handler func(ctx context.Context, file *File),
+	handlers EventHandlers,
+	cfg *receiveConfig,
 	errorHandler func(err error),
 ) {
-	if handler == nil {
+	if handlers.OnFile == nil && handlers.ProcessFile == nil {
 		return
 	}
 	data, err := event.AsFileReceivedEventData()
@@ -147,12 +199,41 @@ func (c *Client) dispatchFileReceived(
 		errorHandler(err)
 		return
 	}
+	confirmations := (&File{
+		MessageIDs:          data.MessageIds,
+		ReceivingEndpointID: data.ReceivingEndpointId,
+		TenantID:            data.TenantId,
+	}).Confirmations
+	if !c.acceptEvent(ctx, cfg, &FilteredEvent{
+		Type:                EventTypeFileReceived,
+		MessageIDs:          data.MessageIds,
+		MessageType:         data.MessageType,
+		ReceivingEndpointID: data.ReceivingEndpointId,
+		TenantID:            data.TenantId,
+	}, confirmations, errorHandler) {
+		return
+	}
+	keys := fileSeenKeys(data.ReceivingEndpointId, data.MessageIds)
+	if cfg.seen(ctx, errorHandler, keys...) {
+		if cfg.autoConfirm && handlers.ProcessFile != nil {
+			// redelivered although processed, so confirming it failed
+			c.confirmProcessed(ctx, cfg, confirmations, errorHandler)
+		}
+		return
+	}
 	file, err := c.fileFromEventData(ctx, &data, errorHandler)
 	if err != nil {
 		errorHandler(err)
 		return
 	}
-	handler(ctx, file)
+	if handlers.ProcessFile != nil {
+		if c.processFile(ctx, file, handlers.ProcessFile, cfg, errorHandler) {
+			cfg.markSeen(ctx, errorHandler, keys...)
+		}
+		return
+	}
+	handlers.OnFile(ctx, file)
+	cfg.markSeen(ctx, errorHandler, keys...)
 }
 
 func dispatchEndpointDeleted(
@@ -481,6 +562,24 @@ func (c *Client) receiveAndHandleEvents(
 	receiveEventsTypes *[]internal_models.ReceiveEventsParamsTypes,
 	eventHandler func(event internal_models.GenericEventData),
 	errHandler func(err error),
+) error {
+	return c.receiveRawEvents(ctx, receiveEventsTypes, func(event sse.Event) {
+		var genericEvent internal_models.GenericEventData
+		jsonErr := json.Unmarshal([]byte(event.Data), &genericEvent)
+		if jsonErr != nil {
+			errHandler(jsonErr)
+			return
+		}
+		eventHandler(genericEvent)
+	}, nil, errHandler)
+}
+
+func (c *Client) receiveRawEvents(
+	ctx context.Context,
+	receiveEventsTypes *[]internal_models.ReceiveEventsParamsTypes,
+	eventHandler func(event sse.Event),
+	onConnect func() error,
+	errHandler func(err error),
 ) error {
 	req, err := oapi.NewReceiveEventsRequest(c.serverURL.String(), &internal_models.ReceiveEventsParams{
 		Types: receiveEventsTypes,
@@ -489,7 +588,8 @@ func (c *Client) receiveAndHandleEvents(
 		return fmt.Errorf("%w: %v", ErrAPICallFailed, err)
 	}
 	req = req.WithContext(ctx)
-	client := sse.DefaultClient
+	// copied, as the validator differs between connections
+	client := *sse.DefaultClient
 	client.ResponseValidator = func(r *http.Response) error {
 		err := sse.DefaultValidator(r)
 		if err != nil {
@@ -497,20 +597,16 @@ func (c *Client) receiveAndHandleEvents(
 			body, _ := io.ReadAll(r.Body)
 			return fmt.Errorf("%w: %v", err, string(body))
 		}
+		if onConnect != nil {
+			// events are read only once onConnect returned
+			return onConnect()
+		}
 		return nil
 	}
 	httpClient := c.oapiClient.ClientInterface.(*oapi.Client).Client
 	client.HTTPClient = httpClient.(*http.Client)
 	conn := client.NewConnection(req)
-	unsubscribe := conn.SubscribeToAll(func(event sse.Event) {
-		var genericEvent internal_models.GenericEventData
-		jsonErr := json.Unmarshal([]byte(event.Data), &genericEvent)
-		if jsonErr != nil {
-			errHandler(jsonErr)
-			return
-		}
-		eventHandler(genericEvent)
-	})
+	unsubscribe := conn.SubscribeToAll(eventHandler)
 	defer unsubscribe()
 	return conn.Connect()
 }
@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/DKE-Data/agrirouter-sdk-go"
+	"github.com/spf13/cobra"
+)
+
+const (
+	deadLettersDirOpt = "dead-letters-dir"
+	deadLetterIDOpt   = "id"
+	replayAllOpt      = "all"
+	confirmOpt        = "confirm"
+)
+
+var dlqCmd = &cobra.Command{
+	Use:   "dlq",
+	Short: "manages messages that failed to be processed",
+	Long: `Messages received by 'art receive-messages --dead-letters-dir <dir>' that
+could not be processed, f.e because their payload could not be saved, are
+kept in the dead letters directory together with their payload and error.
+They can be listed and replayed with the subcommands.`,
+}
+
+var dlqListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "lists messages that failed to be processed",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openDeadLetterStore(cmd)
+		if err != nil {
+			return err
+		}
+		letters, err := store.List(cmd.Context())
+		if err != nil {
+			return fmt.Errorf("failed to list dead letters: %w", err)
+		}
+
+		fmt.Printf("Dead letters (%d):\n", len(letters))
+		for _, letter := range letters {
+			fmt.Printf("- %s (%s)\n", letter.ID, letter.Kind)
+			fmt.Printf("  MessageIDs: %v\n", letter.MessageIDs)
+			fmt.Printf("  Type: %s\n", letter.MessageType)
+			fmt.Printf("  ReceivingEndpointID: %s\n", letter.ReceivingEndpointID)
+			fmt.Printf("  PayloadSize: %d bytes\n", letter.Size)
+			fmt.Printf("  FailedAt: %s\n", letter.FailedAt.Format("2006-01-02 15:04:05"))
+			fmt.Printf("  Error: %s\n", letter.Error)
+		}
+		return nil
+	},
+}
+
+var dlqReplayCmd = &cobra.Command{
+	Use:   "replay",
+	Short: "processes messages that failed to be processed again",
+	Long: `Processes dead-lettered messages again, by saving their payloads to
+--save-payloads-to. Messages processed successfully are removed from the dead
+letters directory and, with --confirm, confirmed with the agrirouter.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+
+		store, err := openDeadLetterStore(cmd)
+		if err != nil {
+			return err
+		}
+		ids, err := cmd.Flags().GetStringArray(deadLetterIDOpt)
+		if err != nil {
+			return fmt.Errorf("failed to get %s flag: %w", deadLetterIDOpt, err)
+		}
+		all, err := cmd.Flags().GetBool(replayAllOpt)
+		if err != nil {
+			return fmt.Errorf("failed to get %s flag: %w", replayAllOpt, err)
+		}
+		if all {
+			letters, err := store.List(ctx)
+			if err != nil {
+				return fmt.Errorf("failed to list dead letters: %w", err)
+			}
+			for _, letter := range letters {
+				ids = append(ids, letter.ID)
+			}
+		} else if len(ids) == 0 {
+			return fmt.Errorf("at least one --%s or --%s is required", deadLetterIDOpt, replayAllOpt)
+		}
+		savePayloadsTo, err := cmd.Flags().GetString("save-payloads-to")
+		if err != nil {
+			return fmt.Errorf("failed to get save-payloads-to flag: %w", err)
+		}
+		sink, err := newPayloadSink(savePayloadsTo)
+		if err != nil {
+			return err
+		}
+		confirm, err := cmd.Flags().GetBool(confirmOpt)
+		if err != nil {
+			return fmt.Errorf("failed to get %s flag: %w", confirmOpt, err)
+		}
+		var opts []agrirouter.ReceiveOption
+		if confirm {
+			opts = append(opts, agrirouter.WithAutoConfirm())
+		}
+
+		client, err := getClient(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to create agrirouter client: %w", err)
+		}
+
+		var errs []error
+		for _, id := range ids {
+			err := client.ReplayDeadLetter(ctx, store, id, agrirouter.EventHandlers{
+				ProcessMessage: processReceivedMessage(sink),
+			}, opts...)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to replay %s: %w", id, err))
+				continue
+			}
+			fmt.Printf("Replayed %s\n", id)
+		}
+		return errors.Join(errs...)
+	},
+}
+
+func openDeadLetterStore(cmd *cobra.Command) (*agrirouter.FileDeadLetterStore, error) {
+	dir, err := cmd.Flags().GetString(deadLettersDirOpt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s flag: %w", deadLettersDirOpt, err)
+	}
+	if dir == "" {
+		return nil, fmt.Errorf("--%s is required", deadLettersDirOpt)
+	}
+	store, err := agrirouter.NewFileDeadLetterStore(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dead letters directory: %w", err)
+	}
+	return store, nil
+}
+
+func init() {
+	rootCmd.AddCommand(dlqCmd)
+	dlqCmd.AddCommand(dlqListCmd, dlqReplayCmd)
+
+	dlqCmd.PersistentFlags().String(deadLettersDirOpt, "", "The directory dead letters are kept in")
+	dlqReplayCmd.Flags().StringArray(deadLetterIDOpt, nil, "ID of a dead letter to replay, can be repeated")
+	dlqReplayCmd.Flags().Bool(replayAllOpt, false, "Replay all dead letters")
+	dlqReplayCmd.Flags().String("save-payloads-to", "", "The directory to save payload files to (if empty, payloads are not saved to files)")
+	dlqReplayCmd.Flags().Bool(confirmOpt, false, "Confirm replayed messages with the agrirouter")
+}
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/DKE-Data/agrirouter-sdk-go"
+)
+
+const progressBarWidth = 30
+
+// newProgressBar returns a progress callback rendering a single line
+// progress bar to w, f.e:
+//
+//	[===========>                  ]  40%  12.0 MiB / 30.0 MiB  3.1 MiB/s
+func newProgressBar(w io.Writer) agrirouter.ProgressFunc {
+	return func(p agrirouter.Progress) {
+		throughput := formatBytes(int64(p.BytesPerSecond)) + "/s"
+		if fraction := p.Fraction(); fraction >= 0 {
+			filled := int(fraction * progressBarWidth)
+			bar := strings.Repeat("=", filled)
+			if filled < progressBarWidth {
+				bar += ">" + strings.Repeat(" ", progressBarWidth-filled-1)
+			}
+			fmt.Fprintf(w, "\r[%s] %3.0f%%  %s / %s  %s", bar, fraction*100,
+				formatBytes(p.Bytes), formatBytes(p.Total), throughput)
+		} else {
+			fmt.Fprintf(w, "\r%s  %s", formatBytes(p.Bytes), throughput)
+		}
+		if p.Done {
+			fmt.Fprintln(w)
+		}
+	}
+}
+
+// formatBytes formats n bytes using binary units.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
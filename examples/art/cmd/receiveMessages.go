@@ -3,7 +3,6 @@ package cmd
 import (
 	"context"
 	"fmt"
-	"os"
 
 	"github.com/DKE-Data/agrirouter-sdk-go"
 	"github.com/spf13/cobra"
@@ -21,11 +20,14 @@ var receiveMessagesCmd = &cobra.Command{
 			return fmt.Errorf("failed to get save-payloads-to flag: %w", err)
 		}
 
-		if savePayloadsTo != "" {
-			// Create the directory if it doesn't exist
-			if err := os.MkdirAll(savePayloadsTo, 0755); err != nil {
-				return fmt.Errorf("failed to create save-payloads-to directory: %w", err)
-			}
+		sink, err := newPayloadSink(savePayloadsTo)
+		if err != nil {
+			return err
+		}
+
+		deadLettersDir, err := cmd.Flags().GetString(deadLettersDirOpt)
+		if err != nil {
+			return fmt.Errorf("failed to get %s flag: %w", deadLettersDirOpt, err)
 		}
 
 		client, err := getClient(ctx)
@@ -33,23 +35,27 @@ var receiveMessagesCmd = &cobra.Command{
 			return fmt.Errorf("failed to create agrirouter client: %w", err)
 		}
 
-		err = client.ReceiveMessages(ctx, func(ctx context.Context, message *agrirouter.Message) {
-			fmt.Printf("Received message:\n")
-			fmt.Printf("  MessageID: %s\n", message.ID)
-			fmt.Printf("  AppMessageID: %s\n", message.AppMessageID)
-			fmt.Printf("  Type: %s\n", message.MessageType)
-			fmt.Printf("  ReceivingEndpointID: %s\n", message.ReceivingEndpointID)
-			if savePayloadsTo != "" {
-				filename := getFilename(message, savePayloadsTo)
-				if err := os.WriteFile(filename, message.Payload, 0644); err != nil {
-					fmt.Printf("  Failed to save payload to file: %v\n", err)
-				} else {
-					fmt.Printf("  Payload saved to file: %s\n", filename)
-				}
-			}
-		}, func(err error) {
+		processMessage := processReceivedMessage(sink)
+		errorHandler := func(err error) {
 			fmt.Printf("Error receiving messages: %v\n", err)
-		})
+		}
+		if deadLettersDir != "" {
+			store, err := agrirouter.NewFileDeadLetterStore(deadLettersDir)
+			if err != nil {
+				return fmt.Errorf("failed to open dead letters directory: %w", err)
+			}
+			err = client.ReceiveEvents(ctx, []agrirouter.EventType{agrirouter.EventTypeMessageReceived}, agrirouter.EventHandlers{
+				ProcessMessage: processMessage,
+			}, errorHandler, agrirouter.WithDeadLetters(store))
+			if err != nil {
+				return fmt.Errorf("failed to receive messages: %w", err)
+			}
+			return nil
+		}
+
+		err = client.ReceiveMessages(ctx, func(ctx context.Context, message *agrirouter.Message) {
+			_ = processMessage(ctx, message)
+		}, errorHandler)
 		if err != nil {
 			return fmt.Errorf("failed to receive messages: %w", err)
 		}
@@ -57,46 +63,45 @@ var receiveMessagesCmd = &cobra.Command{
 	},
 }
 
-func getFilename(message *agrirouter.Message, savePayloadsTo string) string {
-	extension := messageTypeToFileExtension(message.MessageType)
-	if extension == "" {
-		extension = ".bin"
+// newPayloadSink creates a sink saving payloads to savePayloadsTo, or returns
+// nil if it is empty.
+func newPayloadSink(savePayloadsTo string) (*agrirouter.DirectorySink, error) {
+	if savePayloadsTo == "" {
+		return nil, nil
+	}
+	sink, err := agrirouter.NewDirectorySink(savePayloadsTo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create save-payloads-to directory: %w", err)
 	}
-	return fmt.Sprintf("%s/%s%s", savePayloadsTo, message.AppMessageID, extension)
+	return sink, nil
 }
 
-func messageTypeToFileExtension(messageType string) string {
-	switch messageType {
-	case "iso:11783:-10:taskdata:zip":
-		return ".isobus.taskdata.zip"
-	case "iso:11783:-10:device_description:protobuf":
-		return ".isobus.devicedescription.pb"
-	case "iso:11783:-10:time_log:protobuf":
-		return ".isobus.timelog.pb"
-	case "gps:info":
-		return ".gps.info.pb"
-	case "img:bmp":
-		return ".bmp"
-	case "img:jpeg":
-		return ".jpeg"
-	case "img:png":
-		return ".png"
-	case "shp:shape:zip":
-		return ".shape.zip"
-	case "doc:pdf":
-		return ".pdf"
-	case "vid:avi":
-		return ".avi"
-	case "vid:mp4":
-		return ".mp4"
-	case "vid:wmv":
-		return ".wmv"
+// processReceivedMessage returns a processor printing received messages and
+// saving their payloads to sink, unless it is nil. It fails if the payload
+// cannot be saved.
+func processReceivedMessage(sink *agrirouter.DirectorySink) agrirouter.MessageProcessor {
+	return func(ctx context.Context, message *agrirouter.Message) error {
+		fmt.Printf("Received message:\n")
+		fmt.Printf("  MessageID: %s\n", message.ID)
+		fmt.Printf("  AppMessageID: %s\n", message.AppMessageID)
+		fmt.Printf("  Type: %s\n", message.MessageType)
+		fmt.Printf("  ReceivingEndpointID: %s\n", message.ReceivingEndpointID)
+		if sink == nil {
+			return nil
+		}
+		saved, err := sink.SaveMessage(ctx, message)
+		if err != nil {
+			fmt.Printf("  Failed to save payload to file: %v\n", err)
+			return fmt.Errorf("failed to save payload of message %s: %w", message.ID, err)
+		}
+		fmt.Printf("  Payload saved to file: %s\n", saved.Path)
+		return nil
 	}
-	return ""
 }
 
 func init() {
 	rootCmd.AddCommand(receiveMessagesCmd)
 
 	receiveMessagesCmd.Flags().String("save-payloads-to", "", "The directory to save payload files to (if empty, payloads are not saved to files)")
+	receiveMessagesCmd.Flags().String(deadLettersDirOpt, "", "The directory to keep messages that failed to be saved in, see 'art dlq' (if empty, failed messages are not kept)")
 }
@@ -36,6 +36,7 @@ var replAllowed = map[string]bool{
 	"lat":                                    true,
 	"list-tenant-endpoints":                  true,
 	"lte":                                    true,
+	"routes":                                 true,
 	"confirm-messages":                       true,
 	"help":                                   true,
 }
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	routesFormatOpt      = "format"
+	routesMessageTypeOpt = "message-type"
+)
+
+var routesCmd = &cobra.Command{
+	Use:   "routes",
+	Short: "renders the routes between endpoints of a tenant as graph",
+	Long: `Lists the endpoints of the tenant and renders them together with the
+routes reported for application-owned endpoints as Graphviz DOT or Mermaid
+flowchart, f.e to find out why a message did not arrive:
+
+  art routes -t <tenant> --message-type 'iso:11783:-10:*' | dot -Tsvg > routes.svg`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+
+		tenantID, err := uuidFlagOrEnv(cmd, tenantIDOpt, "ART_TENANT_ID")
+		if err != nil {
+			return err
+		}
+		format, err := cmd.Flags().GetString(routesFormatOpt)
+		if err != nil {
+			return fmt.Errorf("failed to get %s flag: %w", routesFormatOpt, err)
+		}
+		if format != "dot" && format != "mermaid" {
+			return fmt.Errorf("unsupported format '%s', use 'dot' or 'mermaid'", format)
+		}
+		messageTypes, err := cmd.Flags().GetStringArray(routesMessageTypeOpt)
+		if err != nil {
+			return fmt.Errorf("failed to get %s flag: %w", routesMessageTypeOpt, err)
+		}
+
+		client, err := getClient(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to create agrirouter client: %w", err)
+		}
+
+		graph, err := client.RoutingGraph(ctx, tenantID)
+		if err != nil {
+			return fmt.Errorf("failed to list tenant endpoints: %w", err)
+		}
+		graph = graph.Filter(messageTypes...)
+		if format == "mermaid" {
+			return graph.WriteMermaid(os.Stdout)
+		}
+		return graph.WriteDOT(os.Stdout)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(routesCmd)
+
+	routesCmd.Flags().StringP(tenantIDOpt, "t", "", "ID of the tenant to render routes of (default: $ART_TENANT_ID)")
+	routesCmd.Flags().String(routesFormatOpt, "dot", "Output format, either 'dot' or 'mermaid'")
+	routesCmd.Flags().StringArrayP(routesMessageTypeOpt, "m", []string{}, "Only render routes of message types matching this pattern, f.e 'gps:*', can be repeated")
+}
@@ -1,11 +1,8 @@
 package cmd
 
 import (
-	"bytes"
 	"fmt"
 	"os"
-	"path/filepath"
-	"time"
 
 	"github.com/DKE-Data/agrirouter-sdk-go"
 	"github.com/google/uuid"
@@ -27,20 +24,11 @@ var sendMessagesCmd = &cobra.Command{
 			return fmt.Errorf("from-file flag is required")
 		}
 
-		fileContent, err := os.ReadFile(fromFile)
-		if err != nil {
-			return fmt.Errorf("failed to read from specified file '%s': %w", fromFile, err)
-		}
-
 		messageType, err := cmd.Flags().GetString("message-type")
 		if err != nil {
 			return fmt.Errorf("failed to get message-type flag: %w", err)
 		}
 
-		if messageType == "" {
-			return fmt.Errorf("message-type flag is required")
-		}
-
 		endpointID, err := cmd.Flags().GetString("endpoint-id")
 		if err != nil {
 			return fmt.Errorf("failed to get endpoint-id flag: %w", err)
@@ -64,17 +52,13 @@ var sendMessagesCmd = &cobra.Command{
 		if err != nil {
 			return fmt.Errorf("failed to get direct-recipients flag: %w", err)
 		}
-		var directRecipientsParsed *[]uuid.UUID
-		if len(directRecipents) > 0 {
-			directRecipientsParsedTemp := make([]uuid.UUID, len(directRecipents))
-			for i, recipient := range directRecipents {
-				recipientParsed, err := uuid.Parse(recipient)
-				if err != nil {
-					return fmt.Errorf("failed to parse direct recipient '%s' as UUID: %w", recipient, err)
-				}
-				directRecipientsParsedTemp[i] = recipientParsed
+		directRecipientsParsed := make([]uuid.UUID, len(directRecipents))
+		for i, recipient := range directRecipents {
+			recipientParsed, err := uuid.Parse(recipient)
+			if err != nil {
+				return fmt.Errorf("failed to parse direct recipient '%s' as UUID: %w", recipient, err)
 			}
-			directRecipientsParsed = &directRecipientsParsedTemp
+			directRecipientsParsed[i] = recipientParsed
 		}
 
 		client, err := getClient(ctx)
@@ -82,32 +66,78 @@ var sendMessagesCmd = &cobra.Command{
 			return fmt.Errorf("failed to create agrirouter client: %w", err)
 		}
 
-		// get file name from path
-		filename := filepath.Base(fromFile)
+		opts := agrirouter.SendOptions{
+			TenantID:    tenantIDParsed,
+			EndpointID:  endpointIDParsed,
+			MessageType: messageType,
+		}.Publish().DirectTo(directRecipientsParsed...)
+
+		idempotent, err := cmd.Flags().GetBool("idempotent")
+		if err != nil {
+			return fmt.Errorf("failed to get idempotent flag: %w", err)
+		}
+		if idempotent {
+			businessKey, err := cmd.Flags().GetString("business-key")
+			if err != nil {
+				return fmt.Errorf("failed to get business-key flag: %w", err)
+			}
+			opts, err = withDerivedContextID(fromFile, opts, businessKey)
+			if err != nil {
+				return err
+			}
+		}
 
-		contextId := uuid.New().String()
-		fmt.Printf("Sending message with contextId %s\n", contextId)
+		noProgress, err := cmd.Flags().GetBool("no-progress")
+		if err != nil {
+			return fmt.Errorf("failed to get no-progress flag: %w", err)
+		}
+		if !noProgress {
+			opts.OnProgress = newProgressBar(os.Stderr)
+		}
 
-		err = client.SendMessages(ctx, &agrirouter.SendMessagesParams{
-			XAgrirouterIsPublish:        true,
-			ContentLength:               int64(len(fileContent)),
-			XAgrirouterSentTimestamp:    time.Now(),
-			XAgrirouterMessageType:      messageType,
-			XAgrirouterContextId:        contextId,
-			XAgrirouterEndpointId:       endpointIDParsed,
-			XAgrirouterTenantId:         tenantIDParsed,
-			XAgrirouterFilename:         &filename,
-			XAgrirouterDirectRecipients: directRecipientsParsed,
-		}, bytes.NewReader(fileContent))
+		receipt, err := client.SendFile(ctx, fromFile, opts)
 		if err != nil {
 			return fmt.Errorf("failed to send messages: %w", err)
 		}
 
+		fmt.Printf("Sent message with contextId %s\n", receipt.ContextID)
 		fmt.Println("Successfully sent message(s) to agrirouter")
 		return nil
 	},
 }
 
+// withDerivedContextID sets a context ID derived from the content of the file,
+// so that sending the same file again reuses the same context ID. The message
+// type is inferred first if not given, as it is part of the derivation.
+func withDerivedContextID(path string, opts agrirouter.SendOptions, businessKey string) (agrirouter.SendOptions, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return opts, fmt.Errorf("failed to open '%s': %w", path, err)
+	}
+	defer file.Close()
+
+	if opts.MessageType == "" {
+		info, err := file.Stat()
+		if err != nil {
+			return opts, fmt.Errorf("failed to stat '%s': %w", path, err)
+		}
+		opts.MessageType, err = agrirouter.DetectMessageType(path, file, info.Size())
+		if err != nil {
+			return opts, err
+		}
+	}
+
+	opts.ContextID, err = agrirouter.DeriveContextIDForPayload(file, agrirouter.ContextIDSource{
+		EndpointID:  opts.EndpointID,
+		MessageType: opts.MessageType,
+		BusinessKey: businessKey,
+	})
+	if err != nil {
+		return opts, fmt.Errorf("failed to derive context ID: %w", err)
+	}
+	return opts, nil
+}
+
 func init() {
 	rootCmd.AddCommand(sendMessagesCmd)
 
@@ -115,10 +145,14 @@ func init() {
 	sendMessagesCmd.MarkFlagRequired("from-file")
 	sendMessagesCmd.Flags().StringP("endpoint-id", "e", "", "ID of the endpoint to send the message from")
 	sendMessagesCmd.MarkFlagRequired("endpoint-id")
-	sendMessagesCmd.Flags().StringP("message-type", "m", "", "Type of the message to send")
-	sendMessagesCmd.MarkFlagRequired("message-type")
+	sendMessagesCmd.Flags().StringP("message-type", "m", "", "Type of the message to send (default: inferred from file name and content)")
 
 	sendMessagesCmd.Flags().StringP("tenant-id", "t", "", "ID of the tenant to send the message in (default: $ART_TENANT_ID)")
 
+	sendMessagesCmd.Flags().Bool("idempotent", false, "Derive the context ID from the file content, so that resending the same file reuses it")
+	sendMessagesCmd.Flags().String("business-key", "", "Optional key distinguishing identical payloads when using --idempotent")
+
 	sendMessagesCmd.Flags().StringArrayP("direct-recipients", "d", []string{}, "endpoint ids for direct recipients to send messages to")
+
+	sendMessagesCmd.Flags().Bool("no-progress", false, "Do not render a progress bar while uploading")
 }
@@ -0,0 +1,183 @@
+package agrirouter_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DKE-Data/agrirouter-sdk-go"
+	"github.com/stretchr/testify/require"
+)
+
+// recordedRequest is a request received by fakeAPI, with its body read.
+type recordedRequest struct {
+	Method string
+	Path   string
+	Header http.Header
+	// ContentLength is the declared length of the body, -1 if it was sent
+	// chunked.
+	ContentLength int64
+	Body          []byte
+}
+
+// fakeAPI is a lightweight stand-in for the agrirouter API used by unit tests
+// that do not need the full test container.
+//
+// Every request is recorded, and then answered by the handler registered for
+// "METHOD /path" or, if none matches, with the default status.
+type fakeAPI struct {
+	t      *testing.T
+	server *httptest.Server
+
+	mu            sync.Mutex
+	requests      []recordedRequest
+	handlers      map[string]http.HandlerFunc
+	defaultStatus int
+}
+
+func newFakeAPI(t *testing.T) *fakeAPI {
+	api := &fakeAPI{
+		t:             t,
+		handlers:      map[string]http.HandlerFunc{},
+		defaultStatus: http.StatusOK,
+	}
+	api.server = httptest.NewServer(http.HandlerFunc(api.serveHTTP))
+	t.Cleanup(api.server.Close)
+	return api
+}
+
+func (a *fakeAPI) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	a.mu.Lock()
+	a.requests = append(a.requests, recordedRequest{
+		Method:        r.Method,
+		Path:          r.URL.Path,
+		Header:        r.Header.Clone(),
+		ContentLength: r.ContentLength,
+		Body:          body,
+	})
+	handler, ok := a.handlers[r.Method+" "+r.URL.Path]
+	status := a.defaultStatus
+	a.mu.Unlock()
+
+	if ok {
+		handler(w, r)
+		return
+	}
+	w.WriteHeader(status)
+}
+
+// handle registers a handler for requests matching method and path exactly.
+func (a *fakeAPI) handle(method, path string, handler http.HandlerFunc) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.handlers[method+" "+path] = handler
+}
+
+// respondJSON registers a handler answering method and path with the given
+// status code and JSON body.
+func (a *fakeAPI) respondJSON(method, path string, status int, body string) {
+	a.handle(method, path, func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	})
+}
+
+// setDefaultStatus sets the status used for requests without a registered handler.
+func (a *fakeAPI) setDefaultStatus(status int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.defaultStatus = status
+}
+
+// recorded returns a copy of all requests received so far.
+func (a *fakeAPI) recorded() []recordedRequest {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]recordedRequest(nil), a.requests...)
+}
+
+// client returns an agrirouter client talking to this fake API.
+func (a *fakeAPI) client(opts ...agrirouter.ClientOption) *agrirouter.Client {
+	opts = append([]agrirouter.ClientOption{agrirouter.WithHTTPClient(a.server.Client())}, opts...)
+	client, err := agrirouter.NewClient(a.server.URL, opts...)
+	require.NoError(a.t, err)
+	return client
+}
+
+// url returns the absolute URL of path on this fake API.
+func (a *fakeAPI) url(path string) string {
+	return a.server.URL + path
+}
+
+// serveEvents registers a handler for the events stream that sends each of
+// events marshaled as JSON and keeps the stream open afterwards.
+func (a *fakeAPI) serveEvents(events ...any) {
+	a.handle(http.MethodGet, "/events", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		for _, event := range events {
+			data, err := json.Marshal(event)
+			require.NoError(a.t, err)
+			_, _ = fmt.Fprintf(w, "data: %s\n\n", data)
+		}
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	})
+}
+
+// eventsRun is a call of [agrirouter.Client.ReceiveEvents] running in the
+// background, collecting the reported errors.
+type eventsRun struct {
+	cancel context.CancelFunc
+	done   chan error
+	once   sync.Once
+
+	mu     sync.Mutex
+	errors []error
+}
+
+// startReceiving runs receive in the background until stop is called.
+// receive is passed the context and error handler to use.
+func startReceiving(t *testing.T, receive func(ctx context.Context, errorHandler func(err error)) error) *eventsRun {
+	ctx, cancel := context.WithCancel(context.Background())
+	run := &eventsRun{cancel: cancel, done: make(chan error, 1)}
+	go func() {
+		run.done <- receive(ctx, func(err error) {
+			run.mu.Lock()
+			defer run.mu.Unlock()
+			run.errors = append(run.errors, err)
+		})
+	}()
+	t.Cleanup(run.stop)
+	return run
+}
+
+// reported returns the errors reported so far.
+func (r *eventsRun) reported() []error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]error(nil), r.errors...)
+}
+
+// stop cancels receiving and waits for it to return.
+func (r *eventsRun) stop() {
+	r.once.Do(func() {
+		r.cancel()
+		select {
+		case <-r.done:
+		case <-time.After(5 * time.Second):
+		}
+	})
+}
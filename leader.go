@@ -0,0 +1,365 @@
+package agrirouter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultLeaseTTL = 15 * time.Second
+	// staleGuardAge is the age after which the guard file of a [FileLocker]
+	// is considered left behind by a crashed process.
+	staleGuardAge = 10 * time.Second
+)
+
+// ErrLockFailed is reported when a [Locker] fails, f.e because its file could
+// not be written.
+var ErrLockFailed = errors.New("lock failed")
+
+// Locker grants a lease to a single holder at a time, see
+// [WithLeaderElection].
+//
+// A lease expires after its TTL unless it is renewed by the holder, so that
+// another holder can take over when the holder stops. Implementations must be
+// safe for concurrent use. [MemoryLocker] and [FileLocker] are included
+// implementations.
+type Locker interface {
+	// TryLock acquires the lease for holder, or renews it if holder already
+	// holds it, so that it expires after ttl. It reports whether holder
+	// holds the lease.
+	TryLock(ctx context.Context, holder string, ttl time.Duration) (bool, error)
+	// Unlock releases the lease if it is held by holder.
+	Unlock(ctx context.Context, holder string) error
+}
+
+// LeaderElection configures [WithLeaderElection].
+type LeaderElection struct {
+	// Locker grants the lease all replicas compete for.
+	Locker Locker
+	// Holder identifies this replica, it defaults to the host name followed
+	// by a random suffix.
+	Holder string
+	// TTL is the time after which the lease expires if it is not renewed,
+	// it defaults to 15 seconds. Another replica takes over at most TTL
+	// after the holder stopped renewing.
+	TTL time.Duration
+	// RenewInterval is the interval in which the lease is renewed by the
+	// holder, and tried to be acquired by the other replicas. It defaults to
+	// a third of TTL, and has to be shorter than TTL minus SafetyMargin.
+	RenewInterval time.Duration
+	// SafetyMargin is the time before the lease expires at which the holder
+	// steps down if it could not renew the lease, it defaults to a fifth of
+	// TTL.
+	SafetyMargin time.Duration
+	// OnAcquired is called when the lease was acquired, before connecting
+	// to the events stream.
+	OnAcquired func(ctx context.Context)
+	// OnLost is called when the lease was lost, f.e because it could not be
+	// renewed in time, or released, after disconnecting from the events
+	// stream.
+	OnLost func(ctx context.Context)
+}
+
+// WithLeaderElection makes [Client.ReceiveEvents] only connect to the events
+// stream while holding the lease of election, so that only one of several
+// replicas sharing the same credentials consumes events at a time.
+//
+// Replicas not holding the lease wait and take over once the lease expires.
+// When the lease is lost, the holder disconnects and waits again. The lease is
+// released when [Client.ReceiveEvents] returns. Errors of the locker are
+// reported to the error handler.
+//
+// The holder steps down once its lease was not renewed for TTL minus
+// SafetyMargin, measured from the start of the last successful renewal, so
+// that it disconnected before another replica can acquire the lease. Two
+// replicas may still consume events at the same time if their clocks, or
+// those of the replica and the locker, drift apart by more than SafetyMargin,
+// or if handlers keep running for longer than SafetyMargin after the holder
+// stepped down.
+func WithLeaderElection(election LeaderElection) ReceiveOption {
+	return func(cfg *receiveConfig) {
+		cfg.leaderElection = &election
+	}
+}
+
+// errLeaseLost ends leading when the lease was lost.
+var errLeaseLost = errors.New("lease lost")
+
+// run calls receive whenever the lease of e was acquired, until ctx is
+// canceled or receive returns for another reason than the lease being lost.
+func (e *LeaderElection) run(
+	ctx context.Context,
+	receive func(ctx context.Context) error,
+	errorHandler func(err error),
+) error {
+	election := *e
+	if election.Holder == "" {
+		hostname, _ := os.Hostname()
+		election.Holder = hostname + "-" + uuid.NewString()[:8]
+	}
+	if election.TTL <= 0 {
+		election.TTL = defaultLeaseTTL
+	}
+	if election.RenewInterval <= 0 {
+		election.RenewInterval = election.TTL / 3
+	}
+	if election.SafetyMargin <= 0 {
+		election.SafetyMargin = election.TTL / 5
+	}
+	for {
+		acquired, ok := election.acquire(ctx, errorHandler)
+		if !ok {
+			return ctx.Err()
+		}
+		err := election.lead(ctx, acquired, receive, errorHandler)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !errors.Is(err, errLeaseLost) {
+			return err
+		}
+	}
+}
+
+// acquire waits until the lease was acquired and returns when the successful
+// attempt started, it returns false if ctx was canceled before.
+func (e *LeaderElection) acquire(ctx context.Context, errorHandler func(err error)) (time.Time, bool) {
+	for {
+		attempted := time.Now()
+		held, err := e.Locker.TryLock(ctx, e.Holder, e.TTL)
+		if err != nil {
+			errorHandler(err)
+		} else if held {
+			return attempted, true
+		}
+		if !sleep(ctx, e.RenewInterval) {
+			return time.Time{}, false
+		}
+	}
+}
+
+// lead calls receive while renewing the lease acquired at acquired, and
+// cancels it once the lease was lost or is about to expire. It returns
+// errLeaseLost in that case.
+func (e *LeaderElection) lead(
+	ctx context.Context,
+	acquired time.Time,
+	receive func(ctx context.Context) error,
+	errorHandler func(err error),
+) error {
+	leaderCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var lost bool
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		lost = !e.renew(leaderCtx, acquired, errorHandler)
+		cancel()
+	}()
+
+	if e.OnAcquired != nil {
+		e.OnAcquired(ctx)
+	}
+	err := receive(leaderCtx)
+	cancel()
+	wg.Wait()
+	if !lost {
+		if unlockErr := e.Locker.Unlock(context.WithoutCancel(ctx), e.Holder); unlockErr != nil {
+			errorHandler(unlockErr)
+		}
+	}
+	if e.OnLost != nil {
+		e.OnLost(ctx)
+	}
+	if lost {
+		return errLeaseLost
+	}
+	return err
+}
+
+// renew renews the lease acquired at acquired until ctx is canceled. It
+// returns false once the lease was lost, or could not be renewed until
+// SafetyMargin before it expires.
+func (e *LeaderElection) renew(ctx context.Context, acquired time.Time, errorHandler func(err error)) bool {
+	stepDown := acquired.Add(e.TTL - e.SafetyMargin)
+	deadline := time.NewTimer(time.Until(stepDown))
+	defer deadline.Stop()
+	ticker := time.NewTicker(e.RenewInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return true
+		case <-deadline.C:
+			return false
+		case <-ticker.C:
+		}
+		attempted := time.Now()
+		// renewing must not keep the holder leading past stepDown
+		renewCtx, cancel := context.WithDeadline(ctx, stepDown)
+		held, err := e.Locker.TryLock(renewCtx, e.Holder, e.TTL)
+		cancel()
+		switch {
+		case ctx.Err() != nil:
+			return true
+		case err != nil:
+			errorHandler(err)
+		case !held:
+			return false
+		default:
+			stepDown = attempted.Add(e.TTL - e.SafetyMargin)
+			deadline.Reset(time.Until(stepDown))
+		}
+	}
+}
+
+// MemoryLocker is a [Locker] coordinating consumers within a single process.
+type MemoryLocker struct {
+	mu        sync.Mutex
+	holder    string
+	expiresAt time.Time
+}
+
+var _ Locker = (*MemoryLocker)(nil)
+
+// NewMemoryLocker creates a [MemoryLocker] whose lease is not held.
+func NewMemoryLocker() *MemoryLocker {
+	return &MemoryLocker{}
+}
+
+// TryLock implements [Locker].
+func (l *MemoryLocker) TryLock(_ context.Context, holder string, ttl time.Duration) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	if l.holder != "" && l.holder != holder && now.Before(l.expiresAt) {
+		return false, nil
+	}
+	l.holder = holder
+	l.expiresAt = now.Add(ttl)
+	return true, nil
+}
+
+// Unlock implements [Locker].
+func (l *MemoryLocker) Unlock(_ context.Context, holder string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.holder == holder {
+		l.holder = ""
+	}
+	return nil
+}
+
+// FileLocker is a [Locker] keeping the lease in a file, so that replicas
+// sharing a volume can coordinate. The clocks of the replicas must be
+// synchronized, as lease expiry is compared to the local time.
+//
+// Updates of the lease file are guarded by a second file next to it, ending
+// in ".guard", which is created exclusively and removed afterwards.
+type FileLocker struct {
+	path string
+}
+
+var _ Locker = (*FileLocker)(nil)
+
+// fileLease is the content of the lease file of a [FileLocker].
+type fileLease struct {
+	Holder    string    `json:"holder"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// NewFileLocker creates a [FileLocker] keeping the lease in the file at path.
+// The directory of path must exist.
+func NewFileLocker(path string) *FileLocker {
+	return &FileLocker{path: path}
+}
+
+// TryLock implements [Locker].
+func (l *FileLocker) TryLock(ctx context.Context, holder string, ttl time.Duration) (bool, error) {
+	var held bool
+	err := l.guarded(ctx, func() error {
+		lease, err := l.read()
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		if lease.Holder != "" && lease.Holder != holder && now.Before(lease.ExpiresAt) {
+			return nil
+		}
+		held = true
+		return writeFileAtomically(l.path, func(w io.Writer) error {
+			return json.NewEncoder(w).Encode(&fileLease{Holder: holder, ExpiresAt: now.Add(ttl)})
+		})
+	})
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", ErrLockFailed, err)
+	}
+	return held, nil
+}
+
+// Unlock implements [Locker].
+func (l *FileLocker) Unlock(ctx context.Context, holder string) error {
+	err := l.guarded(ctx, func() error {
+		lease, err := l.read()
+		if err != nil || lease.Holder != holder {
+			return err
+		}
+		return os.Remove(l.path)
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrLockFailed, err)
+	}
+	return nil
+}
+
+// read returns the lease in the lease file, which is empty if there is none.
+func (l *FileLocker) read() (*fileLease, error) {
+	lease := &fileLease{}
+	data, err := os.ReadFile(l.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return lease, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, lease); err != nil {
+		return nil, err
+	}
+	return lease, nil
+}
+
+// guarded calls update while holding the guard file. Guard files older than
+// staleGuardAge are removed, as they were left behind by crashed processes.
+func (l *FileLocker) guarded(ctx context.Context, update func() error) error {
+	guard := l.path + ".guard"
+	for {
+		f, err := os.OpenFile(guard, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			defer os.Remove(guard)
+			if err := f.Close(); err != nil {
+				return err
+			}
+			return update()
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return err
+		}
+		if info, err := os.Stat(guard); err == nil && time.Since(info.ModTime()) > staleGuardAge {
+			_ = os.Remove(guard)
+			continue
+		}
+		if !sleep(ctx, 10*time.Millisecond) {
+			return ctx.Err()
+		}
+	}
+}
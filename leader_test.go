@@ -0,0 +1,227 @@
+package agrirouter_test
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DKE-Data/agrirouter-sdk-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// eventsConnections returns the number of connections made to the events
+// stream of api.
+func eventsConnections(api *fakeAPI) int {
+	var n int
+	for _, request := range api.recorded() {
+		if request.Method == http.MethodGet && request.Path == "/events" {
+			n++
+		}
+	}
+	return n
+}
+
+func TestLockers(t *testing.T) {
+	lockers := map[string]func(t *testing.T) (agrirouter.Locker, agrirouter.Locker){
+		"memory": func(*testing.T) (agrirouter.Locker, agrirouter.Locker) {
+			locker := agrirouter.NewMemoryLocker()
+			return locker, locker
+		},
+		"file": func(t *testing.T) (agrirouter.Locker, agrirouter.Locker) {
+			path := filepath.Join(t.TempDir(), "lease")
+			return agrirouter.NewFileLocker(path), agrirouter.NewFileLocker(path)
+		},
+	}
+	for name, newLockers := range lockers {
+		t.Run(name, func(t *testing.T) {
+			a, b := newLockers(t)
+			ctx := context.Background()
+
+			held, err := a.TryLock(ctx, "a", 100*time.Millisecond)
+			require.NoError(t, err)
+			assert.True(t, held)
+			held, err = b.TryLock(ctx, "b", time.Minute)
+			require.NoError(t, err)
+			assert.False(t, held, "the lease is held by a")
+			held, err = a.TryLock(ctx, "a", 100*time.Millisecond)
+			require.NoError(t, err)
+			assert.True(t, held, "the holder renews the lease")
+
+			time.Sleep(150 * time.Millisecond)
+			held, err = b.TryLock(ctx, "b", time.Minute)
+			require.NoError(t, err)
+			assert.True(t, held, "b takes over the expired lease")
+
+			require.NoError(t, a.Unlock(ctx, "a"))
+			held, err = a.TryLock(ctx, "a", time.Minute)
+			require.NoError(t, err)
+			assert.False(t, held, "only the holder releases the lease")
+
+			require.NoError(t, b.Unlock(ctx, "b"))
+			held, err = a.TryLock(ctx, "a", time.Minute)
+			require.NoError(t, err)
+			assert.True(t, held)
+		})
+	}
+}
+
+// transitions records the lease transitions of replicas.
+type transitions struct {
+	mu  sync.Mutex
+	log []string
+}
+
+func (tr *transitions) election(locker agrirouter.Locker, holder string) agrirouter.LeaderElection {
+	record := func(transition string) func(context.Context) {
+		return func(context.Context) {
+			tr.mu.Lock()
+			defer tr.mu.Unlock()
+			tr.log = append(tr.log, holder+" "+transition)
+		}
+	}
+	return agrirouter.LeaderElection{
+		Locker:        locker,
+		Holder:        holder,
+		TTL:           300 * time.Millisecond,
+		RenewInterval: 20 * time.Millisecond,
+		OnAcquired:    record("acquired"),
+		OnLost:        record("lost"),
+	}
+}
+
+func (tr *transitions) recorded() []string {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	return append([]string(nil), tr.log...)
+}
+
+func TestReceiveEvents_OnlyLeaderConsumes(t *testing.T) {
+	api := newFakeAPI(t)
+	api.serveEvents()
+	locker := agrirouter.NewMemoryLocker()
+	var tr transitions
+	replica := func(holder string) *eventsRun {
+		client := api.client()
+		return startReceiving(t, func(ctx context.Context, errorHandler func(err error)) error {
+			return client.ReceiveEvents(ctx, nil, agrirouter.EventHandlers{}, errorHandler,
+				agrirouter.WithLeaderElection(tr.election(locker, holder)))
+		})
+	}
+
+	a := replica("a")
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		assert.Equal(c, 1, eventsConnections(api))
+	}, 5*time.Second, 10*time.Millisecond)
+	b := replica("b")
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 1, eventsConnections(api), "b waits for the lease")
+
+	a.stop()
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		assert.Equal(c, 2, eventsConnections(api))
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"a acquired", "a lost", "b acquired"}, tr.recorded())
+	b.stop()
+	assert.Empty(t, a.reported())
+	assert.Empty(t, b.reported())
+}
+
+// revocableLocker is a locker whose lease can be denied to everyone.
+type revocableLocker struct {
+	agrirouter.Locker
+	denied atomic.Bool
+}
+
+func (l *revocableLocker) TryLock(ctx context.Context, holder string, ttl time.Duration) (bool, error) {
+	if l.denied.Load() {
+		return false, nil
+	}
+	return l.Locker.TryLock(ctx, holder, ttl)
+}
+
+func TestReceiveEvents_DisconnectsWhenLeaseIsLost(t *testing.T) {
+	api := newFakeAPI(t)
+	api.serveEvents()
+	client := api.client()
+	locker := &revocableLocker{Locker: agrirouter.NewMemoryLocker()}
+	var tr transitions
+	startReceiving(t, func(ctx context.Context, errorHandler func(err error)) error {
+		return client.ReceiveEvents(ctx, nil, agrirouter.EventHandlers{}, errorHandler,
+			agrirouter.WithLeaderElection(tr.election(locker, "a")))
+	})
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		assert.Equal(c, []string{"a acquired"}, tr.recorded())
+	}, 5*time.Second, 10*time.Millisecond)
+
+	locker.denied.Store(true)
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		assert.Equal(c, []string{"a acquired", "a lost"}, tr.recorded())
+	}, 5*time.Second, 10*time.Millisecond)
+
+	locker.denied.Store(false)
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		assert.Equal(c, []string{"a acquired", "a lost", "a acquired"}, tr.recorded())
+		assert.Equal(c, 2, eventsConnections(api))
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+// failingLocker is a locker that fails once failing is set, remembering when
+// the last successful attempt started.
+type failingLocker struct {
+	agrirouter.Locker
+	failing     atomic.Bool
+	mu          sync.Mutex
+	lastSuccess time.Time
+}
+
+func (l *failingLocker) TryLock(ctx context.Context, holder string, ttl time.Duration) (bool, error) {
+	if l.failing.Load() {
+		return false, agrirouter.ErrLockFailed
+	}
+	started := time.Now()
+	held, err := l.Locker.TryLock(ctx, holder, ttl)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lastSuccess = started
+	return held, err
+}
+
+func TestReceiveEvents_StepsDownBeforeLeaseExpires(t *testing.T) {
+	api := newFakeAPI(t)
+	api.serveEvents()
+	client := api.client()
+	locker := &failingLocker{Locker: agrirouter.NewMemoryLocker()}
+	const ttl = 300 * time.Millisecond
+	lost := make(chan time.Time, 1)
+	run := startReceiving(t, func(ctx context.Context, errorHandler func(err error)) error {
+		return client.ReceiveEvents(ctx, nil, agrirouter.EventHandlers{}, errorHandler,
+			agrirouter.WithLeaderElection(agrirouter.LeaderElection{
+				Locker:        locker,
+				Holder:        "a",
+				TTL:           ttl,
+				RenewInterval: 100 * time.Millisecond,
+				OnLost:        func(context.Context) { lost <- time.Now() },
+			}))
+	})
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		assert.Equal(c, 1, eventsConnections(api))
+	}, 5*time.Second, 10*time.Millisecond)
+
+	locker.failing.Store(true)
+	select {
+	case lostAt := <-lost:
+		locker.mu.Lock()
+		defer locker.mu.Unlock()
+		assert.True(t, lostAt.Before(locker.lastSuccess.Add(ttl)),
+			"stepped down %s after the last renewal", lostAt.Sub(locker.lastSuccess))
+	case <-time.After(5 * time.Second):
+		t.Fatal("lease was not given up")
+	}
+	require.NotEmpty(t, run.reported())
+	assert.ErrorIs(t, run.reported()[0], agrirouter.ErrLockFailed)
+}
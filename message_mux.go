@@ -0,0 +1,362 @@
+package agrirouter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrUnhandledMessageType is returned by [MessageMux] when no handler is
+	// registered for a received message or file and there is no fallback.
+	ErrUnhandledMessageType = errors.New("unhandled message type")
+
+	// ErrExternalIDResolutionFailed is returned by [MessageMux] when the
+	// external ID of the receiving endpoint could not be resolved.
+	ErrExternalIDResolutionFailed = errors.New("failed to resolve external ID of endpoint")
+)
+
+// MessageRoute selects the messages and files a handler registered with
+// [MessageMux] is responsible for. Empty fields match everything.
+type MessageRoute struct {
+	// MessageType is either an exact message type, f.e "iso:11783:-10:taskdata:zip",
+	// or a prefix followed by "*", f.e "iso:11783:-10:*". A single "*" or an
+	// empty value matches any type.
+	MessageType string
+	// EndpointID matches the agrirouter ID of the receiving endpoint.
+	EndpointID uuid.UUID
+	// ExternalID matches the external ID of the receiving endpoint, it requires
+	// an [ExternalIDResolver], see [WithExternalIDResolver].
+	ExternalID string
+}
+
+// ExternalIDResolver resolves the external ID of the endpoint identified by
+// endpointID in the tenant identified by tenantID.
+type ExternalIDResolver func(ctx context.Context, tenantID uuid.UUID, endpointID uuid.UUID) (string, error)
+
+// MessageMuxOption configures a [MessageMux].
+type MessageMuxOption func(*MessageMux)
+
+// WithExternalIDResolver sets the resolver used to match routes by
+// [MessageRoute.ExternalID]. See [NewExternalIDResolver] for a resolver
+// looking up endpoints with the client.
+func WithExternalIDResolver(resolver ExternalIDResolver) MessageMuxOption {
+	return func(m *MessageMux) {
+		m.resolver = resolver
+	}
+}
+
+// MessageMux dispatches received messages and files to handlers registered
+// by message type and receiving endpoint.
+//
+// When several routes match, the most specific one wins: routes matching the
+// receiving endpoint win over routes that do not, an exact message type wins
+// over a wildcard, and a longer wildcard prefix wins over a shorter one. Among
+// equally specific routes the one registered first wins.
+//
+// Messages and files without a matching handler are passed to the fallback,
+// if set, or fail with [ErrUnhandledMessageType]. Routes by external ID do
+// not match when the external ID of the receiving endpoint cannot be
+// resolved, f.e because the endpoint has none. If no other route matches and
+// there is no fallback, such messages and files fail with
+// [ErrExternalIDResolutionFailed].
+//
+// The mux is used with [Client.ReceiveEvents] by setting
+// [EventHandlers.ProcessMessage] to [MessageMux.ProcessMessage] and
+// [EventHandlers.ProcessFile] to [MessageMux.ProcessFile], or, when not
+// processing with confirmation, by setting [EventHandlers.OnMessage] and
+// [EventHandlers.OnFile] to the handlers returned by
+// [MessageMux.MessageHandler] and [MessageMux.FileHandler].
+type MessageMux struct {
+	resolver ExternalIDResolver
+	codecs   *CodecRegistry
+
+	mu              sync.RWMutex
+	messageRoutes   []messageMuxRoute[MessageProcessor]
+	fileRoutes      []messageMuxRoute[FileProcessor]
+	messageFallback MessageProcessor
+	fileFallback    FileProcessor
+}
+
+type messageMuxRoute[H any] struct {
+	route   MessageRoute
+	handler H
+}
+
+// NewMessageMux creates an empty [MessageMux].
+func NewMessageMux(opts ...MessageMuxOption) *MessageMux {
+	m := &MessageMux{codecs: NewCodecRegistry()}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Handle registers handler for messages matching route.
+func (m *MessageMux) Handle(route MessageRoute, handler MessageProcessor) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messageRoutes = append(m.messageRoutes, messageMuxRoute[MessageProcessor]{route: route, handler: handler})
+}
+
+// HandleType registers handler for messages matching the message type
+// pattern, see [MessageRoute.MessageType].
+func (m *MessageMux) HandleType(pattern string, handler MessageProcessor) {
+	m.Handle(MessageRoute{MessageType: pattern}, handler)
+}
+
+// HandleFile registers handler for files matching route.
+func (m *MessageMux) HandleFile(route MessageRoute, handler FileProcessor) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.fileRoutes = append(m.fileRoutes, messageMuxRoute[FileProcessor]{route: route, handler: handler})
+}
+
+// HandleFileType registers handler for files matching the message type
+// pattern, see [MessageRoute.MessageType].
+func (m *MessageMux) HandleFileType(pattern string, handler FileProcessor) {
+	m.HandleFile(MessageRoute{MessageType: pattern}, handler)
+}
+
+// Fallback sets the handler for messages no route matches.
+func (m *MessageMux) Fallback(handler MessageProcessor) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messageFallback = handler
+}
+
+// FallbackFile sets the handler for files no route matches.
+func (m *MessageMux) FallbackFile(handler FileProcessor) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.fileFallback = handler
+}
+
+// ProcessMessage passes message to the handler of the most specific matching
+// route and returns its error. It implements [MessageProcessor].
+func (m *MessageMux) ProcessMessage(ctx context.Context, message *Message) error {
+	m.mu.RLock()
+	routes, fallback := m.messageRoutes, m.messageFallback
+	m.mu.RUnlock()
+
+	handler, err := matchRoute(ctx, m, routes, message.MessageType, message.ReceivingEndpointID, message.TenantID)
+	if handler == nil {
+		handler = fallback
+	}
+	if handler == nil && err != nil {
+		return err
+	}
+	if handler == nil {
+		return fmt.Errorf("%w: %q received by endpoint %s",
+			ErrUnhandledMessageType, message.MessageType, message.ReceivingEndpointID)
+	}
+	return handler(ctx, message)
+}
+
+// ProcessFile passes file to the handler of the most specific matching route
+// and returns its error. It implements [FileProcessor].
+func (m *MessageMux) ProcessFile(ctx context.Context, file *File) error {
+	m.mu.RLock()
+	routes, fallback := m.fileRoutes, m.fileFallback
+	m.mu.RUnlock()
+
+	handler, err := matchRoute(ctx, m, routes, file.MessageType, file.ReceivingEndpointID, file.TenantID)
+	if handler == nil {
+		handler = fallback
+	}
+	if handler == nil && err != nil {
+		return err
+	}
+	if handler == nil {
+		return fmt.Errorf("%w: %q received by endpoint %s",
+			ErrUnhandledMessageType, file.MessageType, file.ReceivingEndpointID)
+	}
+	return handler(ctx, file)
+}
+
+// MessageHandler returns a [MessageHandler] passing messages to
+// [MessageMux.ProcessMessage] and errors to errorHandler, wrapped in
+// [MessageProcessingError].
+func (m *MessageMux) MessageHandler(errorHandler func(err error)) MessageHandler {
+	return func(ctx context.Context, message *Message) {
+		if err := m.ProcessMessage(ctx, message); err != nil {
+			errorHandler(&MessageProcessingError{Message: message, Err: err})
+		}
+	}
+}
+
+// FileHandler returns a handler for [EventHandlers.OnFile] passing files to
+// [MessageMux.ProcessFile] and errors to errorHandler, wrapped in
+// [MessageProcessingError].
+func (m *MessageMux) FileHandler(errorHandler func(err error)) func(ctx context.Context, file *File) {
+	return func(ctx context.Context, file *File) {
+		if err := m.ProcessFile(ctx, file); err != nil {
+			errorHandler(&MessageProcessingError{File: file, Err: err})
+		}
+	}
+}
+
+// matchRoute returns the handler of the most specific route matching, or nil if
+// none matches. Routes by external ID do not match if the external ID could
+// not be resolved, the error of the resolution is returned only if no route
+// matches.
+func matchRoute[H any](
+	ctx context.Context,
+	m *MessageMux,
+	routes []messageMuxRoute[H],
+	messageType string,
+	endpointID uuid.UUID,
+	tenantID *string,
+) (H, error) {
+	var best H
+	bestScore := -1
+	var externalID *string
+	var resolveErr error
+	for _, r := range routes {
+		score, ok := messageTypeScore(r.route.MessageType, messageType)
+		if !ok {
+			continue
+		}
+		if r.route.EndpointID != uuid.Nil {
+			if r.route.EndpointID != endpointID {
+				continue
+			}
+			score += endpointScore
+		}
+		if r.route.ExternalID != "" {
+			if externalID == nil && resolveErr == nil {
+				resolved, err := m.resolveExternalID(ctx, tenantID, endpointID)
+				if err != nil {
+					resolveErr = err
+				} else {
+					externalID = &resolved
+				}
+			}
+			if externalID == nil || r.route.ExternalID != *externalID {
+				continue
+			}
+			score += endpointScore
+		}
+		if score > bestScore {
+			best, bestScore = r.handler, score
+		}
+	}
+	if bestScore >= 0 {
+		return best, nil
+	}
+	return best, resolveErr
+}
+
+// endpointScore ranks routes matching the receiving endpoint above routes
+// matching by message type only, as message type scores stay below it.
+const endpointScore = 1 << 20
+
+// messageTypeScore reports whether pattern matches messageType and how
+// specific the match is.
+func messageTypeScore(pattern, messageType string) (int, bool) {
+	if pattern == "" || pattern == "*" {
+		return 0, true
+	}
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		if !strings.HasPrefix(messageType, prefix) {
+			return 0, false
+		}
+		return 1 + min(len(prefix), endpointScore/2-2), true
+	}
+	if pattern != messageType {
+		return 0, false
+	}
+	return endpointScore/2 - 1, true
+}
+
+func (m *MessageMux) resolveExternalID(ctx context.Context, tenantID *string, endpointID uuid.UUID) (string, error) {
+	return resolveExternalID(ctx, m.resolver, tenantID, endpointID)
+}
+
+func resolveExternalID(
+	ctx context.Context,
+	resolver ExternalIDResolver,
+	tenantID *string,
+	endpointID uuid.UUID,
+) (string, error) {
+	if resolver == nil {
+		return "", fmt.Errorf("%w: no resolver configured", ErrExternalIDResolutionFailed)
+	}
+	tenant, err := parseTenantID(tenantID)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrExternalIDResolutionFailed, err)
+	}
+	externalID, err := resolver(ctx, tenant, endpointID)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrExternalIDResolutionFailed, err)
+	}
+	return externalID, nil
+}
+
+// externalIDRelistInterval is the minimum time between two listings of the
+// endpoints of a tenant by [NewExternalIDResolver] for unknown endpoints.
+const externalIDRelistInterval = 30 * time.Second
+
+// NewExternalIDResolver returns an [ExternalIDResolver] looking up endpoints
+// of tenants with [Client.ListTenantEndpoints].
+//
+// Endpoints are cached per tenant, including those without external ID, as
+// external IDs are set when endpoints are created. The endpoints of a tenant
+// are listed again when an endpoint is not found in the cache, f.e because it
+// was created after the endpoints were listed, but at most every 30 seconds.
+// Tenants are resolved independently of each other.
+func NewExternalIDResolver(client *Client) ExternalIDResolver {
+	var mu sync.Mutex
+	tenants := map[uuid.UUID]*externalIDCache{}
+	return func(ctx context.Context, tenantID uuid.UUID, endpointID uuid.UUID) (string, error) {
+		mu.Lock()
+		cache, ok := tenants[tenantID]
+		if !ok {
+			cache = &externalIDCache{}
+			tenants[tenantID] = cache
+		}
+		mu.Unlock()
+		return cache.resolve(ctx, client, tenantID, endpointID)
+	}
+}
+
+// externalIDCache holds the external IDs of the endpoints of a tenant, empty
+// for endpoints without external ID.
+type externalIDCache struct {
+	mu          sync.Mutex
+	externalIDs map[uuid.UUID]string
+	listedAt    time.Time
+}
+
+func (c *externalIDCache) resolve(ctx context.Context, client *Client, tenantID, endpointID uuid.UUID) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	externalID, ok := c.externalIDs[endpointID]
+	if !ok && time.Since(c.listedAt) >= externalIDRelistInterval {
+		endpoints, err := client.ListTenantEndpoints(ctx, tenantID)
+		if err != nil {
+			return "", err
+		}
+		c.externalIDs = make(map[uuid.UUID]string, len(endpoints))
+		for _, endpoint := range endpoints {
+			c.externalIDs[endpoint.Id] = ""
+			if endpoint.ExternalId != nil {
+				c.externalIDs[endpoint.Id] = *endpoint.ExternalId
+			}
+		}
+		c.listedAt = time.Now()
+		externalID, ok = c.externalIDs[endpointID]
+	}
+	if !ok {
+		return "", fmt.Errorf("endpoint %s not found in tenant %s", endpointID, tenantID)
+	}
+	if externalID == "" {
+		return "", fmt.Errorf("endpoint %s has no external ID in tenant %s", endpointID, tenantID)
+	}
+	return externalID, nil
+}
@@ -0,0 +1,172 @@
+package agrirouter_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DKE-Data/agrirouter-sdk-go"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingProcessor returns a processor appending name to handled.
+func recordingProcessor(handled *[]string, name string) agrirouter.MessageProcessor {
+	return func(context.Context, *agrirouter.Message) error {
+		*handled = append(*handled, name)
+		return nil
+	}
+}
+
+func TestMessageMux_PicksMostSpecificRoute(t *testing.T) {
+	endpointID := uuid.New()
+	var handled []string
+	mux := agrirouter.NewMessageMux()
+	mux.HandleType("*", recordingProcessor(&handled, "any"))
+	mux.HandleType("iso:*", recordingProcessor(&handled, "iso"))
+	mux.HandleType("iso:11783:-10:*", recordingProcessor(&handled, "taskdata"))
+	mux.HandleType("iso:11783:-10:taskdata:zip", recordingProcessor(&handled, "exact"))
+	mux.Handle(agrirouter.MessageRoute{EndpointID: endpointID}, recordingProcessor(&handled, "endpoint"))
+	mux.HandleType("iso:*", recordingProcessor(&handled, "iso again"))
+
+	ctx := context.Background()
+	for _, message := range []*agrirouter.Message{
+		{MessageType: "iso:11783:-10:taskdata:zip"},
+		{MessageType: "iso:11783:-10:time_log:protobuf"},
+		{MessageType: "iso:11783:-1:other"},
+		{MessageType: "gps:info"},
+		{MessageType: "gps:info", ReceivingEndpointID: endpointID},
+	} {
+		require.NoError(t, mux.ProcessMessage(ctx, message))
+	}
+	assert.Equal(t, []string{"exact", "taskdata", "iso", "any", "endpoint"}, handled)
+}
+
+func TestMessageMux_FallbackAndUnhandledTypes(t *testing.T) {
+	ctx := context.Background()
+	mux := agrirouter.NewMessageMux()
+	mux.HandleType("gps:info", func(context.Context, *agrirouter.Message) error { return nil })
+
+	err := mux.ProcessMessage(ctx, &agrirouter.Message{MessageType: "img:png"})
+	require.ErrorIs(t, err, agrirouter.ErrUnhandledMessageType)
+	assert.Contains(t, err.Error(), "img:png")
+	require.ErrorIs(t, mux.ProcessFile(ctx, &agrirouter.File{MessageType: "img:png"}), agrirouter.ErrUnhandledMessageType)
+
+	var handled []string
+	mux.Fallback(recordingProcessor(&handled, "fallback"))
+	require.NoError(t, mux.ProcessMessage(ctx, &agrirouter.Message{MessageType: "img:png"}))
+	assert.Equal(t, []string{"fallback"}, handled)
+}
+
+func TestMessageMux_RoutesByExternalID(t *testing.T) {
+	api := newFakeAPI(t)
+	tenantID, endpointID := uuid.New(), uuid.New()
+	api.respondJSON(http.MethodGet, "/tenants/"+tenantID.String()+"/endpoints", http.StatusOK, `{"endpoints":[{
+		"id":"`+endpointID.String()+`","external_id":"urn:farm:tractor-1","name":"Tractor",
+		"application_id":"`+uuid.NewString()+`","endpoint_type":"cloud_software",
+		"owned_by_your_application":true,"tenant_id":"`+tenantID.String()+`","capabilities":{}}]}`)
+	var handled []string
+	mux := agrirouter.NewMessageMux(agrirouter.WithExternalIDResolver(agrirouter.NewExternalIDResolver(api.client())))
+	mux.HandleFile(agrirouter.MessageRoute{ExternalID: "urn:farm:tractor-1"}, func(context.Context, *agrirouter.File) error {
+		handled = append(handled, "tractor")
+		return nil
+	})
+	tenant := tenantID.String()
+
+	ctx := context.Background()
+	for range 2 {
+		require.NoError(t, mux.ProcessFile(ctx, &agrirouter.File{ReceivingEndpointID: endpointID, TenantID: &tenant}))
+	}
+	assert.Equal(t, []string{"tractor", "tractor"}, handled)
+	assert.Len(t, api.recorded(), 1, "endpoints are cached")
+
+	err := mux.ProcessFile(ctx, &agrirouter.File{ReceivingEndpointID: endpointID})
+	assert.ErrorIs(t, err, agrirouter.ErrExternalIDResolutionFailed)
+}
+
+func TestMessageMux_FallsBackWhenExternalIDCannotBeResolved(t *testing.T) {
+	resolveErr := errors.New("listing failed")
+	var handled []string
+	mux := agrirouter.NewMessageMux(agrirouter.WithExternalIDResolver(
+		func(context.Context, uuid.UUID, uuid.UUID) (string, error) { return "", resolveErr },
+	))
+	mux.Handle(agrirouter.MessageRoute{ExternalID: "urn:farm:tractor-1"}, recordingProcessor(&handled, "tractor"))
+	mux.HandleType("gps:info", recordingProcessor(&handled, "gps"))
+	tenant := uuid.NewString()
+	ctx := context.Background()
+
+	require.NoError(t, mux.ProcessMessage(ctx, &agrirouter.Message{MessageType: "gps:info", TenantID: &tenant}))
+	err := mux.ProcessMessage(ctx, &agrirouter.Message{MessageType: "img:png", TenantID: &tenant})
+	require.ErrorIs(t, err, agrirouter.ErrExternalIDResolutionFailed, "the failure is reported if nothing matches")
+	assert.ErrorIs(t, err, resolveErr)
+
+	mux.Fallback(recordingProcessor(&handled, "fallback"))
+	require.NoError(t, mux.ProcessMessage(ctx, &agrirouter.Message{MessageType: "img:png", TenantID: &tenant}))
+	assert.Equal(t, []string{"gps", "fallback"}, handled)
+}
+
+func TestNewExternalIDResolver_CachesEndpointsWithoutExternalID(t *testing.T) {
+	api := newFakeAPI(t)
+	tenantID, endpointID := uuid.New(), uuid.New()
+	endpoint := tenantEndpoint(tenantID, endpointID, "", true)
+	delete(endpoint, "external_id")
+	body, err := json.Marshal(map[string]any{"endpoints": []any{endpoint}})
+	require.NoError(t, err)
+	api.respondJSON(http.MethodGet, "/tenants/"+tenantID.String()+"/endpoints", http.StatusOK, string(body))
+	resolve := agrirouter.NewExternalIDResolver(api.client())
+
+	for _, id := range []uuid.UUID{endpointID, endpointID, uuid.New(), uuid.New()} {
+		_, err := resolve(context.Background(), tenantID, id)
+		assert.Error(t, err)
+	}
+	assert.Len(t, api.recorded(), 1, "endpoints are not listed again for every message")
+}
+
+func TestMessageMux_HandlesReceivedMessagesAndFiles(t *testing.T) {
+	api := newFakeAPI(t)
+	tenantID, endpointID := uuid.New(), uuid.New()
+	api.serveEvents(
+		messageEvent(tenantID, endpointID, uuid.New(), "position"),
+		fileEvent(api, tenantID, endpointID, []uuid.UUID{uuid.New()}, "taskdata"),
+	)
+	client := api.client()
+
+	var mu sync.Mutex
+	var handled []string
+	mux := agrirouter.NewMessageMux()
+	mux.HandleType("gps:info", func(_ context.Context, message *agrirouter.Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		handled = append(handled, string(message.Payload))
+		return errors.New("cannot store position")
+	})
+	mux.HandleFileType("iso:11783:-10:*", func(context.Context, *agrirouter.File) error {
+		mu.Lock()
+		defer mu.Unlock()
+		handled = append(handled, "file")
+		return nil
+	})
+
+	run := startReceiving(t, func(ctx context.Context, errorHandler func(err error)) error {
+		return client.ReceiveEvents(ctx, nil, agrirouter.EventHandlers{
+			OnMessage: mux.MessageHandler(errorHandler),
+			OnFile:    mux.FileHandler(errorHandler),
+		}, errorHandler)
+	})
+
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		mu.Lock()
+		defer mu.Unlock()
+		assert.ElementsMatch(c, []string{"position", "file"}, handled)
+		assert.Len(c, run.reported(), 1)
+	}, 5*time.Second, 10*time.Millisecond)
+	var processingError *agrirouter.MessageProcessingError
+	require.ErrorAs(t, run.reported()[0], &processingError)
+	assert.True(t, strings.HasPrefix(processingError.Message.MessageType, "gps:"))
+}
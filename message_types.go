@@ -0,0 +1,178 @@
+package agrirouter
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// Well known agrirouter message types, see
+// https://docs.agrirouter.com/agrirouter-interface-documentation/latest/tmt/overview.html
+// for the complete list.
+const (
+	MessageTypeTaskDataZip       = "iso:11783:-10:taskdata:zip"
+	MessageTypeDeviceDescription = "iso:11783:-10:device_description:protobuf"
+	MessageTypeTimeLog           = "iso:11783:-10:time_log:protobuf"
+	MessageTypeGPSInfo           = "gps:info"
+	MessageTypeShapeZip          = "shp:shape:zip"
+	MessageTypePDF               = "doc:pdf"
+	MessageTypeBMP               = "img:bmp"
+	MessageTypeJPEG              = "img:jpeg"
+	MessageTypePNG               = "img:png"
+	MessageTypeAVI               = "vid:avi"
+	MessageTypeMP4               = "vid:mp4"
+	MessageTypeWMV               = "vid:wmv"
+)
+
+// ErrUnknownMessageType is returned by [DetectMessageType] when neither the
+// content nor the file name allow to infer the message type.
+var ErrUnknownMessageType = errors.New("unable to infer message type")
+
+// messageTypeExtensions lists file extensions for message types. The first
+// extension of each entry is the canonical one, the others are only
+// recognized when inferring the message type from a file name.
+var messageTypeExtensions = []struct {
+	messageType string
+	extensions  []string
+}{
+	{MessageTypeTaskDataZip, []string{".isobus.taskdata.zip", ".taskdata.zip"}},
+	{MessageTypeDeviceDescription, []string{".isobus.devicedescription.pb"}},
+	{MessageTypeTimeLog, []string{".isobus.timelog.pb"}},
+	{MessageTypeGPSInfo, []string{".gps.info.pb"}},
+	{MessageTypeBMP, []string{".bmp"}},
+	{MessageTypeJPEG, []string{".jpeg", ".jpg"}},
+	{MessageTypePNG, []string{".png"}},
+	{MessageTypeShapeZip, []string{".shape.zip", ".shp.zip"}},
+	{MessageTypePDF, []string{".pdf"}},
+	{MessageTypeAVI, []string{".avi"}},
+	{MessageTypeMP4, []string{".mp4"}},
+	{MessageTypeWMV, []string{".wmv"}},
+}
+
+// FileExtensionForMessageType returns the canonical file extension, including
+// the leading dot, for payloads of the given message type. It returns an empty
+// string for message types without a known extension.
+func FileExtensionForMessageType(messageType string) string {
+	for _, e := range messageTypeExtensions {
+		if e.messageType == messageType {
+			return e.extensions[0]
+		}
+	}
+	return ""
+}
+
+// MessageTypeForFilename infers the message type from the extension of the
+// given file name. It is the reverse of [FileExtensionForMessageType] and
+// returns an empty string if the extension is not known.
+//
+// When several extensions match, f.e ".zip" files, the longest one wins.
+func MessageTypeForFilename(filename string) string {
+	lower := strings.ToLower(path.Base(filename))
+	messageType := ""
+	longest := 0
+	for _, e := range messageTypeExtensions {
+		for _, ext := range e.extensions {
+			if strings.HasSuffix(lower, ext) && len(ext) > longest {
+				messageType = e.messageType
+				longest = len(ext)
+			}
+		}
+	}
+	return messageType
+}
+
+// MessageTypeDetector infers the message type of a payload with the given
+// file name, content and size in bytes.
+type MessageTypeDetector func(filename string, content io.ReaderAt, size int64) (string, error)
+
+// sniffLength is the number of leading bytes inspected to detect the content type.
+const sniffLength = 512
+
+var (
+	magicPDF  = []byte("%PDF-")
+	magicPNG  = []byte("\x89PNG\r\n\x1a\n")
+	magicJPEG = []byte{0xFF, 0xD8, 0xFF}
+	magicBMP  = []byte("BM")
+	magicRIFF = []byte("RIFF")
+	magicAVI  = []byte("AVI ")
+	magicFtyp = []byte("ftyp")
+	magicASF  = []byte{0x30, 0x26, 0xB2, 0x75, 0x8E, 0x66, 0xCF, 0x11}
+	magicZip  = []byte("PK\x03\x04")
+)
+
+// DetectMessageType infers the message type of a payload from its content,
+// falling back to the extension of filename.
+//
+// PDF, PNG, JPEG, BMP, AVI, MP4 and WMV payloads are recognized by their
+// content. ZIP archives are inspected to tell ISOXML task data (containing a
+// TASKDATA.XML file) from shape files (containing a .shp file). For all other
+// payloads, f.e protobuf messages which cannot be recognized reliably, the
+// message type is inferred from filename using [MessageTypeForFilename].
+//
+// It returns [ErrUnknownMessageType] if the message type cannot be inferred.
+// DetectMessageType is a [MessageTypeDetector].
+func DetectMessageType(filename string, content io.ReaderAt, size int64) (string, error) {
+	head := make([]byte, min(size, sniffLength))
+	n, err := content.ReadAt(head, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("%w: %w", ErrUnknownMessageType, err)
+	}
+	head = head[:n]
+
+	if bytes.HasPrefix(head, magicZip) {
+		if messageType := zipMessageType(content, size); messageType != "" {
+			return messageType, nil
+		}
+	} else if messageType := sniffMessageType(head); messageType != "" {
+		return messageType, nil
+	}
+
+	if messageType := MessageTypeForFilename(filename); messageType != "" {
+		return messageType, nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrUnknownMessageType, path.Base(filename))
+}
+
+func sniffMessageType(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, magicPDF):
+		return MessageTypePDF
+	case bytes.HasPrefix(head, magicPNG):
+		return MessageTypePNG
+	case bytes.HasPrefix(head, magicJPEG):
+		return MessageTypeJPEG
+	case bytes.HasPrefix(head, magicASF):
+		return MessageTypeWMV
+	case bytes.HasPrefix(head, magicRIFF) && len(head) >= 12 && bytes.Equal(head[8:12], magicAVI):
+		return MessageTypeAVI
+	case len(head) >= 8 && bytes.Equal(head[4:8], magicFtyp):
+		return MessageTypeMP4
+	case bytes.HasPrefix(head, magicBMP) && len(head) >= 14:
+		// "BM" alone is too weak a signal, so also require a complete file header.
+		return MessageTypeBMP
+	}
+	return ""
+}
+
+// zipMessageType looks into a ZIP archive for the files identifying task data
+// and shape files.
+func zipMessageType(content io.ReaderAt, size int64) string {
+	archive, err := zip.NewReader(content, size)
+	if err != nil {
+		return ""
+	}
+	for _, f := range archive.File {
+		name := strings.ToUpper(path.Base(f.Name))
+		switch {
+		case name == "TASKDATA.XML":
+			return MessageTypeTaskDataZip
+		case strings.HasSuffix(name, ".SHP"):
+			return MessageTypeShapeZip
+		}
+	}
+	return ""
+}
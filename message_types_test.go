@@ -0,0 +1,84 @@
+package agrirouter_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/DKE-Data/agrirouter-sdk-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func zipWith(t *testing.T, names ...string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, name := range names {
+		f, err := w.Create(name)
+		require.NoError(t, err)
+		_, err = f.Write([]byte("content"))
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestDetectMessageType(t *testing.T) {
+	cases := []struct {
+		name     string
+		filename string
+		content  []byte
+		want     string
+	}{
+		{"taskdata zip by content", "export.zip", zipWith(t, "TASKDATA/TASKDATA.XML"), agrirouter.MessageTypeTaskDataZip},
+		{"shape zip by content", "fields.zip", zipWith(t, "fields.dbf", "fields.shp"), agrirouter.MessageTypeShapeZip},
+		{"unknown zip by extension", "x.shape.zip", zipWith(t, "readme.txt"), agrirouter.MessageTypeShapeZip},
+		{"pdf", "report", []byte("%PDF-1.7\n..."), agrirouter.MessageTypePDF},
+		{"png", "image.bin", []byte("\x89PNG\r\n\x1a\n\x00\x00"), agrirouter.MessageTypePNG},
+		{"jpeg", "photo", []byte{0xFF, 0xD8, 0xFF, 0xE0, 0x00}, agrirouter.MessageTypeJPEG},
+		{"bmp", "bitmap", append([]byte("BM"), make([]byte, 20)...), agrirouter.MessageTypeBMP},
+		{"avi", "clip", []byte("RIFF\x00\x00\x00\x00AVI LIST"), agrirouter.MessageTypeAVI},
+		{"mp4", "clip", []byte("\x00\x00\x00\x18ftypmp42"), agrirouter.MessageTypeMP4},
+		{"wmv", "clip", []byte{0x30, 0x26, 0xB2, 0x75, 0x8E, 0x66, 0xCF, 0x11, 0xA6}, agrirouter.MessageTypeWMV},
+		{"content wins over extension", "photo.png", []byte("%PDF-1.4"), agrirouter.MessageTypePDF},
+		{"protobuf by extension", "log.isobus.timelog.pb", []byte{0x0A, 0x02}, agrirouter.MessageTypeTimeLog},
+		{"extension is case insensitive", "PHOTO.JPG", []byte("plain"), agrirouter.MessageTypeJPEG},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := agrirouter.DetectMessageType(tc.filename, bytes.NewReader(tc.content), int64(len(tc.content)))
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestDetectMessageType_Unknown(t *testing.T) {
+	content := []byte("just some text")
+	_, err := agrirouter.DetectMessageType("notes.txt", bytes.NewReader(content), int64(len(content)))
+	assert.True(t, errors.Is(err, agrirouter.ErrUnknownMessageType), "unexpected error: %v", err)
+}
+
+func TestFileExtensionForMessageType_RoundTrips(t *testing.T) {
+	for _, messageType := range []string{
+		agrirouter.MessageTypeTaskDataZip,
+		agrirouter.MessageTypeDeviceDescription,
+		agrirouter.MessageTypeTimeLog,
+		agrirouter.MessageTypeGPSInfo,
+		agrirouter.MessageTypeShapeZip,
+		agrirouter.MessageTypePDF,
+		agrirouter.MessageTypeBMP,
+		agrirouter.MessageTypeJPEG,
+		agrirouter.MessageTypePNG,
+		agrirouter.MessageTypeAVI,
+		agrirouter.MessageTypeMP4,
+		agrirouter.MessageTypeWMV,
+	} {
+		ext := agrirouter.FileExtensionForMessageType(messageType)
+		require.NotEmpty(t, ext, messageType)
+		assert.Equal(t, messageType, agrirouter.MessageTypeForFilename("payload"+ext))
+	}
+	assert.Empty(t, agrirouter.FileExtensionForMessageType("unknown:type"))
+}
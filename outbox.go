@@ -0,0 +1,404 @@
+package agrirouter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultOutboxFlushInterval = 30 * time.Second
+	defaultOutboxMinBackoff    = time.Second
+	defaultOutboxMaxBackoff    = 5 * time.Minute
+)
+
+// ErrOutboxItemNotFound is returned by an [OutboxStore] when the requested
+// item does not exist.
+var ErrOutboxItemNotFound = errors.New("outbox item not found")
+
+// OutboxItem is a message waiting in an [Outbox] to be sent.
+type OutboxItem struct {
+	// ID identifies the item in the outbox.
+	ID string `json:"id"`
+	// Sequence orders items in the outbox, items of the same sending endpoint
+	// are sent in ascending sequence order.
+	Sequence int64 `json:"sequence"`
+	// Options are the options the message is sent with. The context ID is
+	// fixed when the item is enqueued and kept for all attempts.
+	Options SendOptions `json:"options"`
+	// EnqueuedAt is the time the item was added to the outbox.
+	EnqueuedAt time.Time `json:"enqueued_at"`
+	// Attempts is the number of failed attempts to send the item.
+	Attempts int `json:"attempts"`
+	// LastError describes the error of the last failed attempt, if any.
+	LastError string `json:"last_error,omitempty"`
+	// NextAttemptAt is the earliest time of the next attempt to send the item.
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+}
+
+// OutboxStore persists the items of an [Outbox] together with their payloads.
+//
+// Implementations must be safe for concurrent use. [FileOutboxStore] is an
+// implementation persisting items in a local directory.
+type OutboxStore interface {
+	// Add persists a new item together with its payload.
+	Add(ctx context.Context, item *OutboxItem, payload io.Reader) error
+	// Pending returns all items waiting to be sent, ordered by sequence.
+	Pending(ctx context.Context) ([]*OutboxItem, error)
+	// OpenPayload opens the payload of the item with the given ID.
+	OpenPayload(ctx context.Context, id string) (io.ReadCloser, error)
+	// Update persists changed metadata of a pending item.
+	Update(ctx context.Context, item *OutboxItem) error
+	// Remove deletes a pending item and its payload.
+	Remove(ctx context.Context, id string) error
+	// MoveToDeadLetters moves a pending item and its payload to the dead-letter
+	// area, where it is not sent anymore.
+	MoveToDeadLetters(ctx context.Context, item *OutboxItem) error
+	// DeadLetters returns all items in the dead-letter area.
+	DeadLetters(ctx context.Context) ([]*OutboxItem, error)
+}
+
+// Outbox durably queues outgoing messages and sends them once agrirouter is
+// reachable.
+//
+// Enqueued messages are persisted in an [OutboxStore] first, so that they
+// survive restarts. [Outbox.Flush] sends them in order per sending endpoint,
+// a failing message holds back later messages of the same endpoint, but not
+// those of other endpoints. Failed attempts are retried with exponential
+// backoff, keeping the context ID, so agrirouter can recognize resent
+// payloads. Messages rejected permanently, f.e with status 400 or 413, are
+// moved to the dead-letter area of the store.
+type Outbox struct {
+	client *Client
+	store  OutboxStore
+	cfg    outboxConfig
+
+	flushMu sync.Mutex
+	seqMu   sync.Mutex
+	lastSeq int64
+	wake    chan struct{}
+}
+
+type outboxConfig struct {
+	flushInterval time.Duration
+	minBackoff    time.Duration
+	maxBackoff    time.Duration
+	maxAttempts   int
+	isPermanent   func(err error) bool
+	onFailure     func(item *OutboxItem, err error)
+	onDeadLetter  func(item *OutboxItem, err error)
+	onSent        func(item *OutboxItem, receipt *SendReceipt)
+}
+
+// OutboxOption configures an [Outbox].
+type OutboxOption = func(*outboxConfig)
+
+// WithOutboxFlushInterval sets how often [Outbox.Run] tries to flush the
+// outbox when no new messages are enqueued. Defaults to 30 seconds.
+func WithOutboxFlushInterval(interval time.Duration) OutboxOption {
+	return func(c *outboxConfig) {
+		c.flushInterval = interval
+	}
+}
+
+// WithOutboxBackoff sets the delay before retrying a failed message. The
+// delay starts at minBackoff and doubles with every failed attempt, up to
+// maxBackoff. Defaults to 1 second and 5 minutes.
+func WithOutboxBackoff(minBackoff, maxBackoff time.Duration) OutboxOption {
+	return func(c *outboxConfig) {
+		c.minBackoff = minBackoff
+		c.maxBackoff = maxBackoff
+	}
+}
+
+// WithOutboxMaxAttempts sets after how many failed attempts a message is
+// moved to the dead-letter area. Zero, the default, retries transient
+// failures forever.
+func WithOutboxMaxAttempts(attempts int) OutboxOption {
+	return func(c *outboxConfig) {
+		c.maxAttempts = attempts
+	}
+}
+
+// WithOutboxPermanentErrorClassifier replaces the function deciding whether
+// a send error is permanent, so that the message is moved to the dead-letter
+// area without further attempts. See [IsPermanentSendError] for the default.
+func WithOutboxPermanentErrorClassifier(isPermanent func(err error) bool) OutboxOption {
+	return func(c *outboxConfig) {
+		c.isPermanent = isPermanent
+	}
+}
+
+// WithOutboxFailureHandler sets a callback invoked for every failed attempt
+// to send a message.
+func WithOutboxFailureHandler(handler func(item *OutboxItem, err error)) OutboxOption {
+	return func(c *outboxConfig) {
+		c.onFailure = handler
+	}
+}
+
+// WithOutboxDeadLetterHandler sets a callback invoked whenever a message is
+// moved to the dead-letter area, with the error of the last attempt.
+func WithOutboxDeadLetterHandler(handler func(item *OutboxItem, err error)) OutboxOption {
+	return func(c *outboxConfig) {
+		c.onDeadLetter = handler
+	}
+}
+
+// WithOutboxSentHandler sets a callback invoked for every message sent
+// successfully, with the receipt returned by [Client.Send].
+func WithOutboxSentHandler(handler func(item *OutboxItem, receipt *SendReceipt)) OutboxOption {
+	return func(c *outboxConfig) {
+		c.onSent = handler
+	}
+}
+
+// IsPermanentSendError reports whether err, as returned by [Client.Send],
+// indicates that sending the same message again cannot succeed.
+//
+// This is the case for invalid send options and for requests rejected by
+// agrirouter as invalid (status 400) or too large (status 413). Network
+// errors, authentication and server side errors are considered transient.
+func IsPermanentSendError(err error) bool {
+	if errors.Is(err, ErrInvalidSendOptions) {
+		return true
+	}
+	status, ok := APIStatusCode(err)
+	return ok && (status == http.StatusBadRequest || status == http.StatusRequestEntityTooLarge)
+}
+
+// NewOutbox creates an [Outbox] sending messages with client and persisting
+// them in store.
+func NewOutbox(client *Client, store OutboxStore, opts ...OutboxOption) *Outbox {
+	cfg := outboxConfig{
+		flushInterval: defaultOutboxFlushInterval,
+		minBackoff:    defaultOutboxMinBackoff,
+		maxBackoff:    defaultOutboxMaxBackoff,
+		isPermanent:   IsPermanentSendError,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return &Outbox{
+		client: client,
+		store:  store,
+		cfg:    cfg,
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// Enqueue persists a message to be sent by the outbox and returns the
+// created item.
+//
+// The context ID is generated now if not set in opts and the content length
+// is determined from body like [Client.Send] does. The message is sent by the
+// next flush, and [Outbox.Run] is woken up to flush immediately.
+func (o *Outbox) Enqueue(ctx context.Context, opts SendOptions, body io.Reader) (*OutboxItem, error) {
+	if opts.ContextID == "" {
+		opts.ContextID = uuid.NewString()
+	}
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	if opts.ContentLength <= 0 {
+		length, sized, cleanup, err := contentLength(body)
+		if err != nil {
+			return nil, err
+		}
+		defer cleanup()
+		opts.ContentLength = length
+		body = sized
+	}
+
+	now := time.Now()
+	item := &OutboxItem{
+		ID:            uuid.NewString(),
+		Sequence:      o.nextSequence(now),
+		Options:       opts,
+		EnqueuedAt:    now,
+		NextAttemptAt: now,
+	}
+	if err := o.store.Add(ctx, item, body); err != nil {
+		return nil, err
+	}
+
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+	return item, nil
+}
+
+// nextSequence returns a strictly increasing sequence number based on the
+// current time, so that order is kept across restarts.
+func (o *Outbox) nextSequence(now time.Time) int64 {
+	o.seqMu.Lock()
+	defer o.seqMu.Unlock()
+	seq := now.UnixNano()
+	if seq <= o.lastSeq {
+		seq = o.lastSeq + 1
+	}
+	o.lastSeq = seq
+	return seq
+}
+
+// QueueDepth returns the number of messages waiting to be sent.
+func (o *Outbox) QueueDepth(ctx context.Context) (int, error) {
+	pending, err := o.store.Pending(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return len(pending), nil
+}
+
+// Flush tries to send all pending messages that are due.
+//
+// Messages of the same sending endpoint are sent in order; once one of them
+// fails, the remaining ones of that endpoint wait for the next flush. The
+// returned error reports failures of the store only, failed send attempts are
+// reported to the handlers configured with [WithOutboxFailureHandler] and
+// [WithOutboxDeadLetterHandler].
+func (o *Outbox) Flush(ctx context.Context) error {
+	o.flushMu.Lock()
+	defer o.flushMu.Unlock()
+
+	pending, err := o.store.Pending(ctx)
+	if err != nil {
+		return err
+	}
+
+	blocked := map[uuid.UUID]bool{}
+	now := time.Now()
+	for _, item := range pending {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		endpointID := item.Options.EndpointID
+		if blocked[endpointID] {
+			continue
+		}
+		if item.NextAttemptAt.After(now) {
+			blocked[endpointID] = true
+			continue
+		}
+		sent, err := o.sendItem(ctx, item)
+		if err != nil {
+			return err
+		}
+		if !sent {
+			blocked[endpointID] = true
+		}
+	}
+	return nil
+}
+
+// sendItem makes one attempt to send item and updates the store accordingly.
+// It reports whether the item left the pending queue, and returns an error
+// only if the store failed.
+func (o *Outbox) sendItem(ctx context.Context, item *OutboxItem) (bool, error) {
+	payload, err := o.store.OpenPayload(ctx, item.ID)
+	if err != nil {
+		return false, err
+	}
+	receipt, sendErr := o.client.Send(ctx, item.Options, payload)
+	_ = payload.Close()
+
+	if sendErr == nil {
+		if err := o.store.Remove(ctx, item.ID); err != nil {
+			return false, err
+		}
+		if o.cfg.onSent != nil {
+			o.cfg.onSent(item, receipt)
+		}
+		return true, nil
+	}
+	if ctx.Err() != nil {
+		// canceled while sending, this is not the fault of the message
+		return false, ctx.Err()
+	}
+
+	item.Attempts++
+	item.LastError = sendErr.Error()
+	if o.cfg.onFailure != nil {
+		o.cfg.onFailure(item, sendErr)
+	}
+
+	if o.cfg.isPermanent(sendErr) || (o.cfg.maxAttempts > 0 && item.Attempts >= o.cfg.maxAttempts) {
+		if err := o.store.MoveToDeadLetters(ctx, item); err != nil {
+			return false, err
+		}
+		if o.cfg.onDeadLetter != nil {
+			o.cfg.onDeadLetter(item, sendErr)
+		}
+		return true, nil
+	}
+
+	item.NextAttemptAt = time.Now().Add(exponentialBackoff(item.Attempts, o.cfg.minBackoff, o.cfg.maxBackoff))
+	if err := o.store.Update(ctx, item); err != nil {
+		return false, err
+	}
+	return false, nil
+}
+
+// exponentialBackoff returns the delay before the next attempt after the
+// given number of failed attempts, doubling minBackoff up to maxBackoff.
+func exponentialBackoff(attempts int, minBackoff, maxBackoff time.Duration) time.Duration {
+	delay := minBackoff
+	for i := 1; i < attempts && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, maxBackoff)
+}
+
+// Run flushes the outbox whenever messages are enqueued, when retries become
+// due and otherwise periodically, until ctx is canceled.
+//
+// Errors of the store are passed to errorHandler, which may be nil.
+// This function blocks until the context is canceled.
+// It is recommended to run this function in a separate goroutine.
+func (o *Outbox) Run(ctx context.Context, errorHandler func(err error)) error {
+	for {
+		if err := o.Flush(ctx); err != nil && ctx.Err() == nil && errorHandler != nil {
+			errorHandler(fmt.Errorf("failed to flush outbox: %w", err))
+		}
+
+		timer := time.NewTimer(o.nextFlushDelay(ctx))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-o.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// nextFlushDelay returns the time until the next item that could be sent
+// becomes due, but at most the flush interval.
+func (o *Outbox) nextFlushDelay(ctx context.Context) time.Duration {
+	delay := o.cfg.flushInterval
+	pending, err := o.store.Pending(ctx)
+	if err != nil {
+		return delay
+	}
+	now := time.Now()
+	seen := map[uuid.UUID]bool{}
+	for _, item := range pending {
+		// only the first item of each endpoint can be sent next
+		if seen[item.Options.EndpointID] {
+			continue
+		}
+		seen[item.Options.EndpointID] = true
+		if until := item.NextAttemptAt.Sub(now); until < delay {
+			delay = max(until, 0)
+		}
+	}
+	return delay
+}
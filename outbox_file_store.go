@@ -0,0 +1,217 @@
+package agrirouter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	outboxPendingDir     = "pending"
+	outboxDeadLettersDir = "dead-letters"
+	outboxItemSuffix     = ".json"
+	outboxPayloadSuffix  = ".payload"
+	outboxDirPerm        = 0o750
+)
+
+// ErrOutboxStoreFailed is returned by [FileOutboxStore] when accessing the
+// file system fails.
+var ErrOutboxStoreFailed = errors.New("outbox store failed")
+
+// FileOutboxStore is an [OutboxStore] persisting items in a directory.
+//
+// Every item is stored as a JSON metadata file next to a file holding its
+// payload. Pending items live in the "pending" sub-directory, dead-lettered
+// ones in "dead-letters". Metadata is written atomically, so that a crash
+// never leaves a partially written item behind.
+type FileOutboxStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+var _ OutboxStore = (*FileOutboxStore)(nil)
+
+// NewFileOutboxStore creates a [FileOutboxStore] persisting items in dir,
+// which is created if it does not exist yet.
+func NewFileOutboxStore(dir string) (*FileOutboxStore, error) {
+	for _, sub := range []string{outboxPendingDir, outboxDeadLettersDir} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), outboxDirPerm); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrOutboxStoreFailed, err)
+		}
+	}
+	return &FileOutboxStore{dir: dir}, nil
+}
+
+// Add implements [OutboxStore].
+func (s *FileOutboxStore) Add(_ context.Context, item *OutboxItem, payload io.Reader) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The payload is written first: metadata without payload would be a
+	// broken item, a payload without metadata is just ignored.
+	payloadPath := s.path(outboxPendingDir, item.ID, outboxPayloadSuffix)
+	if err := writeFileAtomically(payloadPath, func(w io.Writer) error {
+		_, err := io.Copy(w, payload)
+		return err
+	}); err != nil {
+		return fmt.Errorf("%w: %w", ErrOutboxStoreFailed, err)
+	}
+	return s.writeItem(outboxPendingDir, item)
+}
+
+// Pending implements [OutboxStore].
+func (s *FileOutboxStore) Pending(_ context.Context) ([]*OutboxItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.readItems(outboxPendingDir)
+}
+
+// OpenPayload implements [OutboxStore].
+func (s *FileOutboxStore) OpenPayload(_ context.Context, id string) (io.ReadCloser, error) {
+	file, err := os.Open(s.path(outboxPendingDir, id, outboxPayloadSuffix))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrOutboxItemNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrOutboxStoreFailed, err)
+	}
+	return file, nil
+}
+
+// Update implements [OutboxStore].
+func (s *FileOutboxStore) Update(_ context.Context, item *OutboxItem) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := os.Stat(s.path(outboxPendingDir, item.ID, outboxItemSuffix)); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("%w: %s", ErrOutboxItemNotFound, item.ID)
+		}
+		return fmt.Errorf("%w: %w", ErrOutboxStoreFailed, err)
+	}
+	return s.writeItem(outboxPendingDir, item)
+}
+
+// Remove implements [OutboxStore].
+func (s *FileOutboxStore) Remove(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Metadata goes first, so that a crash in between leaves an ignored payload.
+	for _, suffix := range []string{outboxItemSuffix, outboxPayloadSuffix} {
+		if err := os.Remove(s.path(outboxPendingDir, id, suffix)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("%w: %w", ErrOutboxStoreFailed, err)
+		}
+	}
+	return nil
+}
+
+// MoveToDeadLetters implements [OutboxStore].
+func (s *FileOutboxStore) MoveToDeadLetters(_ context.Context, item *OutboxItem) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := os.Rename(
+		s.path(outboxPendingDir, item.ID, outboxPayloadSuffix),
+		s.path(outboxDeadLettersDir, item.ID, outboxPayloadSuffix),
+	)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrOutboxStoreFailed, err)
+	}
+	if err := s.writeItem(outboxDeadLettersDir, item); err != nil {
+		return err
+	}
+	if err := os.Remove(s.path(outboxPendingDir, item.ID, outboxItemSuffix)); err != nil {
+		return fmt.Errorf("%w: %w", ErrOutboxStoreFailed, err)
+	}
+	return nil
+}
+
+// DeadLetters implements [OutboxStore].
+func (s *FileOutboxStore) DeadLetters(_ context.Context) ([]*OutboxItem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.readItems(outboxDeadLettersDir)
+}
+
+// OpenDeadLetterPayload opens the payload of the dead-lettered item with
+// the given ID, f.e to inspect it or to enqueue it again.
+func (s *FileOutboxStore) OpenDeadLetterPayload(_ context.Context, id string) (io.ReadCloser, error) {
+	file, err := os.Open(s.path(outboxDeadLettersDir, id, outboxPayloadSuffix))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrOutboxItemNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrOutboxStoreFailed, err)
+	}
+	return file, nil
+}
+
+func (s *FileOutboxStore) path(sub, id, suffix string) string {
+	return filepath.Join(s.dir, sub, filepath.Base(id)+suffix)
+}
+
+func (s *FileOutboxStore) writeItem(sub string, item *OutboxItem) error {
+	err := writeFileAtomically(s.path(sub, item.ID, outboxItemSuffix), func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(item)
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrOutboxStoreFailed, err)
+	}
+	return nil
+}
+
+func (s *FileOutboxStore) readItems(sub string) ([]*OutboxItem, error) {
+	entries, err := os.ReadDir(filepath.Join(s.dir, sub))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrOutboxStoreFailed, err)
+	}
+	var items []*OutboxItem
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), outboxItemSuffix) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(s.dir, sub, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrOutboxStoreFailed, err)
+		}
+		item := &OutboxItem{}
+		if err := json.Unmarshal(data, item); err != nil {
+			return nil, fmt.Errorf("%w: failed to parse %s: %w", ErrOutboxStoreFailed, entry.Name(), err)
+		}
+		items = append(items, item)
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Sequence < items[j].Sequence
+	})
+	return items, nil
+}
+
+// writeFileAtomically writes a file by writing to a temporary file in the
+// same directory first and renaming it to path once complete. The file is
+// only readable and writable by the owner.
+func writeFileAtomically(path string, write func(w io.Writer) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+
+	if err := write(tmp); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
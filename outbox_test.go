@@ -0,0 +1,194 @@
+package agrirouter_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DKE-Data/agrirouter-sdk-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestOutbox(t *testing.T, api *fakeAPI, opts ...agrirouter.OutboxOption) (*agrirouter.Outbox, *agrirouter.FileOutboxStore) {
+	t.Helper()
+	store, err := agrirouter.NewFileOutboxStore(t.TempDir())
+	require.NoError(t, err)
+	return agrirouter.NewOutbox(api.client(), store, opts...), store
+}
+
+func TestOutbox_SendsInOrderAndKeepsContextID(t *testing.T) {
+	api := newFakeAPI(t)
+	outbox, _ := newTestOutbox(t, api)
+	ctx := context.Background()
+
+	opts := newSendOptions().Publish()
+	first, err := outbox.Enqueue(ctx, opts, strings.NewReader("first"))
+	require.NoError(t, err)
+	_, err = outbox.Enqueue(ctx, opts, strings.NewReader("second"))
+	require.NoError(t, err)
+
+	depth, err := outbox.QueueDepth(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, depth)
+	assert.Empty(t, api.recorded(), "enqueueing must not send")
+
+	require.NoError(t, outbox.Flush(ctx))
+
+	requests := api.recorded()
+	require.Len(t, requests, 2)
+	assert.Equal(t, "first", string(requests[0].Body))
+	assert.Equal(t, "second", string(requests[1].Body))
+	assert.Equal(t, first.Options.ContextID, requests[0].Header.Get("X-Agrirouter-Context-Id"))
+
+	depth, err = outbox.QueueDepth(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, depth)
+}
+
+func TestOutbox_RetriesTransientFailuresPerEndpoint(t *testing.T) {
+	api := newFakeAPI(t)
+	api.setDefaultStatus(http.StatusServiceUnavailable)
+	var failures []error
+	outbox, store := newTestOutbox(t, api,
+		agrirouter.WithOutboxBackoff(time.Hour, time.Hour),
+		agrirouter.WithOutboxFailureHandler(func(_ *agrirouter.OutboxItem, err error) {
+			failures = append(failures, err)
+		}),
+	)
+	ctx := context.Background()
+
+	blocked := newSendOptions().Publish()
+	item, err := outbox.Enqueue(ctx, blocked, strings.NewReader("a"))
+	require.NoError(t, err)
+	_, err = outbox.Enqueue(ctx, blocked, strings.NewReader("b"))
+	require.NoError(t, err)
+
+	require.NoError(t, outbox.Flush(ctx))
+	require.Len(t, api.recorded(), 1, "later messages of a failing endpoint must wait")
+	require.Len(t, failures, 1)
+
+	pending, err := store.Pending(ctx)
+	require.NoError(t, err)
+	require.Len(t, pending, 2)
+	assert.Equal(t, item.ID, pending[0].ID)
+	assert.Equal(t, 1, pending[0].Attempts)
+	assert.True(t, pending[0].NextAttemptAt.After(time.Now()))
+
+	// another endpoint is not held back, while the failed one waits for its backoff
+	api.setDefaultStatus(http.StatusOK)
+	other := newSendOptions().Publish()
+	_, err = outbox.Enqueue(ctx, other, strings.NewReader("c"))
+	require.NoError(t, err)
+	require.NoError(t, outbox.Flush(ctx))
+	requests := api.recorded()
+	require.Len(t, requests, 2)
+	assert.Equal(t, "c", string(requests[1].Body))
+}
+
+func TestOutbox_DeadLettersPermanentFailures(t *testing.T) {
+	api := newFakeAPI(t)
+	api.setDefaultStatus(http.StatusRequestEntityTooLarge)
+	var deadLettered []*agrirouter.OutboxItem
+	outbox, store := newTestOutbox(t, api, agrirouter.WithOutboxDeadLetterHandler(func(item *agrirouter.OutboxItem, err error) {
+		status, ok := agrirouter.APIStatusCode(err)
+		assert.True(t, ok)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, status)
+		deadLettered = append(deadLettered, item)
+	}))
+	ctx := context.Background()
+
+	item, err := outbox.Enqueue(ctx, newSendOptions().Publish(), strings.NewReader("too large"))
+	require.NoError(t, err)
+	require.NoError(t, outbox.Flush(ctx))
+
+	require.Len(t, deadLettered, 1)
+	pending, err := store.Pending(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+
+	deadLetters, err := store.DeadLetters(ctx)
+	require.NoError(t, err)
+	require.Len(t, deadLetters, 1)
+	assert.Equal(t, item.ID, deadLetters[0].ID)
+	assert.Contains(t, deadLetters[0].LastError, "413")
+
+	payload, err := store.OpenDeadLetterPayload(ctx, item.ID)
+	require.NoError(t, err)
+	defer payload.Close()
+	content, err := io.ReadAll(payload)
+	require.NoError(t, err)
+	assert.Equal(t, "too large", string(content))
+}
+
+func TestOutbox_DeadLettersAfterMaxAttempts(t *testing.T) {
+	api := newFakeAPI(t)
+	api.setDefaultStatus(http.StatusInternalServerError)
+	outbox, store := newTestOutbox(t, api,
+		agrirouter.WithOutboxBackoff(0, 0),
+		agrirouter.WithOutboxMaxAttempts(2),
+	)
+	ctx := context.Background()
+
+	_, err := outbox.Enqueue(ctx, newSendOptions().Publish(), strings.NewReader("x"))
+	require.NoError(t, err)
+	require.NoError(t, outbox.Flush(ctx))
+	require.NoError(t, outbox.Flush(ctx))
+
+	assert.Len(t, api.recorded(), 2)
+	deadLetters, err := store.DeadLetters(ctx)
+	require.NoError(t, err)
+	assert.Len(t, deadLetters, 1)
+}
+
+func TestOutbox_SurvivesRestart(t *testing.T) {
+	api := newFakeAPI(t)
+	store, err := agrirouter.NewFileOutboxStore(t.TempDir())
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	_, err = agrirouter.NewOutbox(api.client(), store).Enqueue(ctx, newSendOptions().Publish(), strings.NewReader("persisted"))
+	require.NoError(t, err)
+
+	require.NoError(t, agrirouter.NewOutbox(api.client(), store).Flush(ctx))
+	requests := api.recorded()
+	require.Len(t, requests, 1)
+	assert.Equal(t, "persisted", string(requests[0].Body))
+}
+
+func TestOutbox_RunFlushesEnqueuedMessages(t *testing.T) {
+	api := newFakeAPI(t)
+	var mu sync.Mutex
+	var receipts []*agrirouter.SendReceipt
+	outbox, _ := newTestOutbox(t, api, agrirouter.WithOutboxSentHandler(func(_ *agrirouter.OutboxItem, receipt *agrirouter.SendReceipt) {
+		mu.Lock()
+		defer mu.Unlock()
+		receipts = append(receipts, receipt)
+	}))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- outbox.Run(ctx, nil) }()
+
+	_, err := outbox.Enqueue(ctx, newSendOptions().Publish(), strings.NewReader("x"))
+	require.NoError(t, err)
+	assert.EventuallyWithT(t, func(c *assert.CollectT) {
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Len(c, receipts, 1)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	assert.True(t, errors.Is(<-done, context.Canceled))
+}
+
+func TestIsPermanentSendError(t *testing.T) {
+	assert.True(t, agrirouter.IsPermanentSendError(agrirouter.ErrInvalidSendOptions))
+	assert.True(t, agrirouter.IsPermanentSendError(&agrirouter.APIError{StatusCode: http.StatusBadRequest}))
+	assert.False(t, agrirouter.IsPermanentSendError(&agrirouter.APIError{StatusCode: http.StatusBadGateway}))
+	assert.False(t, agrirouter.IsPermanentSendError(agrirouter.ErrAPICallFailed))
+}
@@ -0,0 +1,194 @@
+package agrirouter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrAutoConfirmFailed is reported when confirming a successfully processed
+// message or file failed, see [WithAutoConfirm].
+var ErrAutoConfirmFailed = errors.New("failed to auto-confirm")
+
+// errSkipped is returned by processors wrapped to drop messages and files,
+// f.e of other tenants. Such messages are neither confirmed nor reported.
+var errSkipped = errors.New("skipped")
+
+// MessageProcessor is a function that processes a received message and
+// reports whether it succeeded.
+//
+// Returning nil marks the message as processed, so that it is confirmed when
+// receiving with [WithAutoConfirm]. Returning an error leaves the message
+// unconfirmed, so that agrirouter delivers it again later.
+type MessageProcessor func(ctx context.Context, message *Message) error
+
+// FileProcessor is a function that processes a received file and reports
+// whether it succeeded, like [MessageProcessor] does for messages.
+//
+// The payload of the file is closed once the processor returns.
+type FileProcessor func(ctx context.Context, file *File) error
+
+// MessageProcessingError is reported to the error handler when a
+// [MessageProcessor] or [FileProcessor] returned an error. Either Message or
+// File is set, depending on what was processed.
+type MessageProcessingError struct {
+	Message *Message // Message is the message that failed to be processed, if any
+	File    *File    // File is the file that failed to be processed, if any
+	Err     error    // Err is the error returned by the processor
+}
+
+// Error implements the error interface.
+func (e *MessageProcessingError) Error() string {
+	if e.File != nil {
+		return fmt.Sprintf("failed to process file with message IDs %v: %v", e.File.MessageIDs, e.Err)
+	}
+	return fmt.Sprintf("failed to process message %s: %v", e.Message.ID, e.Err)
+}
+
+// Unwrap returns the error returned by the processor.
+func (e *MessageProcessingError) Unwrap() error {
+	return e.Err
+}
+
+// ReceiveOption configures how [Client.ReceiveEvents] handles received events.
+type ReceiveOption func(*receiveConfig)
+
+type receiveConfig struct {
+	autoConfirm         bool
+	confirmationBatcher *ConfirmationBatcher
+	seenStore           SeenStore
+	deadLetters         DeadLetterStore
+	recorder            *EventRecorder
+	filters             []EventFilter
+	leaderElection      *LeaderElection
+	endpointDiffer      *EndpointDiffer
+	endpointDiffHandler EndpointDiffHandler
+	onConnect           func(ctx context.Context) error
+}
+
+func newReceiveConfig(opts []ReceiveOption) *receiveConfig {
+	cfg := &receiveConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// withOnConnect makes [Client.ReceiveEvents] call onConnect whenever the
+// events stream was (re)connected, before reading events from it. Errors
+// returned by onConnect end receiving.
+func withOnConnect(onConnect func(ctx context.Context) error) ReceiveOption {
+	return func(cfg *receiveConfig) {
+		cfg.onConnect = onConnect
+	}
+}
+
+// connected returns the function to call when the events stream was
+// connected, or nil if there is none.
+func (cfg *receiveConfig) connected(ctx context.Context) func() error {
+	if cfg.onConnect == nil {
+		return nil
+	}
+	return func() error {
+		return cfg.onConnect(ctx)
+	}
+}
+
+// WithAutoConfirm makes [Client.ReceiveEvents] confirm every message and file
+// that was processed successfully by [EventHandlers.ProcessMessage] or
+// [EventHandlers.ProcessFile]. Files are confirmed by confirming all messages
+// that carried their payload.
+//
+// Messages and files handled by OnMessage or OnFile are not confirmed, as
+// these handlers do not report whether processing succeeded.
+func WithAutoConfirm() ReceiveOption {
+	return func(cfg *receiveConfig) {
+		cfg.autoConfirm = true
+	}
+}
+
+// processMessage processes message and reports whether it was processed
+// successfully.
+func (c *Client) processMessage(
+	ctx context.Context,
+	message *Message,
+	processor MessageProcessor,
+	cfg *receiveConfig,
+	errorHandler func(err error),
+) bool {
+	if err := processor(ctx, message); err != nil {
+		if !errors.Is(err, errSkipped) {
+			errorHandler(&MessageProcessingError{Message: message, Err: err})
+			cfg.deadLetterMessage(ctx, message, err, errorHandler)
+		}
+		return false
+	}
+	if cfg.autoConfirm {
+		c.confirmProcessed(ctx, cfg, message.Confirmation, errorHandler)
+	}
+	return true
+}
+
+// processFile processes file and reports whether it was processed
+// successfully.
+func (c *Client) processFile(
+	ctx context.Context,
+	file *File,
+	processor FileProcessor,
+	cfg *receiveConfig,
+	errorHandler func(err error),
+) bool {
+	closePayload := func() {
+		if closer, ok := file.Payload.(io.Closer); ok {
+			_ = closer.Close()
+		}
+	}
+	var buffer *payloadBuffer
+	if cfg.deadLetters != nil {
+		var err error
+		if buffer, err = bufferPayload(file); err != nil {
+			errorHandler(err)
+		} else {
+			closePayload = buffer.close
+		}
+	}
+	err := processor(ctx, file)
+	if err != nil && !errors.Is(err, errSkipped) {
+		errorHandler(&MessageProcessingError{File: file, Err: err})
+		cfg.deadLetterFile(ctx, file, buffer, err, errorHandler)
+	}
+	closePayload()
+	if err != nil {
+		return false
+	}
+	if cfg.autoConfirm {
+		c.confirmProcessed(ctx, cfg, file.Confirmations, errorHandler)
+	}
+	return true
+}
+
+// confirmProcessed auto-confirms the confirmations of a message or file that
+// was processed or dropped, reporting failures to errorHandler.
+func (c *Client) confirmProcessed(
+	ctx context.Context,
+	cfg *receiveConfig,
+	confirmations func() (*TenantConfirmations, error),
+	errorHandler func(err error),
+) {
+	tenantConfirmations, err := confirmations()
+	if err == nil {
+		err = c.autoConfirm(ctx, cfg, tenantConfirmations)
+	}
+	if err != nil {
+		errorHandler(fmt.Errorf("%w: %w", ErrAutoConfirmFailed, err))
+	}
+}
+
+// autoConfirm confirms directly or adds the confirmations to the batcher of cfg.
+func (c *Client) autoConfirm(ctx context.Context, cfg *receiveConfig, confirmations *TenantConfirmations) error {
+	if cfg.confirmationBatcher != nil {
+		return cfg.confirmationBatcher.Add(confirmations.TenantID, confirmations.Confirmations...)
+	}
+	return c.confirm(ctx, confirmations)
+}
@@ -0,0 +1,215 @@
+package agrirouter_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/DKE-Data/agrirouter-sdk-go"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// messageEvent returns a MESSAGE_RECEIVED event with an embedded payload.
+func messageEvent(tenantID, endpointID, messageID uuid.UUID, payload string) map[string]any {
+	return map[string]any{
+		"event_type":            "MESSAGE_RECEIVED",
+		"id":                    messageID,
+		"app_message_id":        "context-0",
+		"message_type":          "gps:info",
+		"payload":               []byte(payload),
+		"receiving_endpoint_id": endpointID,
+		"sent_at":               time.Now(),
+		"tenant_id":             tenantID.String(),
+	}
+}
+
+// fileEvent returns a FILE_RECEIVED event whose payload is served by api.
+func fileEvent(api *fakeAPI, tenantID, endpointID uuid.UUID, messageIDs []uuid.UUID, payload string) map[string]any {
+	path := "/payloads/" + uuid.NewString()
+	api.handle(http.MethodGet, path, func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, payload)
+	})
+	return map[string]any{
+		"event_type":            "FILE_RECEIVED",
+		"message_ids":           messageIDs,
+		"message_type":          "iso:11783:-10:taskdata:zip",
+		"payload_uri":           api.url(path),
+		"receiving_endpoint_id": endpointID,
+		"size":                  len(payload),
+		"tenant_id":             tenantID.String(),
+	}
+}
+
+// acceptConfirmations makes api accept confirmation requests.
+func acceptConfirmations(api *fakeAPI) {
+	api.handle(http.MethodPost, "/confirmations", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
+
+// confirmationRequests returns the confirmation requests received by api.
+func confirmationRequests(api *fakeAPI) []recordedRequest {
+	var requests []recordedRequest
+	for _, request := range api.recorded() {
+		if request.Path == "/confirmations" {
+			requests = append(requests, request)
+		}
+	}
+	return requests
+}
+
+func decodeConfirmations(t *testing.T, request recordedRequest) []agrirouter.MessageConfirmation {
+	t.Helper()
+	var body agrirouter.ConfirmMessagesRequest
+	require.NoError(t, json.Unmarshal(request.Body, &body))
+	return body.Confirmations
+}
+
+func TestReceiveEvents_AutoConfirmsProcessedMessages(t *testing.T) {
+	api := newFakeAPI(t)
+	acceptConfirmations(api)
+	tenantID, endpointID := uuid.New(), uuid.New()
+	processed, failed := uuid.New(), uuid.New()
+	api.serveEvents(
+		messageEvent(tenantID, endpointID, processed, "ok"),
+		messageEvent(tenantID, endpointID, failed, "broken"),
+	)
+	client := api.client()
+	processingErr := errors.New("cannot parse")
+
+	run := startReceiving(t, func(ctx context.Context, errorHandler func(err error)) error {
+		return client.ReceiveEvents(ctx, nil, agrirouter.EventHandlers{
+			ProcessMessage: func(_ context.Context, message *agrirouter.Message) error {
+				if string(message.Payload) == "broken" {
+					return processingErr
+				}
+				return nil
+			},
+		}, errorHandler, agrirouter.WithAutoConfirm())
+	})
+
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		assert.Len(c, confirmationRequests(api), 1)
+		assert.Len(c, run.reported(), 1)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	request := confirmationRequests(api)[0]
+	assert.Equal(t, tenantID.String(), request.Header.Get("X-Agrirouter-Tenant-Id"))
+	assert.Equal(t, []agrirouter.MessageConfirmation{{MessageId: processed, EndpointId: endpointID}},
+		decodeConfirmations(t, request))
+
+	var processingError *agrirouter.MessageProcessingError
+	require.ErrorAs(t, run.reported()[0], &processingError)
+	assert.Equal(t, failed, processingError.Message.ID)
+	assert.ErrorIs(t, processingError, processingErr)
+}
+
+func TestReceiveEvents_AutoConfirmsAllMessagesOfProcessedFile(t *testing.T) {
+	api := newFakeAPI(t)
+	acceptConfirmations(api)
+	tenantID, endpointID := uuid.New(), uuid.New()
+	messageIDs := []uuid.UUID{uuid.New(), uuid.New()}
+	api.serveEvents(fileEvent(api, tenantID, endpointID, messageIDs, "file"))
+	client := api.client()
+
+	var payload []byte
+	startReceiving(t, func(ctx context.Context, errorHandler func(err error)) error {
+		return client.ReceiveEvents(ctx, nil, agrirouter.EventHandlers{
+			ProcessFile: func(_ context.Context, file *agrirouter.File) error {
+				var err error
+				payload, err = io.ReadAll(file.Payload)
+				return err
+			},
+		}, errorHandler, agrirouter.WithAutoConfirm())
+	})
+
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		assert.Len(c, confirmationRequests(api), 1)
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "file", string(payload))
+	assert.Equal(t, []agrirouter.MessageConfirmation{
+		{MessageId: messageIDs[0], EndpointId: endpointID},
+		{MessageId: messageIDs[1], EndpointId: endpointID},
+	}, decodeConfirmations(t, confirmationRequests(api)[0]))
+}
+
+func TestReceiveEvents_DoesNotConfirmWithoutAutoConfirm(t *testing.T) {
+	api := newFakeAPI(t)
+	acceptConfirmations(api)
+	api.serveEvents(messageEvent(uuid.New(), uuid.New(), uuid.New(), "ok"))
+	client := api.client()
+
+	processed := make(chan struct{}, 1)
+	run := startReceiving(t, func(ctx context.Context, errorHandler func(err error)) error {
+		return client.ReceiveEvents(ctx, nil, agrirouter.EventHandlers{
+			ProcessMessage: func(context.Context, *agrirouter.Message) error {
+				processed <- struct{}{}
+				return nil
+			},
+		}, errorHandler)
+	})
+
+	select {
+	case <-processed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("message was not processed")
+	}
+	run.stop()
+	assert.Empty(t, confirmationRequests(api))
+}
+
+func TestReceiveEvents_ReportsAutoConfirmFailures(t *testing.T) {
+	api := newFakeAPI(t)
+	event := messageEvent(uuid.New(), uuid.New(), uuid.New(), "ok")
+	delete(event, "tenant_id")
+	api.serveEvents(event)
+	client := api.client()
+
+	run := startReceiving(t, func(ctx context.Context, errorHandler func(err error)) error {
+		return client.ReceiveEvents(ctx, nil, agrirouter.EventHandlers{
+			ProcessMessage: func(context.Context, *agrirouter.Message) error { return nil },
+		}, errorHandler, agrirouter.WithAutoConfirm())
+	})
+
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		assert.Len(c, run.reported(), 1)
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.ErrorIs(t, run.reported()[0], agrirouter.ErrAutoConfirmFailed)
+	assert.Empty(t, confirmationRequests(api))
+}
+
+func TestTenantClient_AutoConfirmsOnlyOwnMessages(t *testing.T) {
+	api := newFakeAPI(t)
+	acceptConfirmations(api)
+	tenantID, otherTenantID, endpointID := uuid.New(), uuid.New(), uuid.New()
+	own := uuid.New()
+	api.serveEvents(
+		messageEvent(otherTenantID, endpointID, uuid.New(), "other"),
+		messageEvent(tenantID, endpointID, own, "own"),
+	)
+	tenant := api.client().Tenant(tenantID)
+
+	var processed []uuid.UUID
+	run := startReceiving(t, func(ctx context.Context, errorHandler func(err error)) error {
+		return tenant.ReceiveEvents(ctx, nil, agrirouter.EventHandlers{
+			ProcessMessage: func(_ context.Context, message *agrirouter.Message) error {
+				processed = append(processed, message.ID)
+				return nil
+			},
+		}, errorHandler, agrirouter.WithAutoConfirm())
+	})
+
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		assert.Len(c, confirmationRequests(api), 1)
+	}, 5*time.Second, 10*time.Millisecond)
+	run.stop()
+	assert.Equal(t, []uuid.UUID{own}, processed)
+	assert.Empty(t, run.reported())
+	assert.Equal(t, tenantID.String(), confirmationRequests(api)[0].Header.Get("X-Agrirouter-Tenant-Id"))
+}
@@ -0,0 +1,102 @@
+package agrirouter
+
+import (
+	"io"
+	"time"
+)
+
+// progressReportInterval is the minimum time between two progress reports
+// of a [ProgressReader], except for the final one.
+const progressReportInterval = 100 * time.Millisecond
+
+// Progress describes how much of a payload has been transferred.
+type Progress struct {
+	// Bytes is the number of bytes transferred so far.
+	Bytes int64
+	// Total is the size of the payload in bytes, or zero if unknown.
+	Total int64
+	// Elapsed is the time since the transfer started.
+	Elapsed time.Duration
+	// BytesPerSecond is the average throughput since the transfer started.
+	BytesPerSecond float64
+	// Done is set on the final report, once the payload was transferred completely.
+	Done bool
+}
+
+// Fraction returns the transferred part of the payload between 0 and 1,
+// or -1 if the total size is unknown.
+func (p Progress) Fraction() float64 {
+	if p.Total <= 0 {
+		return -1
+	}
+	return min(float64(p.Bytes)/float64(p.Total), 1)
+}
+
+// ProgressFunc is called to report the progress of a transfer.
+type ProgressFunc func(progress Progress)
+
+// ProgressReader is an [io.Reader] reporting the progress of reading from an
+// underlying reader.
+//
+// Progress is reported at most every 100 milliseconds, and a final time once
+// the underlying reader returned [io.EOF] or total bytes were read.
+type ProgressReader struct {
+	reader     io.Reader
+	onProgress ProgressFunc
+	total      int64
+	bytes      int64
+	started    time.Time
+	reported   time.Time
+	done       bool
+}
+
+// NewProgressReader returns a [ProgressReader] reading from r and reporting
+// progress to onProgress. total is the expected size of the payload, zero if
+// unknown.
+func NewProgressReader(r io.Reader, total int64, onProgress ProgressFunc) *ProgressReader {
+	return &ProgressReader{reader: r, onProgress: onProgress, total: total}
+}
+
+// Read reads from the underlying reader and reports the progress.
+func (p *ProgressReader) Read(b []byte) (int, error) {
+	now := time.Now()
+	if p.started.IsZero() {
+		p.started = now
+		p.reported = now
+	}
+	n, err := p.reader.Read(b)
+	p.bytes += int64(n)
+	if p.done {
+		return n, err
+	}
+	p.done = err == io.EOF || (p.total > 0 && p.bytes >= p.total)
+	if p.done || now.Sub(p.reported) >= progressReportInterval {
+		p.reported = now
+		p.report(time.Now())
+	}
+	return n, err
+}
+
+// Close closes the underlying reader if it implements [io.Closer].
+func (p *ProgressReader) Close() error {
+	if closer, ok := p.reader.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (p *ProgressReader) report(now time.Time) {
+	elapsed := now.Sub(p.started)
+	progress := Progress{Bytes: p.bytes, Total: p.total, Elapsed: elapsed, Done: p.done}
+	if elapsed > 0 {
+		progress.BytesPerSecond = float64(p.bytes) / elapsed.Seconds()
+	}
+	p.onProgress(progress)
+}
+
+// TrackProgress makes reading [File.Payload] report the progress to
+// onProgress, using [File.Size] as the total size. It must be called before
+// reading the payload.
+func (f *File) TrackProgress(onProgress ProgressFunc) {
+	f.Payload = NewProgressReader(f.Payload, f.Size, onProgress)
+}
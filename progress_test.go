@@ -0,0 +1,72 @@
+package agrirouter_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/DKE-Data/agrirouter-sdk-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgressReader_ReportsFinalProgress(t *testing.T) {
+	var reports []agrirouter.Progress
+	reader := agrirouter.NewProgressReader(strings.NewReader("0123456789"), 10, func(p agrirouter.Progress) {
+		reports = append(reports, p)
+	})
+
+	read, err := io.ReadAll(io.LimitReader(reader, 4))
+	require.NoError(t, err)
+	assert.Equal(t, "0123", string(read))
+	_, err = io.ReadAll(reader)
+	require.NoError(t, err)
+
+	require.NotEmpty(t, reports)
+	last := reports[len(reports)-1]
+	assert.True(t, last.Done)
+	assert.Equal(t, int64(10), last.Bytes)
+	assert.Equal(t, int64(10), last.Total)
+	assert.InDelta(t, 1.0, last.Fraction(), 0)
+	for _, report := range reports[:len(reports)-1] {
+		assert.False(t, report.Done)
+	}
+}
+
+func TestProgress_FractionOfUnknownTotal(t *testing.T) {
+	assert.InDelta(t, -1.0, agrirouter.Progress{Bytes: 5}.Fraction(), 0)
+	assert.InDelta(t, 0.5, agrirouter.Progress{Bytes: 5, Total: 10}.Fraction(), 0)
+}
+
+func TestSend_ReportsUploadProgress(t *testing.T) {
+	api := newFakeAPI(t)
+	payload := bytes.Repeat([]byte("x"), 64*1024)
+	var last agrirouter.Progress
+	opts := newSendOptions().Publish()
+	opts.OnProgress = func(p agrirouter.Progress) { last = p }
+
+	_, err := api.client().Send(context.Background(), opts, bytes.NewReader(payload))
+	require.NoError(t, err)
+
+	assert.True(t, last.Done)
+	assert.Equal(t, int64(len(payload)), last.Bytes)
+	assert.Equal(t, int64(len(payload)), last.Total)
+	requests := api.recorded()
+	require.Len(t, requests, 1)
+	assert.Equal(t, "65536", requests[0].Header.Get("Content-Length"))
+	assert.Equal(t, payload, requests[0].Body)
+}
+
+func TestFile_TrackProgress(t *testing.T) {
+	file := &agrirouter.File{Payload: strings.NewReader("payload"), Size: 7}
+	var last agrirouter.Progress
+	file.TrackProgress(func(p agrirouter.Progress) { last = p })
+
+	read, err := io.ReadAll(file.Payload)
+	require.NoError(t, err)
+	assert.Equal(t, "payload", string(read))
+	assert.True(t, last.Done)
+	assert.Equal(t, int64(7), last.Bytes)
+}
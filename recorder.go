@@ -0,0 +1,319 @@
+package agrirouter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/DKE-Data/agrirouter-sdk-go/internal/oapi"
+	internal_models "github.com/DKE-Data/agrirouter-sdk-go/internal/oapi/models"
+	"github.com/tmaxmax/go-sse"
+)
+
+var (
+	// ErrRecordingFailed is reported when an event or payload could not be
+	// written by an [EventRecorder].
+	ErrRecordingFailed = errors.New("failed to record event")
+
+	// ErrInvalidArchive is returned by [Replay] when the archive cannot be
+	// parsed.
+	ErrInvalidArchive = errors.New("invalid event archive")
+)
+
+// RecordKind tells what a [Record] holds.
+type RecordKind string
+
+const (
+	RecordEvent   RecordKind = "event"   // RecordEvent is a record of a raw event
+	RecordPayload RecordKind = "payload" // RecordPayload is a record of a fetched payload
+)
+
+// Record is a line of an event archive written by [EventRecorder].
+type Record struct {
+	// Kind tells whether the record holds an event or a payload.
+	Kind RecordKind `json:"kind"`
+	// ReceivedAt is the time the event arrived or the payload was fetched.
+	ReceivedAt time.Time `json:"received_at"`
+	// EventID is the ID of the event as sent in the events stream, if any.
+	EventID string `json:"event_id,omitempty"`
+	// EventType is the type of the event as sent in the events stream, if
+	// any. The type of agrirouter events is part of their data.
+	EventType string `json:"event_type,omitempty"`
+	// Data is the raw data of the event.
+	Data string `json:"data,omitempty"`
+	// PayloadURI is the URI the payload was fetched from.
+	PayloadURI string `json:"payload_uri,omitempty"`
+	// Payload is the fetched payload.
+	Payload []byte `json:"payload,omitempty"`
+}
+
+// EventRecorder writes raw events, and optionally fetched payloads, to an
+// archive with one JSON encoded [Record] per line, see [WithRecorder]. The
+// archive can be fed through the event handlers again with [Replay].
+//
+// Recorders are safe for concurrent use.
+type EventRecorder struct {
+	payloads bool
+
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+// EventRecorderOption configures an [EventRecorder].
+type EventRecorderOption func(*EventRecorder)
+
+// WithRecordedPayloads makes an [EventRecorder] also record payloads fetched
+// from payload URIs, which are only valid for a short time. A payload is
+// recorded once it was read completely or closed. Payloads of files are
+// buffered in memory until then.
+func WithRecordedPayloads() EventRecorderOption {
+	return func(r *EventRecorder) {
+		r.payloads = true
+	}
+}
+
+// NewEventRecorder creates an [EventRecorder] writing records to w.
+func NewEventRecorder(w io.Writer, opts ...EventRecorderOption) *EventRecorder {
+	r := &EventRecorder{encoder: json.NewEncoder(w)}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Record writes record to the archive.
+func (r *EventRecorder) Record(record *Record) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.encoder.Encode(record); err != nil {
+		return fmt.Errorf("%w: %w", ErrRecordingFailed, err)
+	}
+	return nil
+}
+
+// WithRecorder makes [Client.ReceiveEvents] write every received event to
+// recorder before handling it.
+func WithRecorder(recorder *EventRecorder) ReceiveOption {
+	return func(cfg *receiveConfig) {
+		cfg.recorder = recorder
+	}
+}
+
+// record writes the raw event to the recorder of cfg, if configured.
+func (cfg *receiveConfig) record(raw sse.Event, errorHandler func(err error)) {
+	if cfg.recorder == nil {
+		return
+	}
+	err := cfg.recorder.Record(&Record{
+		Kind:       RecordEvent,
+		ReceivedAt: time.Now(),
+		EventID:    raw.LastEventID,
+		EventType:  raw.Type,
+		Data:       raw.Data,
+	})
+	if err != nil {
+		errorHandler(err)
+	}
+}
+
+// withRecorder returns a copy of c recording fetched payloads with the
+// recorder of cfg, or c if payloads are not recorded.
+func (c *Client) withRecorder(cfg *receiveConfig, errorHandler func(err error)) *Client {
+	if cfg.recorder == nil || !cfg.recorder.payloads {
+		return c
+	}
+	recording := *c
+	recording.payloadsClient = &recordingPayloadsClient{
+		client:       c.payloadsClient,
+		recorder:     cfg.recorder,
+		errorHandler: errorHandler,
+	}
+	return &recording
+}
+
+type recordingPayloadsClient struct {
+	client       oapi.HttpRequestDoer
+	recorder     *EventRecorder
+	errorHandler func(err error)
+}
+
+func (r *recordingPayloadsClient) Do(req *http.Request) (*http.Response, error) {
+	resp, err := r.client.Do(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	resp.Body = &recordingBody{
+		body:   resp.Body,
+		uri:    req.URL.String(),
+		client: r,
+	}
+	return resp, nil
+}
+
+// recordingBody buffers a payload while it is read and records it once read
+// completely or closed.
+type recordingBody struct {
+	body   io.ReadCloser
+	uri    string
+	client *recordingPayloadsClient
+	buffer bytes.Buffer
+	once   sync.Once
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	b.buffer.Write(p[:n])
+	if errors.Is(err, io.EOF) {
+		b.record()
+	}
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	b.once.Do(func() {
+		// the rest of the payload is read to record it completely
+		if _, err := b.buffer.ReadFrom(b.body); err != nil {
+			b.client.errorHandler(fmt.Errorf("%w: %w", ErrRecordingFailed, err))
+		}
+		b.write()
+	})
+	return b.body.Close()
+}
+
+func (b *recordingBody) record() {
+	b.once.Do(b.write)
+}
+
+func (b *recordingBody) write() {
+	err := b.client.recorder.Record(&Record{
+		Kind:       RecordPayload,
+		ReceivedAt: time.Now(),
+		PayloadURI: b.uri,
+		Payload:    b.buffer.Bytes(),
+	})
+	if err != nil {
+		b.client.errorHandler(err)
+	}
+}
+
+// ReplayOption configures [Replay].
+type ReplayOption func(*replayConfig)
+
+type replayConfig struct {
+	speed          float64
+	receiveOptions []ReceiveOption
+}
+
+// WithReplaySpeed makes [Replay] keep the time between events as recorded,
+// divided by speed, f.e 1 replays in real time and 2 twice as fast. By
+// default events are replayed as fast as possible.
+func WithReplaySpeed(speed float64) ReplayOption {
+	return func(cfg *replayConfig) {
+		cfg.speed = speed
+	}
+}
+
+// WithReplayReceiveOptions sets options applied to replayed events as by
+// [Client.ReceiveEvents], f.e [WithDeduplication].
+//
+// Options calling the agrirouter API, f.e [WithAutoConfirm], fail as the
+// replay runs offline.
+func WithReplayReceiveOptions(opts ...ReceiveOption) ReplayOption {
+	return func(cfg *replayConfig) {
+		cfg.receiveOptions = append(cfg.receiveOptions, opts...)
+	}
+}
+
+// Replay feeds the events of an archive written by [EventRecorder] through
+// handlers, as [Client.ReceiveEvents] would have done when receiving them.
+//
+// The replay runs offline: payloads are served from the archive if they were
+// recorded, see [WithRecordedPayloads], and fail to be fetched otherwise.
+// Errors are reported to errorHandler. Replay returns once all events were
+// replayed or ctx is canceled, it fails with [ErrInvalidArchive] if the
+// archive cannot be parsed.
+func Replay(
+	ctx context.Context,
+	archive io.Reader,
+	handlers EventHandlers,
+	errorHandler func(err error),
+	opts ...ReplayOption,
+) error {
+	replayCfg := &replayConfig{}
+	for _, opt := range opts {
+		opt(replayCfg)
+	}
+
+	var events []*Record
+	payloads := map[string][]byte{}
+	decoder := json.NewDecoder(archive)
+	for {
+		record := &Record{}
+		err := decoder.Decode(record)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidArchive, err)
+		}
+		switch record.Kind {
+		case RecordEvent:
+			events = append(events, record)
+		case RecordPayload:
+			payloads[record.PayloadURI] = record.Payload
+		default:
+			return fmt.Errorf("%w: unknown record kind %q", ErrInvalidArchive, record.Kind)
+		}
+	}
+
+	client, err := NewClient("http://replay.invalid", WithPayloadsHTTPClient(archivedPayloads(payloads)))
+	if err != nil {
+		return err
+	}
+	cfg := newReceiveConfig(replayCfg.receiveOptions)
+	handlers = cfg.filterHandlers(cfg.diffHandlers(handlers))
+	for i, record := range events {
+		if replayCfg.speed > 0 && i > 0 {
+			delay := record.ReceivedAt.Sub(events[i-1].ReceivedAt)
+			if !sleep(ctx, time.Duration(float64(delay)/replayCfg.speed)) {
+				return ctx.Err()
+			}
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var event internal_models.GenericEventData
+		if err := json.Unmarshal([]byte(record.Data), &event); err != nil {
+			errorHandler(err)
+			continue
+		}
+		client.dispatchEvent(ctx, event, handlers, cfg, errorHandler)
+	}
+	return nil
+}
+
+// archivedPayloads serves payloads recorded in an archive by their URI.
+type archivedPayloads map[string][]byte
+
+func (a archivedPayloads) Do(req *http.Request) (*http.Response, error) {
+	payload, ok := a[req.URL.String()]
+	if !ok {
+		return &http.Response{
+			StatusCode: http.StatusNotFound,
+			Body:       io.NopCloser(bytes.NewReader(nil)),
+			Request:    req,
+		}, nil
+	}
+	return &http.Response{
+		StatusCode:    http.StatusOK,
+		Body:          io.NopCloser(bytes.NewReader(payload)),
+		ContentLength: int64(len(payload)),
+		Request:       req,
+	}, nil
+}
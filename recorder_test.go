@@ -0,0 +1,135 @@
+package agrirouter_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DKE-Data/agrirouter-sdk-go"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// syncBuffer is a buffer safe for concurrent use.
+type syncBuffer struct {
+	mu     sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buffer.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buffer.String()
+}
+
+// eventRecord returns an archive line holding event received at receivedAt.
+func eventRecord(t *testing.T, event map[string]any, receivedAt time.Time) string {
+	t.Helper()
+	data, err := json.Marshal(event)
+	require.NoError(t, err)
+	line, err := json.Marshal(&agrirouter.Record{Kind: agrirouter.RecordEvent, ReceivedAt: receivedAt, Data: string(data)})
+	require.NoError(t, err)
+	return string(line) + "\n"
+}
+
+func TestReceiveEvents_RecordsEventsForReplay(t *testing.T) {
+	api := newFakeAPI(t)
+	tenantID, endpointID, messageID := uuid.New(), uuid.New(), uuid.New()
+	api.serveEvents(
+		messageEvent(tenantID, endpointID, messageID, "position"),
+		fileEvent(api, tenantID, endpointID, []uuid.UUID{uuid.New()}, "taskdata"),
+	)
+	client := api.client()
+	var archive syncBuffer
+	recorder := agrirouter.NewEventRecorder(&archive, agrirouter.WithRecordedPayloads())
+
+	run := startReceiving(t, func(ctx context.Context, errorHandler func(err error)) error {
+		return client.ReceiveEvents(ctx, nil, agrirouter.EventHandlers{
+			OnMessage: func(context.Context, *agrirouter.Message) {},
+			ProcessFile: func(_ context.Context, file *agrirouter.File) error {
+				_, err := io.ReadFull(file.Payload, make([]byte, 4))
+				return err
+			},
+		}, errorHandler, agrirouter.WithRecorder(recorder))
+	})
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		assert.Equal(c, 3, strings.Count(archive.String(), "\n"), "two events and the file payload")
+	}, 5*time.Second, 10*time.Millisecond)
+	run.stop()
+	assert.Empty(t, run.reported())
+
+	var messages []*agrirouter.Message
+	var files []string
+	var reported []error
+	err := agrirouter.Replay(context.Background(), strings.NewReader(archive.String()), agrirouter.EventHandlers{
+		OnMessage: func(_ context.Context, message *agrirouter.Message) {
+			messages = append(messages, message)
+		},
+		OnFile: func(_ context.Context, file *agrirouter.File) {
+			payload, err := io.ReadAll(file.Payload)
+			require.NoError(t, err)
+			files = append(files, string(payload))
+		},
+	}, func(err error) { reported = append(reported, err) })
+
+	require.NoError(t, err)
+	assert.Empty(t, reported)
+	require.Len(t, messages, 1)
+	assert.Equal(t, messageID, messages[0].ID)
+	assert.Equal(t, "position", string(messages[0].Payload))
+	assert.Equal(t, []string{"taskdata"}, files, "the whole payload is recorded although only partially read")
+}
+
+func TestReplay_PacesEvents(t *testing.T) {
+	start := time.Now()
+	tenantID, endpointID := uuid.New(), uuid.New()
+	archive := eventRecord(t, messageEvent(tenantID, endpointID, uuid.New(), "1"), start) +
+		eventRecord(t, messageEvent(tenantID, endpointID, uuid.New(), "2"), start.Add(200*time.Millisecond))
+	var payloads []string
+	handlers := agrirouter.EventHandlers{
+		OnMessage: func(_ context.Context, message *agrirouter.Message) {
+			payloads = append(payloads, string(message.Payload))
+		},
+	}
+	noErrors := func(err error) { assert.NoError(t, err) }
+
+	began := time.Now()
+	require.NoError(t, agrirouter.Replay(context.Background(), strings.NewReader(archive), handlers, noErrors,
+		agrirouter.WithReplaySpeed(2)))
+	assert.GreaterOrEqual(t, time.Since(began), 100*time.Millisecond)
+
+	began = time.Now()
+	require.NoError(t, agrirouter.Replay(context.Background(), strings.NewReader(archive), handlers, noErrors))
+	assert.Less(t, time.Since(began), 100*time.Millisecond)
+	assert.Equal(t, []string{"1", "2", "1", "2"}, payloads)
+}
+
+func TestReplay_ReportsMissingPayloads(t *testing.T) {
+	api := newFakeAPI(t)
+	archive := eventRecord(t, fileEvent(api, uuid.New(), uuid.New(), []uuid.UUID{uuid.New()}, "not recorded"), time.Now())
+	var reported []error
+
+	err := agrirouter.Replay(context.Background(), strings.NewReader(archive), agrirouter.EventHandlers{
+		OnFile: func(context.Context, *agrirouter.File) { t.Fatal("file without payload must not be handled") },
+	}, func(err error) { reported = append(reported, err) })
+
+	require.NoError(t, err)
+	require.Len(t, reported, 1)
+	assert.ErrorIs(t, reported[0], agrirouter.ErrUnexpectedStatusCodeWhenFetchingPayload)
+	assert.Empty(t, api.recorded(), "replays run offline")
+
+	err = agrirouter.Replay(context.Background(), strings.NewReader("{"), agrirouter.EventHandlers{}, nil)
+	assert.ErrorIs(t, err, agrirouter.ErrInvalidArchive)
+}
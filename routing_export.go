@@ -0,0 +1,153 @@
+package agrirouter
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Filter returns a graph with the endpoints of g and only those routes whose
+// message type matches one of messageTypes, which are patterns as in
+// [MessageRoute.MessageType]. Without messageTypes, g is returned.
+func (g *RoutingGraph) Filter(messageTypes ...string) *RoutingGraph {
+	if len(messageTypes) == 0 {
+		return g
+	}
+	filtered := &RoutingGraph{endpoints: g.endpoints, index: g.index}
+	for _, edge := range g.edges {
+		if slices.ContainsFunc(messageTypes, func(pattern string) bool {
+			_, ok := messageTypeScore(pattern, edge.MessageType)
+			return ok
+		}) {
+			filtered.edges = append(filtered.edges, edge)
+		}
+	}
+	return filtered
+}
+
+// WriteDOT renders g as Graphviz DOT graph to w, f.e to be rendered with
+// "dot -Tsvg". Nodes are labelled with the name, type and ownership of the
+// endpoints, edges with the routed message types.
+func (g *RoutingGraph) WriteDOT(w io.Writer) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintln(out, "digraph routes {")
+	fmt.Fprintln(out, "  rankdir=LR;")
+	fmt.Fprintln(out, "  node [shape=box];")
+	for _, node := range g.nodes() {
+		style := ""
+		if node.owned {
+			style = ", style=bold"
+		}
+		fmt.Fprintf(out, "  %s [label=%s%s];\n", dotQuote(node.id.String()), dotQuote(strings.Join(node.label(), "\n")), style)
+	}
+	for _, edge := range g.groupedEdges() {
+		fmt.Fprintf(out, "  %s -> %s [label=%s];\n",
+			dotQuote(edge.from.String()), dotQuote(edge.to.String()), dotQuote(strings.Join(edge.messageTypes, "\n")))
+	}
+	fmt.Fprintln(out, "}")
+	return out.Flush()
+}
+
+// WriteMermaid renders g as Mermaid flowchart to w, f.e to be embedded into
+// Markdown. Nodes and edges are labelled as by [RoutingGraph.WriteDOT].
+func (g *RoutingGraph) WriteMermaid(w io.Writer) error {
+	out := bufio.NewWriter(w)
+	fmt.Fprintln(out, "flowchart LR")
+	ids := map[uuid.UUID]string{}
+	for i, node := range g.nodes() {
+		ids[node.id] = fmt.Sprintf("e%d", i)
+		open, closing := "[", "]"
+		if node.owned {
+			open, closing = "[[", "]]"
+		}
+		fmt.Fprintf(out, "  %s%s%s%s\n", ids[node.id], open, mermaidQuote(node.label()), closing)
+	}
+	for _, edge := range g.groupedEdges() {
+		fmt.Fprintf(out, "  %s -->|%s| %s\n", ids[edge.from], mermaidQuote(edge.messageTypes), ids[edge.to])
+	}
+	return out.Flush()
+}
+
+// routeNode is an endpoint as rendered by the exporters.
+type routeNode struct {
+	id           uuid.UUID
+	name         string
+	endpointType EndpointType
+	owned        bool
+	listed       bool
+}
+
+func (n *routeNode) label() []string {
+	if !n.listed {
+		return []string{n.id.String(), "not listed"}
+	}
+	label := []string{n.name, string(n.endpointType)}
+	if n.owned {
+		label = append(label, "owned by your application")
+	}
+	return label
+}
+
+// nodes returns the listed endpoints followed by endpoints only known from
+// routes.
+func (g *RoutingGraph) nodes() []*routeNode {
+	nodes := make([]*routeNode, 0, len(g.endpoints))
+	for _, endpoint := range g.endpoints {
+		nodes = append(nodes, &routeNode{
+			id:           endpoint.Id,
+			name:         endpoint.Name,
+			endpointType: endpoint.EndpointType,
+			owned:        endpoint.OwnedByYourApplication,
+			listed:       true,
+		})
+	}
+	var unlisted []uuid.UUID
+	for _, edge := range g.edges {
+		for _, id := range []uuid.UUID{edge.From, edge.To} {
+			if _, ok := g.index[id]; !ok && !slices.Contains(unlisted, id) {
+				unlisted = append(unlisted, id)
+			}
+		}
+	}
+	slices.SortFunc(unlisted, g.compareEndpoints)
+	for _, id := range unlisted {
+		nodes = append(nodes, &routeNode{id: id})
+	}
+	return nodes
+}
+
+// routeEdgeGroup holds all message types routed from one endpoint to another.
+type routeEdgeGroup struct {
+	from, to     uuid.UUID
+	messageTypes []string
+}
+
+// groupedEdges returns the edges of g grouped by their endpoints, keeping the
+// order of the edges.
+func (g *RoutingGraph) groupedEdges() []*routeEdgeGroup {
+	var groups []*routeEdgeGroup
+	for _, edge := range g.edges {
+		if n := len(groups); n > 0 && groups[n-1].from == edge.From && groups[n-1].to == edge.To {
+			groups[n-1].messageTypes = append(groups[n-1].messageTypes, edge.MessageType)
+			continue
+		}
+		groups = append(groups, &routeEdgeGroup{from: edge.From, to: edge.To, messageTypes: []string{edge.MessageType}})
+	}
+	return groups
+}
+
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+func mermaidQuote(lines []string) string {
+	escaped := make([]string, len(lines))
+	for i, line := range lines {
+		escaped[i] = strings.NewReplacer(`"`, "#quot;", "<", "#lt;", ">", "#gt;").Replace(line)
+	}
+	return `"` + strings.Join(escaped, "<br/>") + `"`
+}
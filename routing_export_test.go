@@ -0,0 +1,50 @@
+package agrirouter_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/DKE-Data/agrirouter-sdk-go"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoutingGraph_WriteDOT(t *testing.T) {
+	r := newRoutedEndpoints()
+	var out strings.Builder
+
+	require.NoError(t, agrirouter.NewRoutingGraph(r.endpoints).WriteDOT(&out))
+
+	dot := out.String()
+	assert.True(t, strings.HasPrefix(dot, "digraph routes {\n"))
+	assert.Contains(t, dot, `"`+r.fms.String()+`" [label="FMS\ncloud_software\nowned by your application", style=bold];`)
+	assert.Contains(t, dot, `"`+r.tracker.String()+`" [label="Tracker\nvirtual_communication_unit"];`)
+	assert.Contains(t, dot, `"`+r.terminal.String()+`" -> "`+r.fms.String()+
+		`" [label="gps:info\niso:11783:-10:device_description:protobuf"];`)
+	assert.Contains(t, dot, `"`+r.fms.String()+`" -> "`+r.terminal.String()+`" [label="iso:11783:-10:taskdata:zip"];`)
+	assert.True(t, strings.HasSuffix(dot, "}\n"))
+}
+
+func TestRoutingGraph_WriteMermaid(t *testing.T) {
+	r := newRoutedEndpoints()
+	unlisted := uuid.New()
+	routes := agrirouter.EndpointRouteMap{unlisted.String(): {"doc:pdf"}}
+	r.endpoints[0].Name = `"Main" FMS`
+	r.endpoints[0].RoutedEndpoints.CanSendTo = &routes
+	var out strings.Builder
+
+	require.NoError(t, agrirouter.NewRoutingGraph(r.endpoints).Filter("gps:*", "doc:pdf").WriteMermaid(&out))
+
+	assert.Equal(t, strings.Join([]string{
+		"flowchart LR",
+		`  e0[["#quot;Main#quot; FMS<br/>cloud_software<br/>owned by your application"]]`,
+		`  e1["Terminal<br/>virtual_communication_unit"]`,
+		`  e2["Tracker<br/>virtual_communication_unit"]`,
+		`  e3["` + unlisted.String() + `<br/>not listed"]`,
+		`  e0 -->|"doc:pdf"| e3`,
+		`  e1 -->|"gps:info"| e0`,
+		`  e2 -->|"gps:info"| e0`,
+		"",
+	}, "\n"), out.String())
+}
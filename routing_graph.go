@@ -0,0 +1,204 @@
+package agrirouter
+
+import (
+	"cmp"
+	"context"
+	"slices"
+
+	"github.com/google/uuid"
+)
+
+// RouteEdge is a route from one endpoint to another for a message type, see
+// [RoutingGraph].
+type RouteEdge struct {
+	From        uuid.UUID // From is the agrirouter ID of the sending endpoint
+	To          uuid.UUID // To is the agrirouter ID of the receiving endpoint
+	MessageType string    // MessageType is the routed message type
+}
+
+// UnroutedCapability is a capability of an endpoint that no route exists
+// for, see [RoutingGraph.UnroutedCapabilities].
+type UnroutedCapability struct {
+	EndpointID  uuid.UUID                   // EndpointID is the agrirouter ID of the endpoint
+	Direction   EndpointCapabilityDirection // Direction is either [CapabilityDirectionSend] or [CapabilityDirectionReceive]
+	MessageType string                      // MessageType is the message type of the capability
+}
+
+// RoutingGraph is the graph of routes between the endpoints of a tenant, as
+// reported in [TenantEndpointInfo.RoutedEndpoints] of the endpoints owned by
+// the application. Only routes of owned endpoints are known, so every edge
+// starts or ends at an owned endpoint.
+//
+// Graphs are immutable and safe for concurrent use.
+type RoutingGraph struct {
+	endpoints []TenantEndpointInfo
+	index     map[uuid.UUID]int
+	edges     []RouteEdge
+}
+
+// NewRoutingGraph creates the [RoutingGraph] of the endpoints of a tenant, f.e
+// as listed by [Client.ListTenantEndpoints]. Route map keys that are not valid
+// endpoint IDs are ignored.
+func NewRoutingGraph(endpoints []TenantEndpointInfo) *RoutingGraph {
+	g := &RoutingGraph{
+		endpoints: endpoints,
+		index:     make(map[uuid.UUID]int, len(endpoints)),
+	}
+	for i, endpoint := range endpoints {
+		g.index[endpoint.Id] = i
+	}
+	seen := map[RouteEdge]bool{}
+	add := func(edge RouteEdge) {
+		if !seen[edge] {
+			seen[edge] = true
+			g.edges = append(g.edges, edge)
+		}
+	}
+	for _, endpoint := range endpoints {
+		if endpoint.RoutedEndpoints == nil {
+			continue
+		}
+		forEachRoute(endpoint.RoutedEndpoints.CanSendTo, func(peerID uuid.UUID, messageType string) {
+			add(RouteEdge{From: endpoint.Id, To: peerID, MessageType: messageType})
+		})
+		forEachRoute(endpoint.RoutedEndpoints.CanReceiveFrom, func(peerID uuid.UUID, messageType string) {
+			add(RouteEdge{From: peerID, To: endpoint.Id, MessageType: messageType})
+		})
+	}
+	slices.SortFunc(g.edges, func(a, b RouteEdge) int {
+		return cmp.Or(
+			g.compareEndpoints(a.From, b.From),
+			g.compareEndpoints(a.To, b.To),
+			cmp.Compare(a.MessageType, b.MessageType),
+		)
+	})
+	return g
+}
+
+// RoutingGraph returns the [RoutingGraph] of the endpoints currently listed
+// in tenantID.
+func (c *Client) RoutingGraph(ctx context.Context, tenantID uuid.UUID) (*RoutingGraph, error) {
+	endpoints, err := c.ListTenantEndpoints(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	return NewRoutingGraph(endpoints), nil
+}
+
+func forEachRoute(routes *EndpointRouteMap, f func(peerID uuid.UUID, messageType string)) {
+	if routes == nil {
+		return
+	}
+	for peer, messageTypes := range *routes {
+		peerID, err := uuid.Parse(peer)
+		if err != nil {
+			continue
+		}
+		for _, messageType := range messageTypes {
+			f(peerID, messageType)
+		}
+	}
+}
+
+// compareEndpoints orders endpoints as listed, followed by endpoints only
+// known from routes ordered by ID.
+func (g *RoutingGraph) compareEndpoints(a, b uuid.UUID) int {
+	position := func(id uuid.UUID) int {
+		if i, ok := g.index[id]; ok {
+			return i
+		}
+		return len(g.endpoints)
+	}
+	return cmp.Or(cmp.Compare(position(a), position(b)), cmp.Compare(a.String(), b.String()))
+}
+
+// Endpoints returns the endpoints of the graph in the order they were listed.
+func (g *RoutingGraph) Endpoints() []TenantEndpointInfo {
+	return slices.Clone(g.endpoints)
+}
+
+// Endpoint returns the endpoint with id, or false if it is not listed.
+func (g *RoutingGraph) Endpoint(id uuid.UUID) (*TenantEndpointInfo, bool) {
+	i, ok := g.index[id]
+	if !ok {
+		return nil, false
+	}
+	return &g.endpoints[i], true
+}
+
+// Edges returns all routes, ordered by sending and receiving endpoint as
+// listed and by message type.
+func (g *RoutingGraph) Edges() []RouteEdge {
+	return slices.Clone(g.edges)
+}
+
+// Receivers returns the endpoints that receive messages of messageType sent
+// by senderID, in the order they were listed.
+func (g *RoutingGraph) Receivers(senderID uuid.UUID, messageType string) []uuid.UUID {
+	var receivers []uuid.UUID
+	for _, edge := range g.edges {
+		if edge.From == senderID && edge.MessageType == messageType && !slices.Contains(receivers, edge.To) {
+			receivers = append(receivers, edge.To)
+		}
+	}
+	return receivers
+}
+
+// Senders returns the endpoints whose messages of messageType are received by
+// receiverID, in the order they were listed.
+func (g *RoutingGraph) Senders(receiverID uuid.UUID, messageType string) []uuid.UUID {
+	var senders []uuid.UUID
+	for _, edge := range g.edges {
+		if edge.To == receiverID && edge.MessageType == messageType && !slices.Contains(senders, edge.From) {
+			senders = append(senders, edge.From)
+		}
+	}
+	return senders
+}
+
+// UnroutedCapabilities returns the capabilities of the endpoints owned by the
+// application that no route exists for: message types an endpoint can send
+// but no endpoint receives from it, and message types it can receive but no
+// endpoint sends to it.
+func (g *RoutingGraph) UnroutedCapabilities() []UnroutedCapability {
+	var unrouted []UnroutedCapability
+	for _, endpoint := range g.endpoints {
+		if !endpoint.OwnedByYourApplication {
+			continue
+		}
+		for _, messageType := range endpoint.Capabilities.CanSend {
+			if len(g.Receivers(endpoint.Id, messageType)) == 0 {
+				unrouted = append(unrouted, UnroutedCapability{
+					EndpointID:  endpoint.Id,
+					Direction:   CapabilityDirectionSend,
+					MessageType: messageType,
+				})
+			}
+		}
+		for _, messageType := range endpoint.Capabilities.CanReceive {
+			if len(g.Senders(endpoint.Id, messageType)) == 0 {
+				unrouted = append(unrouted, UnroutedCapability{
+					EndpointID:  endpoint.Id,
+					Direction:   CapabilityDirectionReceive,
+					MessageType: messageType,
+				})
+			}
+		}
+	}
+	return unrouted
+}
+
+// DeadSubscriptions returns the message types of subscriptions of the
+// endpoint endpointID that no endpoint routes messages to it for, so that it
+// will not receive published messages of these types. Subscriptions are not
+// part of the listed endpoints, pass those the endpoint was put with, see
+// [PutEndpointRequest].
+func (g *RoutingGraph) DeadSubscriptions(endpointID uuid.UUID, subscriptions []EndpointSubscription) []string {
+	var dead []string
+	for _, subscription := range subscriptions {
+		if len(g.Senders(endpointID, subscription.MessageType)) == 0 && !slices.Contains(dead, subscription.MessageType) {
+			dead = append(dead, subscription.MessageType)
+		}
+	}
+	return dead
+}
@@ -0,0 +1,96 @@
+package agrirouter_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DKE-Data/agrirouter-sdk-go"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// routedEndpoints is a tenant with an owned farm management system that sends
+// task data to a terminal and receives positions from it and a tracker, while
+// the tracker is not routed to anything else.
+type routedEndpoints struct {
+	fms, terminal, tracker uuid.UUID
+	endpoints              []agrirouter.TenantEndpointInfo
+}
+
+func newRoutedEndpoints() *routedEndpoints {
+	r := &routedEndpoints{fms: uuid.New(), terminal: uuid.New(), tracker: uuid.New()}
+	sendTo := agrirouter.EndpointRouteMap{r.terminal.String(): {"iso:11783:-10:taskdata:zip"}, "invalid": {"gps:info"}}
+	receiveFrom := agrirouter.EndpointRouteMap{
+		r.terminal.String(): {"gps:info", "iso:11783:-10:device_description:protobuf"},
+		r.tracker.String():  {"gps:info"},
+	}
+	r.endpoints = []agrirouter.TenantEndpointInfo{
+		{
+			Id:                     r.fms,
+			Name:                   "FMS",
+			EndpointType:           agrirouter.CloudSoftware,
+			OwnedByYourApplication: true,
+			Capabilities: agrirouter.TenantEndpointCapabilities{
+				CanSend:    []string{"iso:11783:-10:taskdata:zip", "img:png"},
+				CanReceive: []string{"gps:info", "doc:pdf"},
+			},
+			RoutedEndpoints: &agrirouter.RoutedEndpoints{CanSendTo: &sendTo, CanReceiveFrom: &receiveFrom},
+		},
+		{
+			Id:           r.terminal,
+			Name:         "Terminal",
+			EndpointType: agrirouter.VirtualCommunicationUnit,
+			Capabilities: agrirouter.TenantEndpointCapabilities{CanSend: []string{"gps:info"}},
+		},
+		{Id: r.tracker, Name: "Tracker", EndpointType: agrirouter.VirtualCommunicationUnit},
+	}
+	return r
+}
+
+func TestRoutingGraph_Queries(t *testing.T) {
+	r := newRoutedEndpoints()
+	graph := agrirouter.NewRoutingGraph(r.endpoints)
+
+	assert.Equal(t, []agrirouter.RouteEdge{
+		{From: r.fms, To: r.terminal, MessageType: "iso:11783:-10:taskdata:zip"},
+		{From: r.terminal, To: r.fms, MessageType: "gps:info"},
+		{From: r.terminal, To: r.fms, MessageType: "iso:11783:-10:device_description:protobuf"},
+		{From: r.tracker, To: r.fms, MessageType: "gps:info"},
+	}, graph.Edges(), "invalid endpoint IDs are ignored")
+
+	assert.Equal(t, []uuid.UUID{r.terminal}, graph.Receivers(r.fms, "iso:11783:-10:taskdata:zip"))
+	assert.Empty(t, graph.Receivers(r.fms, "img:png"))
+	assert.Equal(t, []uuid.UUID{r.terminal, r.tracker}, graph.Senders(r.fms, "gps:info"))
+	assert.Empty(t, graph.Senders(r.terminal, "gps:info"))
+
+	endpoint, ok := graph.Endpoint(r.terminal)
+	require.True(t, ok)
+	assert.Equal(t, "Terminal", endpoint.Name)
+	_, ok = graph.Endpoint(uuid.New())
+	assert.False(t, ok)
+
+	assert.Equal(t, []agrirouter.UnroutedCapability{
+		{EndpointID: r.fms, Direction: agrirouter.CapabilityDirectionSend, MessageType: "img:png"},
+		{EndpointID: r.fms, Direction: agrirouter.CapabilityDirectionReceive, MessageType: "doc:pdf"},
+	}, graph.UnroutedCapabilities(), "only capabilities of owned endpoints are checked")
+
+	assert.Equal(t, []string{"doc:pdf"}, graph.DeadSubscriptions(r.fms, []agrirouter.EndpointSubscription{
+		{MessageType: "gps:info"},
+		{MessageType: "doc:pdf"},
+		{MessageType: "doc:pdf"},
+	}))
+}
+
+func TestClient_RoutingGraph(t *testing.T) {
+	api := newFakeAPI(t)
+	f := newRoutingFixture(t, api, "gps:info")
+
+	graph, err := api.client().RoutingGraph(context.Background(), f.tenantID)
+	require.NoError(t, err)
+
+	assert.Len(t, graph.Endpoints(), 4)
+	assert.Equal(t, []uuid.UUID{f.routed}, graph.Receivers(f.sender, "gps:info"))
+	assert.Equal(t, []uuid.UUID{f.sender}, graph.Senders(f.routed, "gps:info"))
+	assert.Empty(t, graph.Senders(f.unrouted, "gps:info"))
+}
@@ -0,0 +1,263 @@
+package agrirouter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// ContextIDMaxLength is the maximum length of the context ID accepted by
+	// the agrirouter API in the x-agrirouter-context-id header.
+	ContextIDMaxLength = 50
+
+	// MessageTypeMaxLength is the maximum length of the message type accepted
+	// by the agrirouter API in the x-agrirouter-message-type header.
+	MessageTypeMaxLength = 100
+
+	// TeamsetContextIDMaxLength is the maximum length of the teamset context ID
+	// accepted by the agrirouter API in the x-agrirouter-teamset-context-id header.
+	TeamsetContextIDMaxLength = 100
+)
+
+var (
+	// ErrInvalidSendOptions is returned by [Client.Send] when the given options
+	// would be rejected by agrirouter, f.e because a required value is missing.
+	ErrInvalidSendOptions = errors.New("invalid send options")
+
+	// ErrFailedToDetermineContentLength is returned by [Client.Send] when the
+	// length of the payload could not be determined.
+	ErrFailedToDetermineContentLength = errors.New("failed to determine content length")
+)
+
+// SendOptions describe a message to be sent with [Client.Send].
+//
+// Only TenantID, EndpointID and MessageType are required, all other values
+// are either optional or derived automatically when left empty.
+type SendOptions struct {
+	// TenantID is the tenant in which the message is sent.
+	TenantID uuid.UUID
+	// EndpointID is the agrirouter ID of the sending endpoint.
+	EndpointID uuid.UUID
+	// MessageType is the URN type of the message, f.e "iso:11783:-10:taskdata:zip".
+	MessageType string
+	// ContextID identifies the sent payload, at most [ContextIDMaxLength]
+	// characters long. A random one is generated when empty. Reuse the same
+	// context ID when resending the same payload, f.e on retries.
+	ContextID string
+	// IsPublish sends the message to all endpoints subscribed to the message type.
+	IsPublish bool
+	// DirectRecipients are the agrirouter IDs of endpoints that should receive
+	// the message even if they are not subscribed to the message type.
+	DirectRecipients []uuid.UUID
+	// Filename is an optional file name attached to the message as metadata.
+	// Names longer than [FilenameMaxLength] are truncated, keeping the extension.
+	Filename string
+	// TeamsetContextID is an optional teamset context ID.
+	TeamsetContextID string
+	// ContentLength is the size of the payload in bytes. When zero or negative,
+	// it is determined from the body, see [Client.Send].
+	ContentLength int64
+	// SentAt is the client side sending timestamp, defaults to the current time.
+	SentAt time.Time
+	// RequireRoute makes [Client.Send] check the routes of the tenant before
+	// sending and fail with [ErrNoRoute] if no endpoint would receive the
+	// message, see [Client.PlanSend]. This costs an additional API call.
+	RequireRoute bool
+	// OnProgress is optionally called while the payload is uploaded, see
+	// [ProgressReader]. It is not persisted, f.e by an [Outbox].
+	OnProgress ProgressFunc `json:"-"`
+}
+
+// Publish returns a copy of the options with publishing enabled, so that
+// the message is routed to all endpoints subscribed to its message type.
+func (o SendOptions) Publish() SendOptions {
+	o.IsPublish = true
+	return o
+}
+
+// DirectTo returns a copy of the options with recipients added to the
+// direct recipients of the message.
+func (o SendOptions) DirectTo(recipients ...uuid.UUID) SendOptions {
+	o.DirectRecipients = append(append([]uuid.UUID(nil), o.DirectRecipients...), recipients...)
+	return o
+}
+
+func (o *SendOptions) validate() error {
+	switch {
+	case o.TenantID == uuid.Nil:
+		return fmt.Errorf("%w: tenant ID is required", ErrInvalidSendOptions)
+	case o.EndpointID == uuid.Nil:
+		return fmt.Errorf("%w: endpoint ID is required", ErrInvalidSendOptions)
+	case o.MessageType == "":
+		return fmt.Errorf("%w: message type is required", ErrInvalidSendOptions)
+	case utf8.RuneCountInString(o.MessageType) > MessageTypeMaxLength:
+		return fmt.Errorf("%w: message type is longer than %d characters", ErrInvalidSendOptions, MessageTypeMaxLength)
+	case utf8.RuneCountInString(o.ContextID) > ContextIDMaxLength:
+		return fmt.Errorf("%w: context ID is longer than %d characters", ErrInvalidSendOptions, ContextIDMaxLength)
+	case utf8.RuneCountInString(o.TeamsetContextID) > TeamsetContextIDMaxLength:
+		return fmt.Errorf("%w: teamset context ID is longer than %d characters", ErrInvalidSendOptions, TeamsetContextIDMaxLength)
+	}
+	return nil
+}
+
+// params converts the options to the parameters of [Client.SendMessages].
+func (o *SendOptions) params() *SendMessagesParams {
+	params := &SendMessagesParams{
+		ContentLength:            o.ContentLength,
+		XAgrirouterIsPublish:     o.IsPublish,
+		XAgrirouterSentTimestamp: o.SentAt,
+		XAgrirouterEndpointId:    o.EndpointID,
+		XAgrirouterMessageType:   o.MessageType,
+		XAgrirouterTenantId:      o.TenantID,
+		XAgrirouterContextId:     o.ContextID,
+	}
+	if len(o.DirectRecipients) > 0 {
+		recipients := append([]uuid.UUID(nil), o.DirectRecipients...)
+		params.XAgrirouterDirectRecipients = &recipients
+	}
+	if o.Filename != "" {
+		filename := truncateFilename(o.Filename)
+		params.XAgrirouterFilename = &filename
+	}
+	if o.TeamsetContextID != "" {
+		teamsetContextID := o.TeamsetContextID
+		params.XAgrirouterTeamsetContextId = &teamsetContextID
+	}
+	return params
+}
+
+// SendReceipt describes a message accepted by agrirouter.
+//
+// It can be used to correlate the sent payload with messages received later,
+// as agrirouter derives the application message IDs of the sent messages from
+// the context ID by appending the index of the chunk.
+type SendReceipt struct {
+	// ContextID is the context ID the payload was sent with.
+	ContextID string
+	// AppMessageIDPrefix is the prefix of the application message IDs that
+	// agrirouter assigns to the messages carrying the payload.
+	AppMessageIDPrefix string
+	// ContentLength is the size of the sent payload in bytes.
+	ContentLength int64
+	// SentAt is the client side sending timestamp the payload was sent with.
+	SentAt time.Time
+}
+
+// MatchesAppMessageID reports whether appMessageID, as found in
+// [Message.AppMessageID], belongs to the payload described by the receipt.
+func (r *SendReceipt) MatchesAppMessageID(appMessageID string) bool {
+	return strings.HasPrefix(appMessageID, r.AppMessageIDPrefix)
+}
+
+// Send sends the payload read from body as an agrirouter message.
+//
+// Unlike [Client.SendMessages], it fills in the technical request headers:
+// the sending timestamp, a context ID if none was given, and the content
+// length. The content length is taken from opts if set, otherwise from the
+// Len method of body (as provided by [bytes.Reader] and similar types), from
+// the Stat method of body (as provided by [os.File]) or, as a last resort,
+// by spooling body into a temporary file.
+//
+// On success, the returned [SendReceipt] describes the sent payload.
+func (c *Client) Send(ctx context.Context, opts SendOptions, body io.Reader) (*SendReceipt, error) {
+	if opts.ContextID == "" {
+		opts.ContextID = uuid.NewString()
+	}
+	if opts.SentAt.IsZero() {
+		opts.SentAt = time.Now()
+	}
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	if opts.RequireRoute {
+		if err := c.requireRoute(ctx, &opts); err != nil {
+			return nil, err
+		}
+	}
+	if opts.ContentLength <= 0 {
+		length, sized, cleanup, err := contentLength(body)
+		if err != nil {
+			return nil, err
+		}
+		defer cleanup()
+		opts.ContentLength = length
+		body = sized
+	}
+	if opts.OnProgress != nil {
+		body = NewProgressReader(body, opts.ContentLength, opts.OnProgress)
+	}
+
+	if err := c.SendMessages(ctx, opts.params(), body); err != nil {
+		return nil, err
+	}
+	return &SendReceipt{
+		ContextID:          opts.ContextID,
+		AppMessageIDPrefix: opts.ContextID + "-",
+		ContentLength:      opts.ContentLength,
+		SentAt:             opts.SentAt,
+	}, nil
+}
+
+// contentLength determines the number of bytes remaining in body.
+//
+// It returns a reader to be used instead of body, as well as a cleanup function
+// that must be called once the returned reader is not needed anymore.
+func contentLength(body io.Reader) (int64, io.Reader, func(), error) {
+	noop := func() {}
+	switch b := body.(type) {
+	case interface{ Len() int }:
+		return int64(b.Len()), body, noop, nil
+	case interface{ Stat() (fs.FileInfo, error) }:
+		info, err := b.Stat()
+		if err != nil {
+			return 0, nil, noop, fmt.Errorf("%w: %w", ErrFailedToDetermineContentLength, err)
+		}
+		if info.Mode().IsRegular() {
+			offset, err := currentOffset(body)
+			if err != nil {
+				return 0, nil, noop, fmt.Errorf("%w: %w", ErrFailedToDetermineContentLength, err)
+			}
+			return info.Size() - offset, body, noop, nil
+		}
+	}
+	return spool(body)
+}
+
+func currentOffset(body io.Reader) (int64, error) {
+	seeker, ok := body.(io.Seeker)
+	if !ok {
+		return 0, nil
+	}
+	return seeker.Seek(0, io.SeekCurrent)
+}
+
+// spool copies body into a temporary file, which is removed by the returned
+// cleanup function.
+func spool(body io.Reader) (int64, io.Reader, func(), error) {
+	file, err := os.CreateTemp("", "agrirouter-spool-*")
+	if err != nil {
+		return 0, nil, func() {}, fmt.Errorf("%w: %w", ErrFailedToDetermineContentLength, err)
+	}
+	cleanup := func() {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+	}
+	length, err := io.Copy(file, body)
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		cleanup()
+		return 0, nil, func() {}, fmt.Errorf("%w: %w", ErrFailedToDetermineContentLength, err)
+	}
+	return length, file, cleanup, nil
+}
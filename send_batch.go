@@ -0,0 +1,364 @@
+package agrirouter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultBatchConcurrency = 4
+	defaultBatchMaxAttempts = 3
+	defaultBatchMinBackoff  = time.Second
+	defaultBatchMaxBackoff  = 30 * time.Second
+)
+
+var (
+	// ErrBatchAborted is returned by [Client.SendBatch] when sending was
+	// stopped early because agrirouter rejected the credentials of the client.
+	ErrBatchAborted = errors.New("batch aborted")
+
+	// ErrBatchItemSkipped is the error of batch items that were not sent
+	// because the batch was aborted or its context was canceled before.
+	ErrBatchItemSkipped = errors.New("batch item skipped")
+)
+
+// BatchItem is a single message sent by [Client.SendBatch].
+type BatchItem struct {
+	// Options describe the message, see [Client.Send].
+	Options SendOptions
+	// Open returns the payload of the message. It is called once per attempt,
+	// so it must return the complete payload every time. If the returned
+	// reader implements [io.Closer], it is closed after the attempt.
+	Open func() (io.Reader, error)
+}
+
+// BatchItemFromBytes returns a [BatchItem] sending data as payload.
+func BatchItemFromBytes(opts SendOptions, data []byte) BatchItem {
+	return BatchItem{
+		Options: opts,
+		Open: func() (io.Reader, error) {
+			return bytes.NewReader(data), nil
+		},
+	}
+}
+
+// BatchItemFromFile returns a [BatchItem] sending the content of the file at
+// path as payload, which is only opened when the item is sent. Like
+// [Client.SendFile], the base name of path is used as the file name if none
+// is set in opts.
+func BatchItemFromFile(opts SendOptions, path string) BatchItem {
+	if opts.Filename == "" {
+		opts.Filename = filepath.Base(path)
+	}
+	return BatchItem{
+		Options: opts,
+		Open: func() (io.Reader, error) {
+			file, err := os.Open(path)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrFailedToOpenFile, err)
+			}
+			return file, nil
+		},
+	}
+}
+
+// BatchOptions configure [Client.SendBatch]. The zero value is valid and uses
+// the documented defaults.
+type BatchOptions struct {
+	// Concurrency is the maximum number of messages sent at the same time,
+	// defaults to 4.
+	Concurrency int
+	// RatePerTenant limits how many messages per second are sent to each
+	// tenant. Zero or negative values disable rate limiting.
+	RatePerTenant float64
+	// MaxAttempts is how often a message is attempted at most, defaults to 3.
+	MaxAttempts int
+	// MinBackoff and MaxBackoff bound the exponentially growing delay between
+	// attempts of a message, default to 1 and 30 seconds.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// IsPermanent decides whether a send error is permanent, so that the
+	// message is not attempted again. Defaults to [IsPermanentSendError].
+	IsPermanent func(err error) bool
+	// OnProgress is called whenever a message has been sent or has finally
+	// failed. Calls are never made concurrently.
+	OnProgress func(progress BatchProgress)
+}
+
+// BatchProgress describes the progress of [Client.SendBatch].
+type BatchProgress struct {
+	// Total is the number of items in the batch.
+	Total int
+	// Succeeded is the number of items sent so far.
+	Succeeded int
+	// Failed is the number of items that finally failed so far.
+	Failed int
+	// Index is the index of the item that completed.
+	Index int
+	// Err is the error of the completed item, nil if it was sent.
+	Err error
+}
+
+// BatchSuccess is a message of a batch that was sent.
+type BatchSuccess struct {
+	// Index is the index of the item in the batch.
+	Index int
+	// Receipt describes the sent message.
+	Receipt *SendReceipt
+	// Attempts is the number of attempts it took to send the message.
+	Attempts int
+}
+
+// BatchFailure is a message of a batch that could not be sent.
+type BatchFailure struct {
+	// Index is the index of the item in the batch.
+	Index int
+	// Err is the error of the last attempt, or [ErrBatchItemSkipped] if the
+	// message was not attempted. Use [APIStatusCode] or [errors.Is] to
+	// inspect it.
+	Err error
+	// Attempts is the number of attempts made.
+	Attempts int
+}
+
+// BatchResult is the aggregated result of [Client.SendBatch].
+// Successes and failures are ordered by the index of their items.
+type BatchResult struct {
+	Succeeded []BatchSuccess
+	Failed    []BatchFailure
+}
+
+// SendBatch sends many messages with bounded concurrency, rate limiting per
+// tenant and retries per message.
+//
+// Every message is sent with [Client.Send]. Its context ID is fixed before
+// the first attempt, so that retries of the same payload can be recognized
+// by agrirouter. Failures considered permanent are not retried.
+//
+// When agrirouter rejects the credentials of the client (status 401 or 403),
+// no further messages are sent, as all of them would fail the same way.
+// Messages not attempted are reported as failed with [ErrBatchItemSkipped].
+//
+// The returned result is never nil. The error is non-nil only if the batch
+// was aborted, wrapping [ErrBatchAborted], or ctx was canceled.
+func (c *Client) SendBatch(ctx context.Context, items []BatchItem, opts BatchOptions) (*BatchResult, error) {
+	opts.setDefaults()
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	batch := &batchRun{
+		client:   c,
+		opts:     opts,
+		items:    items,
+		outcomes: make([]batchOutcome, len(items)),
+		limiter:  newTenantRateLimiter(opts.RatePerTenant),
+		cancel:   cancel,
+	}
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for range min(opts.Concurrency, len(items)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				batch.send(ctx, i)
+			}
+		}()
+	}
+feed:
+	for i := range items {
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(indexes)
+	wg.Wait()
+
+	return batch.result(), context.Cause(ctx)
+}
+
+func (o *BatchOptions) setDefaults() {
+	if o.Concurrency <= 0 {
+		o.Concurrency = defaultBatchConcurrency
+	}
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = defaultBatchMaxAttempts
+	}
+	if o.MinBackoff <= 0 {
+		o.MinBackoff = defaultBatchMinBackoff
+	}
+	if o.MaxBackoff < o.MinBackoff {
+		o.MaxBackoff = max(defaultBatchMaxBackoff, o.MinBackoff)
+	}
+	if o.IsPermanent == nil {
+		o.IsPermanent = IsPermanentSendError
+	}
+}
+
+type batchOutcome struct {
+	done     bool
+	receipt  *SendReceipt
+	err      error
+	attempts int
+}
+
+type batchRun struct {
+	client   *Client
+	opts     BatchOptions
+	items    []BatchItem
+	limiter  *tenantRateLimiter
+	cancel   context.CancelCauseFunc
+	mu       sync.Mutex
+	outcomes []batchOutcome
+	progress BatchProgress
+}
+
+// send attempts to send the item at index i until it succeeds, fails
+// permanently or runs out of attempts.
+func (b *batchRun) send(ctx context.Context, i int) {
+	item := b.items[i]
+	options := item.Options
+	if options.ContextID == "" {
+		options.ContextID = uuid.NewString()
+	}
+
+	outcome := batchOutcome{done: true}
+	for {
+		if err := b.limiter.wait(ctx, options.TenantID); err != nil {
+			break
+		}
+		outcome.attempts++
+		outcome.receipt, outcome.err = b.attempt(ctx, item, options)
+		if outcome.err == nil || ctx.Err() != nil {
+			break
+		}
+		if isAuthorizationError(outcome.err) {
+			b.cancel(fmt.Errorf("%w: %w", ErrBatchAborted, outcome.err))
+			break
+		}
+		if outcome.attempts >= b.opts.MaxAttempts || b.opts.IsPermanent(outcome.err) {
+			break
+		}
+		if !sleep(ctx, exponentialBackoff(outcome.attempts, b.opts.MinBackoff, b.opts.MaxBackoff)) {
+			break
+		}
+	}
+	if outcome.attempts == 0 {
+		// Stopped before the first attempt, leave the item to be reported as skipped.
+		return
+	}
+	b.complete(i, outcome)
+}
+
+func (b *batchRun) attempt(ctx context.Context, item BatchItem, options SendOptions) (*SendReceipt, error) {
+	body, err := item.Open()
+	if err != nil {
+		return nil, err
+	}
+	if closer, ok := body.(io.Closer); ok {
+		defer func() { _ = closer.Close() }()
+	}
+	return b.client.Send(ctx, options, body)
+}
+
+func (b *batchRun) complete(i int, outcome batchOutcome) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.outcomes[i] = outcome
+	if outcome.err == nil {
+		b.progress.Succeeded++
+	} else {
+		b.progress.Failed++
+	}
+	if b.opts.OnProgress != nil {
+		progress := b.progress
+		progress.Total = len(b.items)
+		progress.Index = i
+		progress.Err = outcome.err
+		b.opts.OnProgress(progress)
+	}
+}
+
+func (b *batchRun) result() *BatchResult {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	result := &BatchResult{}
+	for i, outcome := range b.outcomes {
+		switch {
+		case !outcome.done:
+			result.Failed = append(result.Failed, BatchFailure{Index: i, Err: ErrBatchItemSkipped})
+		case outcome.err != nil:
+			result.Failed = append(result.Failed, BatchFailure{Index: i, Err: outcome.err, Attempts: outcome.attempts})
+		default:
+			result.Succeeded = append(result.Succeeded, BatchSuccess{Index: i, Receipt: outcome.receipt, Attempts: outcome.attempts})
+		}
+	}
+	return result
+}
+
+// isAuthorizationError reports whether err indicates that agrirouter rejected
+// the credentials of the client.
+func isAuthorizationError(err error) bool {
+	status, ok := APIStatusCode(err)
+	return ok && (status == http.StatusUnauthorized || status == http.StatusForbidden)
+}
+
+// sleep waits for d, returning false if ctx is canceled before.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// tenantRateLimiter spaces out calls per tenant, so that at most rate calls
+// per second are made for each tenant.
+type tenantRateLimiter struct {
+	interval time.Duration
+	mu       sync.Mutex
+	next     map[uuid.UUID]time.Time
+}
+
+func newTenantRateLimiter(rate float64) *tenantRateLimiter {
+	limiter := &tenantRateLimiter{next: map[uuid.UUID]time.Time{}}
+	if rate > 0 {
+		limiter.interval = time.Duration(float64(time.Second) / rate)
+	}
+	return limiter
+}
+
+// wait blocks until the next call for tenantID is allowed.
+func (l *tenantRateLimiter) wait(ctx context.Context, tenantID uuid.UUID) error {
+	if l.interval <= 0 {
+		return ctx.Err()
+	}
+	l.mu.Lock()
+	now := time.Now()
+	slot := l.next[tenantID]
+	if slot.Before(now) {
+		slot = now
+	}
+	l.next[tenantID] = slot.Add(l.interval)
+	l.mu.Unlock()
+
+	if !sleep(ctx, slot.Sub(now)) {
+		return ctx.Err()
+	}
+	return nil
+}
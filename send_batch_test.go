@@ -0,0 +1,135 @@
+package agrirouter_test
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DKE-Data/agrirouter-sdk-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newBatchItems(n int) []agrirouter.BatchItem {
+	opts := newSendOptions().Publish()
+	items := make([]agrirouter.BatchItem, n)
+	for i := range items {
+		items[i] = agrirouter.BatchItemFromBytes(opts, []byte{byte('a' + i)})
+	}
+	return items
+}
+
+func TestSendBatch_SendsAllItems(t *testing.T) {
+	api := newFakeAPI(t)
+	path := filepath.Join(t.TempDir(), "data.bin")
+	require.NoError(t, os.WriteFile(path, []byte("file"), 0o600))
+	items := append(newBatchItems(5), agrirouter.BatchItemFromFile(newSendOptions(), path))
+
+	var progress []agrirouter.BatchProgress
+	result, err := api.client().SendBatch(context.Background(), items, agrirouter.BatchOptions{
+		Concurrency: 3,
+		OnProgress: func(p agrirouter.BatchProgress) {
+			progress = append(progress, p)
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Empty(t, result.Failed)
+	require.Len(t, result.Succeeded, 6)
+	for i, success := range result.Succeeded {
+		assert.Equal(t, i, success.Index)
+		assert.Equal(t, 1, success.Attempts)
+	}
+	require.Len(t, api.recorded(), 6)
+	require.Len(t, progress, 6)
+	assert.Equal(t, 6, progress[5].Succeeded)
+	assert.Equal(t, 6, progress[5].Total)
+
+	var fileRequest *recordedRequest
+	for _, request := range api.recorded() {
+		if request.Header.Get("X-Agrirouter-Filename") == "data.bin" {
+			fileRequest = &request
+		}
+	}
+	require.NotNil(t, fileRequest)
+	assert.Equal(t, "file", string(fileRequest.Body))
+}
+
+func TestSendBatch_RetriesTransientFailures(t *testing.T) {
+	api := newFakeAPI(t)
+	var calls atomic.Int32
+	api.handle(http.MethodPost, "/messages", func(w http.ResponseWriter, _ *http.Request) {
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	result, err := api.client().SendBatch(context.Background(), newBatchItems(1), agrirouter.BatchOptions{
+		MinBackoff: time.Millisecond,
+	})
+	require.NoError(t, err)
+	require.Len(t, result.Succeeded, 1)
+	assert.Equal(t, 2, result.Succeeded[0].Attempts)
+
+	requests := api.recorded()
+	require.Len(t, requests, 2)
+	assert.Equal(t,
+		requests[0].Header.Get("X-Agrirouter-Context-Id"),
+		requests[1].Header.Get("X-Agrirouter-Context-Id"),
+		"retries must reuse the context ID",
+	)
+}
+
+func TestSendBatch_DoesNotRetryPermanentFailures(t *testing.T) {
+	api := newFakeAPI(t)
+	api.setDefaultStatus(http.StatusBadRequest)
+
+	result, err := api.client().SendBatch(context.Background(), newBatchItems(2), agrirouter.BatchOptions{
+		MinBackoff: time.Millisecond,
+	})
+	require.NoError(t, err)
+	assert.Empty(t, result.Succeeded)
+	require.Len(t, result.Failed, 2)
+	for _, failure := range result.Failed {
+		assert.Equal(t, 1, failure.Attempts)
+		status, ok := agrirouter.APIStatusCode(failure.Err)
+		assert.True(t, ok)
+		assert.Equal(t, http.StatusBadRequest, status)
+	}
+	assert.Len(t, api.recorded(), 2)
+}
+
+func TestSendBatch_AbortsOnAuthorizationErrors(t *testing.T) {
+	api := newFakeAPI(t)
+	api.setDefaultStatus(http.StatusUnauthorized)
+
+	result, err := api.client().SendBatch(context.Background(), newBatchItems(10), agrirouter.BatchOptions{
+		Concurrency: 1,
+	})
+	require.ErrorIs(t, err, agrirouter.ErrBatchAborted)
+	assert.Empty(t, result.Succeeded)
+	require.Len(t, result.Failed, 10)
+	assert.Equal(t, 1, result.Failed[0].Attempts)
+	for _, failure := range result.Failed[1:] {
+		assert.ErrorIs(t, failure.Err, agrirouter.ErrBatchItemSkipped)
+	}
+	assert.Len(t, api.recorded(), 1)
+}
+
+func TestSendBatch_LimitsRatePerTenant(t *testing.T) {
+	api := newFakeAPI(t)
+
+	start := time.Now()
+	_, err := api.client().SendBatch(context.Background(), newBatchItems(3), agrirouter.BatchOptions{
+		Concurrency:   3,
+		RatePerTenant: 20,
+	})
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+}
@@ -0,0 +1,82 @@
+package agrirouter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"unicode/utf8"
+)
+
+// FilenameMaxLength is the maximum length of the file name accepted by the
+// agrirouter API in the x-agrirouter-filename header.
+const FilenameMaxLength = 100
+
+// ErrFailedToOpenFile is returned by [Client.SendFile] when the file to send
+// cannot be opened or inspected.
+var ErrFailedToOpenFile = errors.New("failed to open file")
+
+// SendFile sends the file at path as an agrirouter message.
+//
+// The file is streamed from disk, its size is used as content length. Unless
+// set in opts, the file name is taken from path and the message type is
+// inferred from the file name and content using the detector configured with
+// [WithMessageTypeDetector], which defaults to [DetectMessageType]. Setting
+// opts.MessageType explicitly skips the inference.
+//
+// See [Client.Send] for the handling of all other options.
+func (c *Client) SendFile(ctx context.Context, path string, opts SendOptions) (*SendReceipt, error) {
+	file, err := os.Open(path) //nolint:gosec // sending arbitrary files chosen by the caller is the purpose here
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFailedToOpenFile, err)
+	}
+	defer func() { _ = file.Close() }()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFailedToOpenFile, err)
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("%w: %s is not a regular file", ErrFailedToOpenFile, path)
+	}
+
+	if opts.Filename == "" {
+		opts.Filename = filepath.Base(path)
+	}
+	if opts.MessageType == "" {
+		opts.MessageType, err = c.messageTypeDetector(opts.Filename, file, info.Size())
+		if err != nil {
+			return nil, err
+		}
+	}
+	opts.ContentLength = info.Size()
+
+	return c.Send(ctx, opts, file)
+}
+
+// truncateFilename shortens filename to at most [FilenameMaxLength] characters.
+//
+// The extension is kept as far as possible, so that the receiving side can
+// still make sense of the file type, and the result is always valid UTF-8.
+func truncateFilename(filename string) string {
+	if utf8.RuneCountInString(filename) <= FilenameMaxLength {
+		return filename
+	}
+	ext := []rune(filepath.Ext(filename))
+	if len(ext) >= FilenameMaxLength/2 {
+		ext = nil
+	}
+	stem := []rune(filename[:len(filename)-len(string(ext))])
+	return string(stem[:FilenameMaxLength-len(ext)]) + string(ext)
+}
+
+// WithMessageTypeDetector allows to replace the detector used by
+// [Client.SendFile] to infer message types. The detector may delegate to
+// [DetectMessageType] for payloads it does not handle itself.
+func WithMessageTypeDetector(detector MessageTypeDetector) ClientOption {
+	return func(c *Client) error {
+		c.messageTypeDetector = detector
+		return nil
+	}
+}
@@ -0,0 +1,99 @@
+package agrirouter_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/DKE-Data/agrirouter-sdk-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTempFile(t *testing.T, name string, content []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, content, 0o600))
+	return path
+}
+
+func TestSendFile_InfersMessageTypeAndFilename(t *testing.T) {
+	api := newFakeAPI(t)
+	content := []byte("%PDF-1.7 report")
+	path := writeTempFile(t, "report.pdf", content)
+
+	opts := newSendOptions().Publish()
+	opts.MessageType = ""
+	receipt, err := api.client().SendFile(context.Background(), path, opts)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(content)), receipt.ContentLength)
+
+	requests := api.recorded()
+	require.Len(t, requests, 1)
+	assert.Equal(t, agrirouter.MessageTypePDF, requests[0].Header.Get("X-Agrirouter-Message-Type"))
+	assert.Equal(t, "report.pdf", requests[0].Header.Get("X-Agrirouter-Filename"))
+	assert.Equal(t, content, requests[0].Body)
+	assert.Equal(t, int64(len(content)), requests[0].ContentLength, "files are not sent chunked")
+}
+
+func TestSendFile_ExplicitMessageTypeOverridesInference(t *testing.T) {
+	api := newFakeAPI(t)
+	path := writeTempFile(t, "report.pdf", []byte("%PDF-1.7"))
+
+	opts := newSendOptions().Publish()
+	opts.MessageType = "custom:type"
+	_, err := api.client().SendFile(context.Background(), path, opts)
+	require.NoError(t, err)
+	assert.Equal(t, "custom:type", api.recorded()[0].Header.Get("X-Agrirouter-Message-Type"))
+}
+
+func TestSendFile_CustomDetector(t *testing.T) {
+	api := newFakeAPI(t)
+	path := writeTempFile(t, "notes.txt", []byte("hello"))
+	client := api.client(agrirouter.WithMessageTypeDetector(
+		func(filename string, content io.ReaderAt, size int64) (string, error) {
+			if strings.HasSuffix(filename, ".txt") {
+				return "doc:txt", nil
+			}
+			return agrirouter.DetectMessageType(filename, content, size)
+		},
+	))
+
+	opts := newSendOptions().Publish()
+	opts.MessageType = ""
+	_, err := client.SendFile(context.Background(), path, opts)
+	require.NoError(t, err)
+	assert.Equal(t, "doc:txt", api.recorded()[0].Header.Get("X-Agrirouter-Message-Type"))
+}
+
+func TestSendFile_UnknownMessageType(t *testing.T) {
+	api := newFakeAPI(t)
+	path := writeTempFile(t, "notes.txt", []byte("hello"))
+
+	opts := newSendOptions().Publish()
+	opts.MessageType = ""
+	_, err := api.client().SendFile(context.Background(), path, opts)
+	assert.True(t, errors.Is(err, agrirouter.ErrUnknownMessageType), "unexpected error: %v", err)
+	assert.Empty(t, api.recorded())
+}
+
+func TestSendFile_TruncatesLongFilenames(t *testing.T) {
+	api := newFakeAPI(t)
+	name := strings.Repeat("ä", 110) + ".png"
+	path := writeTempFile(t, name, []byte("\x89PNG\r\n\x1a\n"))
+
+	opts := newSendOptions().Publish()
+	opts.MessageType = ""
+	_, err := api.client().SendFile(context.Background(), path, opts)
+	require.NoError(t, err)
+
+	sent := api.recorded()[0].Header.Get("X-Agrirouter-Filename")
+	assert.True(t, utf8.ValidString(sent))
+	assert.Equal(t, agrirouter.FilenameMaxLength, utf8.RuneCountInString(sent))
+	assert.True(t, strings.HasSuffix(sent, ".png"))
+}
@@ -0,0 +1,178 @@
+package agrirouter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrNoRoute is returned by [Client.Send] when [SendOptions.RequireRoute]
+	// is set and no endpoint would receive the message.
+	ErrNoRoute = errors.New("no route for message")
+
+	// ErrSenderNotFound is returned by [Client.PlanSend] when the sending
+	// endpoint is not one of the application's endpoints in the tenant.
+	ErrSenderNotFound = errors.New("sending endpoint not found")
+
+	// ErrRecipientNotFound is the reason a recipient is rejected when it is
+	// not visible in the tenant, f.e because it was deleted.
+	ErrRecipientNotFound = errors.New("recipient not found")
+
+	// ErrRecipientCannotReceive is the reason a recipient is rejected when
+	// it has no capability to receive the message type.
+	ErrRecipientCannotReceive = errors.New("recipient cannot receive message type")
+
+	// ErrNoRouteToRecipient is the reason a recipient is rejected when it
+	// could receive the message type, but no route to it exists, f.e because
+	// the user did not configure one.
+	ErrNoRouteToRecipient = errors.New("no route to recipient")
+)
+
+// SendPlan describes which endpoints would receive a message if it was sent
+// now, see [Client.PlanSend].
+type SendPlan struct {
+	// TenantID is the tenant the plan was made for.
+	TenantID uuid.UUID
+	// SenderID is the agrirouter ID of the sending endpoint.
+	SenderID uuid.UUID
+	// MessageType is the message type the plan was made for.
+	MessageType string
+	// Receivers are the agrirouter IDs of the endpoints a route exists to.
+	Receivers []uuid.UUID
+	// Rejected lists the requested recipients that would not receive the
+	// message, together with the reason.
+	Rejected []RejectedRecipient
+}
+
+// RejectedRecipient is a requested recipient that would not receive a
+// message, see [SendPlan].
+type RejectedRecipient struct {
+	// EndpointID is the agrirouter ID of the recipient.
+	EndpointID uuid.UUID
+	// Reason is one of [ErrRecipientNotFound], [ErrRecipientCannotReceive]
+	// or [ErrNoRouteToRecipient].
+	Reason error
+}
+
+// HasReceivers reports whether at least one endpoint would receive the message.
+func (p *SendPlan) HasReceivers() bool {
+	return len(p.Receivers) > 0
+}
+
+// PlanSend determines which endpoints would receive a message of the given
+// type sent by the sender endpoint, based on the routes reported by
+// [Client.ListTenantEndpoints].
+//
+// When recipients are given, the plan describes a direct send to them and
+// every recipient without a route is listed in [SendPlan.Rejected]. Without
+// recipients, the plan describes publishing the message, so every endpoint a
+// route exists to is a receiver.
+//
+// The plan reflects the routes at the time of the call. Routes may change at
+// any time, so sending may still reach fewer or more endpoints.
+func (c *Client) PlanSend(
+	ctx context.Context,
+	tenantID uuid.UUID,
+	senderID uuid.UUID,
+	messageType string,
+	recipients []uuid.UUID,
+) (*SendPlan, error) {
+	return c.planSend(ctx, tenantID, senderID, messageType, len(recipients) == 0, recipients)
+}
+
+func (c *Client) planSend(
+	ctx context.Context,
+	tenantID uuid.UUID,
+	senderID uuid.UUID,
+	messageType string,
+	publish bool,
+	recipients []uuid.UUID,
+) (*SendPlan, error) {
+	endpoints, err := c.ListTenantEndpoints(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	return newSendPlan(endpoints, tenantID, senderID, messageType, publish, recipients)
+}
+
+func newSendPlan(
+	endpoints []TenantEndpointInfo,
+	tenantID uuid.UUID,
+	senderID uuid.UUID,
+	messageType string,
+	publish bool,
+	recipients []uuid.UUID,
+) (*SendPlan, error) {
+	byID := make(map[uuid.UUID]*TenantEndpointInfo, len(endpoints))
+	for i := range endpoints {
+		byID[endpoints[i].Id] = &endpoints[i]
+	}
+	sender, ok := byID[senderID]
+	if !ok || sender.RoutedEndpoints == nil {
+		return nil, fmt.Errorf("%w: %s", ErrSenderNotFound, senderID)
+	}
+
+	routed := map[uuid.UUID]bool{}
+	if sender.RoutedEndpoints.CanSendTo != nil {
+		for id, messageTypes := range *sender.RoutedEndpoints.CanSendTo {
+			receiverID, err := uuid.Parse(id)
+			if err != nil || !slices.Contains(messageTypes, messageType) {
+				continue
+			}
+			routed[receiverID] = true
+		}
+	}
+
+	plan := &SendPlan{TenantID: tenantID, SenderID: senderID, MessageType: messageType}
+	addReceiver := func(id uuid.UUID) {
+		if !slices.Contains(plan.Receivers, id) {
+			plan.Receivers = append(plan.Receivers, id)
+		}
+	}
+	for _, recipient := range recipients {
+		if routed[recipient] {
+			addReceiver(recipient)
+			continue
+		}
+		rejected := RejectedRecipient{EndpointID: recipient, Reason: ErrNoRouteToRecipient}
+		if endpoint, ok := byID[recipient]; !ok {
+			rejected.Reason = ErrRecipientNotFound
+		} else if !slices.Contains(endpoint.Capabilities.CanReceive, messageType) {
+			rejected.Reason = ErrRecipientCannotReceive
+		}
+		plan.Rejected = append(plan.Rejected, rejected)
+	}
+	if publish {
+		// Iterating endpoints rather than the route map keeps the order stable.
+		for _, endpoint := range endpoints {
+			if routed[endpoint.Id] {
+				addReceiver(endpoint.Id)
+			}
+		}
+	}
+	return plan, nil
+}
+
+// requireRoute fails with [ErrNoRoute] if a message sent with opts would not
+// be received by any endpoint.
+func (c *Client) requireRoute(ctx context.Context, opts *SendOptions) error {
+	plan, err := c.planSend(ctx, opts.TenantID, opts.EndpointID, opts.MessageType, opts.IsPublish, opts.DirectRecipients)
+	if err != nil {
+		return err
+	}
+	if plan.HasReceivers() {
+		return nil
+	}
+	reasons := make([]error, 0, len(plan.Rejected))
+	for _, rejected := range plan.Rejected {
+		reasons = append(reasons, fmt.Errorf("%s: %w", rejected.EndpointID, rejected.Reason))
+	}
+	if len(reasons) == 0 {
+		return fmt.Errorf("%w: %s", ErrNoRoute, opts.MessageType)
+	}
+	return fmt.Errorf("%w: %s: %w", ErrNoRoute, opts.MessageType, errors.Join(reasons...))
+}
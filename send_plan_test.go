@@ -0,0 +1,128 @@
+package agrirouter_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/DKE-Data/agrirouter-sdk-go"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// routingFixture is a tenant with a sender that has a route for gps:info to
+// routed, while unrouted could receive it but has no route and incapable
+// cannot receive it at all.
+type routingFixture struct {
+	tenantID  uuid.UUID
+	sender    uuid.UUID
+	routed    uuid.UUID
+	unrouted  uuid.UUID
+	incapable uuid.UUID
+}
+
+func newRoutingFixture(t *testing.T, api *fakeAPI, routeTypes ...string) *routingFixture {
+	t.Helper()
+	f := &routingFixture{
+		tenantID:  uuid.New(),
+		sender:    uuid.New(),
+		routed:    uuid.New(),
+		unrouted:  uuid.New(),
+		incapable: uuid.New(),
+	}
+	canSendTo := agrirouter.EndpointRouteMap{f.routed.String(): routeTypes}
+	receiving := agrirouter.TenantEndpointCapabilities{CanReceive: []string{"gps:info"}}
+	endpoints := []agrirouter.TenantEndpointInfo{
+		{
+			Id:              f.sender,
+			TenantId:        f.tenantID,
+			Capabilities:    agrirouter.TenantEndpointCapabilities{CanSend: []string{"gps:info"}},
+			RoutedEndpoints: &agrirouter.RoutedEndpoints{CanSendTo: &canSendTo},
+		},
+		{Id: f.routed, TenantId: f.tenantID, Capabilities: receiving},
+		{Id: f.unrouted, TenantId: f.tenantID, Capabilities: receiving},
+		{Id: f.incapable, TenantId: f.tenantID},
+	}
+	body, err := json.Marshal(map[string]any{"endpoints": endpoints})
+	require.NoError(t, err)
+	api.respondJSON(http.MethodGet, "/tenants/"+f.tenantID.String()+"/endpoints", http.StatusOK, string(body))
+	return f
+}
+
+func TestPlanSend_DirectRecipients(t *testing.T) {
+	api := newFakeAPI(t)
+	f := newRoutingFixture(t, api, "gps:info")
+	missing := uuid.New()
+
+	plan, err := api.client().PlanSend(context.Background(), f.tenantID, f.sender, "gps:info",
+		[]uuid.UUID{f.routed, f.unrouted, f.incapable, missing})
+	require.NoError(t, err)
+
+	assert.True(t, plan.HasReceivers())
+	assert.Equal(t, []uuid.UUID{f.routed}, plan.Receivers)
+	assert.Equal(t, []agrirouter.RejectedRecipient{
+		{EndpointID: f.unrouted, Reason: agrirouter.ErrNoRouteToRecipient},
+		{EndpointID: f.incapable, Reason: agrirouter.ErrRecipientCannotReceive},
+		{EndpointID: missing, Reason: agrirouter.ErrRecipientNotFound},
+	}, plan.Rejected)
+}
+
+func TestPlanSend_Publish(t *testing.T) {
+	api := newFakeAPI(t)
+	f := newRoutingFixture(t, api, "gps:info")
+	client := api.client()
+
+	plan, err := client.PlanSend(context.Background(), f.tenantID, f.sender, "gps:info", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []uuid.UUID{f.routed}, plan.Receivers)
+	assert.Empty(t, plan.Rejected)
+
+	plan, err = client.Tenant(f.tenantID).PlanSend(context.Background(), f.sender, "img:png", nil)
+	require.NoError(t, err)
+	assert.False(t, plan.HasReceivers())
+}
+
+func TestPlanSend_UnknownSender(t *testing.T) {
+	api := newFakeAPI(t)
+	f := newRoutingFixture(t, api, "gps:info")
+
+	// endpoints of other applications carry no routes, so they cannot be planned for
+	for _, sender := range []uuid.UUID{uuid.New(), f.routed} {
+		_, err := api.client().PlanSend(context.Background(), f.tenantID, sender, "gps:info", nil)
+		assert.ErrorIs(t, err, agrirouter.ErrSenderNotFound)
+	}
+}
+
+func TestSend_RequireRoute(t *testing.T) {
+	api := newFakeAPI(t)
+	f := newRoutingFixture(t, api, "gps:info")
+	client := api.client()
+
+	opts := agrirouter.SendOptions{
+		TenantID:     f.tenantID,
+		EndpointID:   f.sender,
+		MessageType:  "gps:info",
+		RequireRoute: true,
+	}
+
+	_, err := client.Send(context.Background(), opts.DirectTo(f.unrouted), strings.NewReader("x"))
+	require.ErrorIs(t, err, agrirouter.ErrNoRoute)
+	assert.ErrorIs(t, err, agrirouter.ErrNoRouteToRecipient)
+
+	_, err = client.Send(context.Background(), opts.DirectTo(f.unrouted, f.routed), strings.NewReader("x"))
+	require.NoError(t, err)
+
+	_, err = client.Send(context.Background(), opts.Publish(), strings.NewReader("x"))
+	require.NoError(t, err)
+
+	var sent int
+	for _, request := range api.recorded() {
+		if request.Method == http.MethodPost {
+			sent++
+		}
+	}
+	assert.Equal(t, 2, sent, "a send without route must not reach the API")
+}
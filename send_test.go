@@ -0,0 +1,138 @@
+package agrirouter_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DKE-Data/agrirouter-sdk-go"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSendOptions() agrirouter.SendOptions {
+	return agrirouter.SendOptions{
+		TenantID:    uuid.New(),
+		EndpointID:  uuid.New(),
+		MessageType: "gps:info",
+	}
+}
+
+func TestSend_FillsHeaders(t *testing.T) {
+	api := newFakeAPI(t)
+	recipient := uuid.New()
+	opts := newSendOptions().DirectTo(recipient)
+	opts.Filename = "data.bin"
+
+	receipt, err := api.client().Send(context.Background(), opts, strings.NewReader("payload"))
+	require.NoError(t, err)
+
+	requests := api.recorded()
+	require.Len(t, requests, 1)
+	header := requests[0].Header
+	assert.Equal(t, "7", header.Get("Content-Length"))
+	assert.Equal(t, "false", header.Get("X-Agrirouter-Is-Publish"))
+	assert.Equal(t, recipient.String(), header.Get("X-Agrirouter-Direct-Recipients"))
+	assert.Equal(t, "data.bin", header.Get("X-Agrirouter-Filename"))
+	assert.Equal(t, opts.TenantID.String(), header.Get("X-Agrirouter-Tenant-Id"))
+	assert.Equal(t, receipt.ContextID, header.Get("X-Agrirouter-Context-Id"))
+	sentAt, err := time.Parse(time.RFC3339Nano, header.Get("X-Agrirouter-Sent-Timestamp"))
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), sentAt, time.Minute)
+	assert.Equal(t, []byte("payload"), requests[0].Body)
+
+	assert.NotEmpty(t, receipt.ContextID)
+	assert.LessOrEqual(t, len(receipt.ContextID), agrirouter.ContextIDMaxLength)
+	assert.Equal(t, int64(7), receipt.ContentLength)
+	assert.True(t, receipt.MatchesAppMessageID(receipt.ContextID+"-0"))
+	assert.False(t, receipt.MatchesAppMessageID("other-0"))
+}
+
+func TestSend_KeepsGivenContextID(t *testing.T) {
+	api := newFakeAPI(t)
+	opts := newSendOptions().Publish()
+	opts.ContextID = "my-context"
+
+	receipt, err := api.client().Send(context.Background(), opts, strings.NewReader("x"))
+	require.NoError(t, err)
+	assert.Equal(t, "my-context", receipt.ContextID)
+	assert.Equal(t, "my-context-", receipt.AppMessageIDPrefix)
+	assert.Equal(t, "true", api.recorded()[0].Header.Get("X-Agrirouter-Is-Publish"))
+}
+
+func TestSend_ContentLengthSources(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "payload")
+	require.NoError(t, os.WriteFile(path, []byte("0123456789"), 0o600))
+
+	cases := []struct {
+		name string
+		body func(t *testing.T) io.Reader
+		want int64
+	}{
+		{
+			name: "Len",
+			body: func(*testing.T) io.Reader { return strings.NewReader("abc") },
+			want: 3,
+		},
+		{
+			name: "Stat with offset",
+			body: func(t *testing.T) io.Reader {
+				file, err := os.Open(path)
+				require.NoError(t, err)
+				t.Cleanup(func() { _ = file.Close() })
+				_, err = file.Seek(4, io.SeekStart)
+				require.NoError(t, err)
+				return file
+			},
+			want: 6,
+		},
+		{
+			name: "spooled",
+			body: func(*testing.T) io.Reader { return io.MultiReader(strings.NewReader("ab"), strings.NewReader("cd")) },
+			want: 4,
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			api := newFakeAPI(t)
+			receipt, err := api.client().Send(context.Background(), newSendOptions().Publish(), tc.body(t))
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, receipt.ContentLength)
+			requests := api.recorded()
+			require.Len(t, requests, 1)
+			assert.Len(t, requests[0].Body, int(tc.want))
+			assert.Equal(t, tc.want, requests[0].ContentLength, "sized bodies are not sent chunked")
+		})
+	}
+}
+
+func TestSend_RejectsInvalidOptions(t *testing.T) {
+	api := newFakeAPI(t)
+	client := api.client()
+
+	missingType := newSendOptions()
+	missingType.MessageType = ""
+	longContext := newSendOptions()
+	longContext.ContextID = strings.Repeat("c", agrirouter.ContextIDMaxLength+1)
+
+	for _, opts := range []agrirouter.SendOptions{{}, missingType, longContext} {
+		_, err := client.Send(context.Background(), opts, strings.NewReader("x"))
+		assert.True(t, errors.Is(err, agrirouter.ErrInvalidSendOptions), "unexpected error: %v", err)
+	}
+	assert.Empty(t, api.recorded(), "invalid options must not reach the API")
+}
+
+func TestSend_ReturnsAPIErrors(t *testing.T) {
+	api := newFakeAPI(t)
+	api.setDefaultStatus(http.StatusBadRequest)
+
+	_, err := api.client().Send(context.Background(), newSendOptions().Publish(), strings.NewReader("x"))
+	assert.True(t, errors.Is(err, agrirouter.ErrFailedStatusCode), "unexpected error: %v", err)
+}
@@ -0,0 +1,179 @@
+package agrirouter
+
+import (
+	"context"
+	"io"
+
+	"github.com/google/uuid"
+)
+
+// TenantClient is a view of [Client] bound to a single tenant.
+//
+// Every agrirouter call that mutates state has to carry the tenant ID it
+// relates to. TenantClient fills it in for the caller, so that services
+// working with many tenants do not need to thread the ID through every call.
+//
+// A TenantClient is cheap to create and safe for concurrent use as long as the
+// underlying [Client] is.
+type TenantClient struct {
+	client   *Client
+	tenantID uuid.UUID
+}
+
+// Tenant returns a [TenantClient] that performs all calls in the context of
+// the tenant identified by id.
+func (c *Client) Tenant(id uuid.UUID) *TenantClient {
+	return &TenantClient{client: c, tenantID: id}
+}
+
+// ID returns the tenant ID this client is bound to.
+func (t *TenantClient) ID() uuid.UUID {
+	return t.tenantID
+}
+
+// Client returns the underlying, tenant-agnostic [Client].
+func (t *TenantClient) Client() *Client {
+	return t.client
+}
+
+// PutEndpoint creates or updates an endpoint in the bound tenant.
+//
+// See [Client.PutEndpoint] for details on the semantics of the call.
+func (t *TenantClient) PutEndpoint(
+	ctx context.Context,
+	externalID string,
+	req *PutEndpointRequest,
+) (*Endpoint, error) {
+	return t.client.PutEndpoint(ctx, externalID, &PutEndpointParams{
+		XAgrirouterTenantId: t.tenantID,
+	}, req)
+}
+
+// DeleteEndpoint deletes an endpoint of the bound tenant identified by its
+// external ID.
+//
+// See [Client.DeleteEndpoint] for details on the semantics of the call.
+func (t *TenantClient) DeleteEndpoint(ctx context.Context, externalID string) error {
+	return t.client.DeleteEndpoint(ctx, externalID, &DeleteEndpointParams{
+		XAgrirouterTenantId: t.tenantID,
+	})
+}
+
+// Send sends a message in the bound tenant.
+//
+// The tenant ID in opts is overwritten with the tenant of this client,
+// see [Client.Send] for details on the semantics of the call.
+func (t *TenantClient) Send(ctx context.Context, opts SendOptions, body io.Reader) (*SendReceipt, error) {
+	opts.TenantID = t.tenantID
+	return t.client.Send(ctx, opts, body)
+}
+
+// PlanSend determines which endpoints of the bound tenant would receive a
+// message of the given type sent by the sender endpoint.
+//
+// See [Client.PlanSend] for details on the semantics of the call.
+func (t *TenantClient) PlanSend(
+	ctx context.Context,
+	senderID uuid.UUID,
+	messageType string,
+	recipients []uuid.UUID,
+) (*SendPlan, error) {
+	return t.client.PlanSend(ctx, t.tenantID, senderID, messageType, recipients)
+}
+
+// Confirm confirms that the given messages, received by endpoints of the
+// bound tenant, have been processed.
+//
+// See [Client.ConfirmMessages] for details on the semantics of the call.
+func (t *TenantClient) Confirm(ctx context.Context, confirmations ...MessageConfirmation) error {
+	return t.client.ConfirmMessages(ctx, &ConfirmMessagesParams{
+		XAgrirouterTenantId: t.tenantID,
+	}, ConfirmMessagesRequest{Confirmations: confirmations})
+}
+
+// ListEndpoints returns the endpoints of the bound tenant.
+//
+// See [Client.ListTenantEndpoints] for details on the returned information.
+func (t *TenantClient) ListEndpoints(ctx context.Context) ([]TenantEndpointInfo, error) {
+	return t.client.ListTenantEndpoints(ctx, t.tenantID)
+}
+
+// FilterHandlers wraps handlers so that only events related to the bound
+// tenant are delivered to them.
+//
+// Messages, files, endpoint list changes and authorization changes carry a
+// tenant ID and are dropped when it does not match. ENDPOINT_DELETED events do
+// not carry a tenant ID, hence they are always delivered.
+func (t *TenantClient) FilterHandlers(handlers EventHandlers) EventHandlers {
+	filtered := handlers
+	tenantID := t.tenantID.String()
+	if handlers.OnMessage != nil {
+		filtered.OnMessage = func(ctx context.Context, message *Message) {
+			if message.TenantID != nil && *message.TenantID == tenantID {
+				handlers.OnMessage(ctx, message)
+			}
+		}
+	}
+	if handlers.OnFile != nil {
+		filtered.OnFile = func(ctx context.Context, file *File) {
+			if file.TenantID != nil && *file.TenantID == tenantID {
+				handlers.OnFile(ctx, file)
+			}
+		}
+	}
+	if handlers.ProcessMessage != nil {
+		filtered.ProcessMessage = func(ctx context.Context, message *Message) error {
+			if message.TenantID != nil && *message.TenantID == tenantID {
+				return handlers.ProcessMessage(ctx, message)
+			}
+			return errSkipped
+		}
+	}
+	if handlers.ProcessFile != nil {
+		filtered.ProcessFile = func(ctx context.Context, file *File) error {
+			if file.TenantID != nil && *file.TenantID == tenantID {
+				return handlers.ProcessFile(ctx, file)
+			}
+			return errSkipped
+		}
+	}
+	if handlers.OnEndpointsListChanged != nil {
+		filtered.OnEndpointsListChanged = func(ctx context.Context, event *EndpointsListChangedEventData) {
+			if event.TenantId == t.tenantID {
+				handlers.OnEndpointsListChanged(ctx, event)
+			}
+		}
+	}
+	if handlers.OnAuthorizationAdded != nil {
+		filtered.OnAuthorizationAdded = func(ctx context.Context, event *AuthorizationAddedEventData) {
+			if event.Tenant.TenantId == t.tenantID {
+				handlers.OnAuthorizationAdded(ctx, event)
+			}
+		}
+	}
+	if handlers.OnAuthorizationRevoked != nil {
+		filtered.OnAuthorizationRevoked = func(ctx context.Context, event *AuthorizationRevokedEventData) {
+			if event.TenantId == t.tenantID {
+				handlers.OnAuthorizationRevoked(ctx, event)
+			}
+		}
+	}
+	return filtered
+}
+
+// ReceiveEvents works like [Client.ReceiveEvents], but only delivers events
+// related to the bound tenant. Messages and files of other tenants are dropped
+// before their payload is fetched, see [WithEventFilter].
+//
+// This function blocks until the context is canceled or an error occurs.
+// It is recommended to run this function in a separate goroutine.
+func (t *TenantClient) ReceiveEvents(
+	ctx context.Context,
+	types []EventType,
+	handlers EventHandlers,
+	errorHandler func(err error),
+	opts ...ReceiveOption,
+) error {
+	filter := WithEventFilter(EventFilter{TenantIDs: []uuid.UUID{t.tenantID}})
+	return t.client.ReceiveEvents(ctx, types, handlers, errorHandler, append([]ReceiveOption{filter}, opts...)...)
+}
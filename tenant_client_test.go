@@ -0,0 +1,88 @@
+package agrirouter_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/DKE-Data/agrirouter-sdk-go"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTenantClient_BindsTenantToCalls(t *testing.T) {
+	api := newFakeAPI(t)
+	tenantID := uuid.New()
+	externalID := "urn:test-app:endpoint:1"
+	api.respondJSON(http.MethodPut, "/endpoints/"+externalID, http.StatusOK, `{"external_id":"`+externalID+`"}`)
+	api.handle(http.MethodDelete, "/endpoints/"+externalID, func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	api.handle(http.MethodPost, "/confirmations", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	})
+	api.respondJSON(http.MethodGet, "/tenants/"+tenantID.String()+"/endpoints", http.StatusOK, `{"endpoints":[]}`)
+
+	tenant := api.client().Tenant(tenantID)
+	ctx := context.Background()
+
+	_, err := tenant.PutEndpoint(ctx, externalID, &agrirouter.PutEndpointRequest{})
+	require.NoError(t, err)
+	require.NoError(t, tenant.DeleteEndpoint(ctx, externalID))
+	_, err = tenant.Send(ctx, agrirouter.SendOptions{
+		TenantID:    uuid.New(), // overwritten by the tenant client
+		EndpointID:  uuid.New(),
+		MessageType: "gps:info",
+	}.Publish(), bytes.NewReader([]byte("abc")))
+	require.NoError(t, err)
+	require.NoError(t, tenant.Confirm(ctx, agrirouter.MessageConfirmation{MessageId: uuid.New(), EndpointId: uuid.New()}))
+	endpoints, err := tenant.ListEndpoints(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, endpoints)
+
+	requests := api.recorded()
+	require.Len(t, requests, 5)
+	for _, r := range requests[:4] {
+		assert.Equal(t, tenantID.String(), r.Header.Get("X-Agrirouter-Tenant-Id"), "%s %s", r.Method, r.Path)
+	}
+	assert.Equal(t, "/tenants/"+tenantID.String()+"/endpoints", requests[4].Path)
+}
+
+func TestTenantClient_FilterHandlers(t *testing.T) {
+	client, err := agrirouter.NewClient("http://localhost")
+	require.NoError(t, err)
+	tenantID := uuid.New()
+	tenant := client.Tenant(tenantID)
+
+	var messages []*agrirouter.Message
+	var revocations []*agrirouter.AuthorizationRevokedEventData
+	var deletions []*agrirouter.DeletedEndpoint
+	handlers := tenant.FilterHandlers(agrirouter.EventHandlers{
+		OnMessage: func(_ context.Context, message *agrirouter.Message) {
+			messages = append(messages, message)
+		},
+		OnAuthorizationRevoked: func(_ context.Context, event *agrirouter.AuthorizationRevokedEventData) {
+			revocations = append(revocations, event)
+		},
+		OnEndpointDeleted: func(_ context.Context, deletion *agrirouter.DeletedEndpoint) {
+			deletions = append(deletions, deletion)
+		},
+	})
+	assert.Nil(t, handlers.OnFile, "unset handlers must stay unset")
+
+	ctx := context.Background()
+	own := tenantID.String()
+	other := uuid.NewString()
+	handlers.OnMessage(ctx, &agrirouter.Message{TenantID: &own})
+	handlers.OnMessage(ctx, &agrirouter.Message{TenantID: &other})
+	handlers.OnMessage(ctx, &agrirouter.Message{})
+	handlers.OnAuthorizationRevoked(ctx, &agrirouter.AuthorizationRevokedEventData{TenantId: tenantID})
+	handlers.OnAuthorizationRevoked(ctx, &agrirouter.AuthorizationRevokedEventData{TenantId: uuid.New()})
+	handlers.OnEndpointDeleted(ctx, &agrirouter.DeletedEndpoint{ID: uuid.New()})
+
+	assert.Len(t, messages, 1)
+	assert.Len(t, revocations, 1)
+	assert.Len(t, deletions, 1, "deletions carry no tenant and are always delivered")
+}
@@ -0,0 +1,437 @@
+package agrirouter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// ScopeEndpointsManage is the OAuth scope granting applications to manage
+// their endpoints in a tenant, currently the only scope in use.
+const ScopeEndpointsManage = "endpoints:manage"
+
+// ErrTenantNotFound is returned by [TenantRegistry] when a tenant is not
+// authorized.
+var ErrTenantNotFound = errors.New("tenant not found")
+
+// RegisteredTenant is the state of an authorized tenant as mirrored by
+// [TenantRegistry].
+//
+// Values returned by the registry are snapshots and must not be modified.
+type RegisteredTenant struct {
+	ID        uuid.UUID            `json:"id"`        // ID is the tenant ID
+	Scopes    []string             `json:"scopes"`    // Scopes are the scopes the application is authorized for
+	Endpoints []TenantEndpointInfo `json:"endpoints"` // Endpoints are the endpoints in the tenant visible to the application
+}
+
+// OwnedEndpoints returns the endpoints of t owned by the application.
+func (t *RegisteredTenant) OwnedEndpoints() []TenantEndpointInfo {
+	var owned []TenantEndpointInfo
+	for _, endpoint := range t.Endpoints {
+		if endpoint.OwnedByYourApplication {
+			owned = append(owned, endpoint)
+		}
+	}
+	return owned
+}
+
+// TenantChangeKind tells how a tenant changed, see [TenantChange].
+type TenantChangeKind string
+
+const (
+	TenantAdded            TenantChangeKind = "tenant_added"      // TenantAdded is a tenant that was authorized
+	TenantRemoved          TenantChangeKind = "tenant_removed"    // TenantRemoved is a tenant whose authorization was revoked
+	TenantScopesChanged    TenantChangeKind = "scopes_changed"    // TenantScopesChanged is a tenant that was authorized or revoked for a scope
+	TenantEndpointsChanged TenantChangeKind = "endpoints_changed" // TenantEndpointsChanged is a tenant whose endpoints changed
+)
+
+// TenantChange is a change of the state mirrored by [TenantRegistry].
+type TenantChange struct {
+	Kind     TenantChangeKind
+	TenantID uuid.UUID
+	// Previous is the state of the tenant before the change, nil if the
+	// tenant was added.
+	Previous *RegisteredTenant
+	// Current is the state of the tenant after the change, nil if the
+	// tenant was removed.
+	Current *RegisteredTenant
+	// EndpointChanges are the changes of the endpoints of the tenant, set
+	// for [TenantEndpointsChanged].
+	EndpointChanges []EndpointChange
+	// Synthetic is true if the change was detected by comparing the state
+	// with the listed tenants, see [TenantRegistry.Sync], instead of being
+	// received as an event. Changes that happened while no events were
+	// received are reported as synthetic changes.
+	Synthetic bool
+}
+
+// TenantChangeHandler is called with changes of a [TenantRegistry].
+type TenantChangeHandler func(ctx context.Context, change *TenantChange)
+
+// TenantRegistry mirrors the authorized tenants of the application, their
+// scopes and endpoints, following the synchronization protocol of agrirouter:
+// the state is rebuilt with [Client.ListAuthorizedTenants] by
+// [TenantRegistry.Sync] and kept current by AUTHORIZATION_ADDED,
+// AUTHORIZATION_REVOKED, ENDPOINTS_LIST_CHANGED and ENDPOINT_DELETED events,
+// see [TenantRegistry.Run] and [TenantRegistry.Handlers].
+//
+// Registries are safe for concurrent use.
+type TenantRegistry struct {
+	client *Client
+
+	mu      sync.RWMutex
+	tenants map[uuid.UUID]*RegisteredTenant
+
+	subscribersMu sync.Mutex
+	subscribers   map[int]TenantChangeHandler
+	nextID        int
+}
+
+// NewTenantRegistry creates an empty [TenantRegistry] synchronizing with
+// agrirouter using client.
+func NewTenantRegistry(client *Client) *TenantRegistry {
+	return &TenantRegistry{
+		client:      client,
+		tenants:     map[uuid.UUID]*RegisteredTenant{},
+		subscribers: map[int]TenantChangeHandler{},
+	}
+}
+
+// Subscribe makes r call handler with every change, after the change was
+// applied. Handlers are called synchronously in the order changes were
+// applied, they should not block. The returned function unsubscribes
+// handler.
+func (r *TenantRegistry) Subscribe(handler TenantChangeHandler) (unsubscribe func()) {
+	r.subscribersMu.Lock()
+	defer r.subscribersMu.Unlock()
+	id := r.nextID
+	r.nextID++
+	r.subscribers[id] = handler
+	return func() {
+		r.subscribersMu.Lock()
+		defer r.subscribersMu.Unlock()
+		delete(r.subscribers, id)
+	}
+}
+
+func (r *TenantRegistry) notify(ctx context.Context, changes []*TenantChange) {
+	if len(changes) == 0 {
+		return
+	}
+	r.subscribersMu.Lock()
+	ids := make([]int, 0, len(r.subscribers))
+	for id := range r.subscribers {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	handlers := make([]TenantChangeHandler, 0, len(ids))
+	for _, id := range ids {
+		handlers = append(handlers, r.subscribers[id])
+	}
+	r.subscribersMu.Unlock()
+	for _, change := range changes {
+		for _, handler := range handlers {
+			handler(ctx, change)
+		}
+	}
+}
+
+// Sync rebuilds the state of r from [Client.ListAuthorizedTenants] and
+// notifies subscribers of the differences to the previous state.
+//
+// As the listed tenants carry no scopes, tenants that were not known before
+// are assumed to be authorized for [ScopeEndpointsManage].
+func (r *TenantRegistry) Sync(ctx context.Context) error {
+	tenants, err := r.client.ListAuthorizedTenants(ctx)
+	if err != nil {
+		return err
+	}
+	r.notify(ctx, r.replace(tenants))
+	return nil
+}
+
+// replace replaces the state of r with tenants and returns the changes.
+func (r *TenantRegistry) replace(tenants []TenantInfo) []*TenantChange {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var changes []*TenantChange
+	listed := map[uuid.UUID]bool{}
+	for _, info := range tenants {
+		listed[info.TenantId] = true
+		previous, ok := r.tenants[info.TenantId]
+		if !ok {
+			current := &RegisteredTenant{
+				ID:        info.TenantId,
+				Scopes:    []string{ScopeEndpointsManage},
+				Endpoints: info.Endpoints,
+			}
+			r.tenants[info.TenantId] = current
+			changes = append(changes, &TenantChange{Kind: TenantAdded, TenantID: info.TenantId, Current: current})
+			continue
+		}
+		if change := r.setEndpoints(previous, info.Endpoints); change != nil {
+			changes = append(changes, change)
+		}
+	}
+	for id, previous := range r.tenants {
+		if !listed[id] {
+			delete(r.tenants, id)
+			changes = append(changes, &TenantChange{Kind: TenantRemoved, TenantID: id, Previous: previous})
+		}
+	}
+	slices.SortStableFunc(changes, func(a, b *TenantChange) int {
+		return bytes.Compare(a.TenantID[:], b.TenantID[:])
+	})
+	for _, change := range changes {
+		change.Synthetic = true
+	}
+	return changes
+}
+
+// setEndpoints replaces the endpoints of previous, it returns nil if they did
+// not change. r.mu must be held.
+func (r *TenantRegistry) setEndpoints(previous *RegisteredTenant, endpoints []TenantEndpointInfo) *TenantChange {
+	if endpointsEqual(previous.Endpoints, endpoints) {
+		return nil
+	}
+	current := &RegisteredTenant{ID: previous.ID, Scopes: previous.Scopes, Endpoints: endpoints}
+	r.tenants[previous.ID] = current
+	return &TenantChange{
+		Kind:            TenantEndpointsChanged,
+		TenantID:        previous.ID,
+		Previous:        previous,
+		Current:         current,
+		EndpointChanges: DiffEndpoints(previous.Endpoints, endpoints),
+	}
+}
+
+// Run keeps r current by receiving events with [Client.ReceiveEvents], until
+// ctx is canceled. Whenever the events stream was (re)connected, r is
+// synchronized with [TenantRegistry.Sync] before the events are applied, so
+// that no changes are lost while connecting or while the stream was
+// disconnected. Failing to synchronize ends receiving.
+//
+// Only the events needed by the registry are received. To handle other events
+// on the same stream, use [TenantRegistry.Handlers] instead.
+func (r *TenantRegistry) Run(ctx context.Context, errorHandler func(err error), opts ...ReceiveOption) error {
+	return r.client.ReceiveEvents(ctx, []EventType{
+		EventTypeAuthorizationAdded,
+		EventTypeAuthorizationRevoked,
+		EventTypeEndpointsListChanged,
+		EventTypeEndpointDeleted,
+	}, r.Handlers(EventHandlers{}), errorHandler, append(slices.Clone(opts), withOnConnect(r.Sync))...)
+}
+
+// Handlers returns handlers that apply events to r before calling the
+// respective handler of handlers, if set. Pass them to
+// [Client.ReceiveEvents] and call [TenantRegistry.Sync] once receiving
+// started, events applied before are corrected by it.
+//
+// Unlike [TenantRegistry.Run], the handlers cannot tell when the events
+// stream connects. Changes made before it connected or while it reconnects
+// are not received as events, they are only applied by calling
+// [TenantRegistry.Sync] again, f.e periodically.
+func (r *TenantRegistry) Handlers(handlers EventHandlers) EventHandlers {
+	wrapped := handlers
+	wrapped.OnAuthorizationAdded = func(ctx context.Context, event *AuthorizationAddedEventData) {
+		r.notify(ctx, r.authorizationAdded(event))
+		if handlers.OnAuthorizationAdded != nil {
+			handlers.OnAuthorizationAdded(ctx, event)
+		}
+	}
+	wrapped.OnAuthorizationRevoked = func(ctx context.Context, event *AuthorizationRevokedEventData) {
+		r.notify(ctx, r.authorizationRevoked(event))
+		if handlers.OnAuthorizationRevoked != nil {
+			handlers.OnAuthorizationRevoked(ctx, event)
+		}
+	}
+	wrapped.OnEndpointsListChanged = func(ctx context.Context, event *EndpointsListChangedEventData) {
+		r.notify(ctx, r.endpointsListChanged(event))
+		if handlers.OnEndpointsListChanged != nil {
+			handlers.OnEndpointsListChanged(ctx, event)
+		}
+	}
+	wrapped.OnEndpointDeleted = func(ctx context.Context, deletion *DeletedEndpoint) {
+		r.notify(ctx, r.endpointDeleted(deletion))
+		if handlers.OnEndpointDeleted != nil {
+			handlers.OnEndpointDeleted(ctx, deletion)
+		}
+	}
+	return wrapped
+}
+
+func (r *TenantRegistry) authorizationAdded(event *AuthorizationAddedEventData) []*TenantChange {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	tenantID := event.Tenant.TenantId
+	previous, ok := r.tenants[tenantID]
+	if !ok {
+		current := &RegisteredTenant{ID: tenantID, Scopes: []string{event.Scope}, Endpoints: event.Tenant.Endpoints}
+		r.tenants[tenantID] = current
+		return []*TenantChange{{Kind: TenantAdded, TenantID: tenantID, Current: current}}
+	}
+	var changes []*TenantChange
+	if !slices.Contains(previous.Scopes, event.Scope) {
+		current := &RegisteredTenant{
+			ID:        tenantID,
+			Scopes:    append(slices.Clone(previous.Scopes), event.Scope),
+			Endpoints: previous.Endpoints,
+		}
+		r.tenants[tenantID] = current
+		changes = append(changes, &TenantChange{Kind: TenantScopesChanged, TenantID: tenantID, Previous: previous, Current: current})
+		previous = current
+	}
+	if change := r.setEndpoints(previous, event.Tenant.Endpoints); change != nil {
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+func (r *TenantRegistry) authorizationRevoked(event *AuthorizationRevokedEventData) []*TenantChange {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	previous, ok := r.tenants[event.TenantId]
+	if !ok {
+		return nil
+	}
+	scopes := slices.DeleteFunc(slices.Clone(previous.Scopes), func(scope string) bool {
+		return scope == event.Scope
+	})
+	if len(scopes) == 0 {
+		delete(r.tenants, event.TenantId)
+		return []*TenantChange{{Kind: TenantRemoved, TenantID: event.TenantId, Previous: previous}}
+	}
+	if len(scopes) == len(previous.Scopes) {
+		return nil
+	}
+	current := &RegisteredTenant{ID: previous.ID, Scopes: scopes, Endpoints: previous.Endpoints}
+	r.tenants[event.TenantId] = current
+	return []*TenantChange{{Kind: TenantScopesChanged, TenantID: event.TenantId, Previous: previous, Current: current}}
+}
+
+func (r *TenantRegistry) endpointsListChanged(event *EndpointsListChangedEventData) []*TenantChange {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	previous, ok := r.tenants[event.TenantId]
+	if !ok {
+		// endpoints of tenants that are not authorized are not tracked
+		return nil
+	}
+	if change := r.setEndpoints(previous, event.Endpoints); change != nil {
+		return []*TenantChange{change}
+	}
+	return nil
+}
+
+func (r *TenantRegistry) endpointDeleted(deletion *DeletedEndpoint) []*TenantChange {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var changes []*TenantChange
+	for _, previous := range r.tenants {
+		endpoints := slices.DeleteFunc(slices.Clone(previous.Endpoints), func(endpoint TenantEndpointInfo) bool {
+			return endpoint.Id == deletion.ID
+		})
+		if change := r.setEndpoints(previous, endpoints); change != nil {
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// Tenants returns all authorized tenants, ordered by ID.
+func (r *TenantRegistry) Tenants() []*RegisteredTenant {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	tenants := make([]*RegisteredTenant, 0, len(r.tenants))
+	for _, tenant := range r.tenants {
+		tenants = append(tenants, tenant)
+	}
+	slices.SortFunc(tenants, func(a, b *RegisteredTenant) int {
+		return bytes.Compare(a.ID[:], b.ID[:])
+	})
+	return tenants
+}
+
+// Tenant returns the tenant with id, or false if it is not authorized.
+func (r *TenantRegistry) Tenant(id uuid.UUID) (*RegisteredTenant, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	tenant, ok := r.tenants[id]
+	return tenant, ok
+}
+
+// Endpoint returns the endpoint with the agrirouter ID id in any tenant, or
+// false if it is not known.
+func (r *TenantRegistry) Endpoint(id uuid.UUID) (*TenantEndpointInfo, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, tenant := range r.tenants {
+		for i := range tenant.Endpoints {
+			if tenant.Endpoints[i].Id == id {
+				return &tenant.Endpoints[i], true
+			}
+		}
+	}
+	return nil, false
+}
+
+// EndpointByExternalID returns the endpoint of tenantID with externalID, or
+// false if it is not known. External IDs are only visible for some endpoints,
+// f.e those owned by the application.
+func (r *TenantRegistry) EndpointByExternalID(tenantID uuid.UUID, externalID string) (*TenantEndpointInfo, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	tenant, ok := r.tenants[tenantID]
+	if !ok {
+		return nil, false
+	}
+	for i := range tenant.Endpoints {
+		if id := tenant.Endpoints[i].ExternalId; id != nil && *id == externalID {
+			return &tenant.Endpoints[i], true
+		}
+	}
+	return nil, false
+}
+
+// OwnedEndpoints returns the endpoints owned by the application in all
+// tenants, ordered by tenant.
+func (r *TenantRegistry) OwnedEndpoints() []TenantEndpointInfo {
+	var owned []TenantEndpointInfo
+	for _, tenant := range r.Tenants() {
+		owned = append(owned, tenant.OwnedEndpoints()...)
+	}
+	return owned
+}
+
+// ResolveExternalID returns the external ID of the endpoint endpointID of
+// tenantID. It can be used as [ExternalIDResolver], which answers from the
+// registry instead of listing endpoints.
+func (r *TenantRegistry) ResolveExternalID(_ context.Context, tenantID uuid.UUID, endpointID uuid.UUID) (string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	tenant, ok := r.tenants[tenantID]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrTenantNotFound, tenantID)
+	}
+	for _, endpoint := range tenant.Endpoints {
+		if endpoint.Id == endpointID && endpoint.ExternalId != nil {
+			return *endpoint.ExternalId, nil
+		}
+	}
+	return "", fmt.Errorf("endpoint %s has no external ID in tenant %s", endpointID, tenantID)
+}
+
+// endpointsEqual reports whether a and b hold the same endpoints in the same
+// order.
+func endpointsEqual(a, b []TenantEndpointInfo) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,206 @@
+package agrirouter_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DKE-Data/agrirouter-sdk-go"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// tenantEndpoint returns an endpoint as listed in tenant tenantID.
+func tenantEndpoint(tenantID, id uuid.UUID, externalID string, owned bool) map[string]any {
+	endpoint := map[string]any{
+		"id":                        id,
+		"tenant_id":                 tenantID,
+		"application_id":            uuid.New(),
+		"name":                      "endpoint " + externalID,
+		"endpoint_type":             "cloud_software",
+		"owned_by_your_application": owned,
+		"capabilities":              map[string]any{},
+	}
+	if externalID != "" {
+		endpoint["external_id"] = externalID
+	}
+	return endpoint
+}
+
+// serveTenants makes api list tenants, each given as ID and endpoints.
+func serveTenants(t *testing.T, api *fakeAPI, tenants map[uuid.UUID][]any) {
+	t.Helper()
+	list := []any{}
+	for id, endpoints := range tenants {
+		list = append(list, map[string]any{"tenant_id": id, "endpoints": endpoints})
+	}
+	body, err := json.Marshal(map[string]any{"tenants": list})
+	require.NoError(t, err)
+	api.respondJSON(http.MethodGet, "/tenants", http.StatusOK, string(body))
+}
+
+func TestTenantRegistry_MirrorsTenants(t *testing.T) {
+	api := newFakeAPI(t)
+	first, second, third := uuid.New(), uuid.New(), uuid.New()
+	own, other, deleted, added := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	serveTenants(t, api, map[uuid.UUID][]any{
+		first:  {tenantEndpoint(first, own, "own", true), tenantEndpoint(first, other, "", false)},
+		second: {tenantEndpoint(second, deleted, "deleted", true)},
+	})
+	api.serveEvents(
+		map[string]any{
+			"event_type": "AUTHORIZATION_ADDED",
+			"scope":      "endpoints:manage",
+			"tenant":     map[string]any{"tenant_id": third, "endpoints": []any{}},
+		},
+		map[string]any{
+			"event_type": "ENDPOINTS_LIST_CHANGED",
+			"tenant_id":  first,
+			"endpoints": []any{
+				tenantEndpoint(first, own, "own", true),
+				tenantEndpoint(first, other, "", false),
+				tenantEndpoint(first, added, "added", true),
+			},
+		},
+		map[string]any{"event_type": "ENDPOINT_DELETED", "id": deleted, "external_id": "deleted"},
+		map[string]any{"event_type": "AUTHORIZATION_REVOKED", "scope": "endpoints:manage", "tenant_id": second},
+	)
+	registry := agrirouter.NewTenantRegistry(api.client())
+
+	var mu sync.Mutex
+	var changes []string
+	registry.Subscribe(func(_ context.Context, change *agrirouter.TenantChange) {
+		mu.Lock()
+		defer mu.Unlock()
+		changes = append(changes, string(change.Kind)+" "+change.TenantID.String())
+	})
+	run := startReceiving(t, func(ctx context.Context, errorHandler func(err error)) error {
+		return registry.Run(ctx, errorHandler)
+	})
+
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Len(c, changes, 6)
+	}, 5*time.Second, 10*time.Millisecond)
+	mu.Lock()
+	assert.ElementsMatch(t, []string{"tenant_added " + first.String(), "tenant_added " + second.String()}, changes[:2])
+	assert.Equal(t, []string{
+		"tenant_added " + third.String(),
+		"endpoints_changed " + first.String(),
+		"endpoints_changed " + second.String(),
+		"tenant_removed " + second.String(),
+	}, changes[2:])
+	mu.Unlock()
+	assert.Empty(t, run.reported())
+
+	tenants := registry.Tenants()
+	require.Len(t, tenants, 2)
+	tenant, ok := registry.Tenant(first)
+	require.True(t, ok)
+	assert.Equal(t, []string{agrirouter.ScopeEndpointsManage}, tenant.Scopes)
+	assert.Len(t, tenant.Endpoints, 3)
+	_, ok = registry.Tenant(second)
+	assert.False(t, ok)
+
+	endpoint, ok := registry.Endpoint(added)
+	require.True(t, ok)
+	assert.Equal(t, first, endpoint.TenantId)
+	_, ok = registry.Endpoint(deleted)
+	assert.False(t, ok)
+
+	endpoint, ok = registry.EndpointByExternalID(first, "own")
+	require.True(t, ok)
+	assert.Equal(t, own, endpoint.Id)
+	_, ok = registry.EndpointByExternalID(third, "own")
+	assert.False(t, ok)
+
+	var owned []uuid.UUID
+	for _, endpoint := range registry.OwnedEndpoints() {
+		owned = append(owned, endpoint.Id)
+	}
+	assert.ElementsMatch(t, []uuid.UUID{own, added}, owned)
+}
+
+func TestTenantRegistry_SyncsWheneverConnected(t *testing.T) {
+	api := newFakeAPI(t)
+	first, second := uuid.New(), uuid.New()
+	var mu sync.Mutex
+	var connections, listings int
+	var requests []string
+	api.handle(http.MethodGet, "/events", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		connections++
+		connection := connections
+		requests = append(requests, "events")
+		mu.Unlock()
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		if connection > 1 {
+			<-r.Context().Done()
+		}
+		// the first connection is lost right away
+	})
+	api.handle(http.MethodGet, "/tenants", func(w http.ResponseWriter, _ *http.Request) {
+		mu.Lock()
+		listings++
+		tenants := []any{map[string]any{"tenant_id": first, "endpoints": []any{}}}
+		if listings > 1 {
+			// authorized while the stream was disconnected
+			tenants = append(tenants, map[string]any{"tenant_id": second, "endpoints": []any{}})
+		}
+		requests = append(requests, "tenants")
+		mu.Unlock()
+		body, err := json.Marshal(map[string]any{"tenants": tenants})
+		assert.NoError(t, err)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+	})
+	registry := agrirouter.NewTenantRegistry(api.client())
+
+	run := startReceiving(t, func(ctx context.Context, errorHandler func(err error)) error {
+		return registry.Run(ctx, errorHandler)
+	})
+
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		_, ok := registry.Tenant(second)
+		assert.True(c, ok)
+	}, 5*time.Second, 10*time.Millisecond)
+	_, ok := registry.Tenant(first)
+	assert.True(t, ok)
+	mu.Lock()
+	assert.Equal(t, []string{"events", "tenants", "events", "tenants"}, requests,
+		"tenants are listed after the stream is connected")
+	mu.Unlock()
+	assert.Empty(t, run.reported())
+}
+
+func TestTenantRegistry_ResolvesExternalIDs(t *testing.T) {
+	api := newFakeAPI(t)
+	tenantID, endpointID, anonymous := uuid.New(), uuid.New(), uuid.New()
+	serveTenants(t, api, map[uuid.UUID][]any{
+		tenantID: {tenantEndpoint(tenantID, endpointID, "field-1", true), tenantEndpoint(tenantID, anonymous, "", false)},
+	})
+	registry := agrirouter.NewTenantRegistry(api.client())
+	require.NoError(t, registry.Sync(context.Background()))
+
+	var resolver agrirouter.ExternalIDResolver = registry.ResolveExternalID
+	externalID, err := resolver(context.Background(), tenantID, endpointID)
+	require.NoError(t, err)
+	assert.Equal(t, "field-1", externalID)
+
+	_, err = resolver(context.Background(), tenantID, anonymous)
+	assert.Error(t, err)
+	_, err = resolver(context.Background(), uuid.New(), endpointID)
+	assert.ErrorIs(t, err, agrirouter.ErrTenantNotFound)
+
+	var changes int
+	registry.Subscribe(func(context.Context, *agrirouter.TenantChange) { changes++ })
+	require.NoError(t, registry.Sync(context.Background()))
+	assert.Zero(t, changes, "syncing an unchanged state notifies nothing")
+}
@@ -0,0 +1,160 @@
+package agrirouter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// tenantSnapshotVersion is the version of the snapshot format written by
+// [TenantRegistry.Snapshot].
+const tenantSnapshotVersion = 1
+
+var (
+	// ErrTenantSnapshotStoreFailed is returned by [FileTenantSnapshotStore]
+	// when accessing the file system fails.
+	ErrTenantSnapshotStoreFailed = errors.New("tenant snapshot store failed")
+
+	// ErrInvalidTenantSnapshot is returned when a snapshot cannot be parsed
+	// or was written in an unsupported version.
+	ErrInvalidTenantSnapshot = errors.New("invalid tenant snapshot")
+)
+
+// TenantSnapshot is the state of a [TenantRegistry] at a point in time, which
+// is persisted to find out what changed while the application was down, see
+// [TenantRegistry.Reconcile].
+type TenantSnapshot struct {
+	// Version is the version of the snapshot format.
+	Version int `json:"version"`
+	// TakenAt is the time the snapshot was taken.
+	TakenAt time.Time `json:"taken_at"`
+	// Tenants are the authorized tenants, ordered by ID.
+	Tenants []*RegisteredTenant `json:"tenants"`
+}
+
+// TenantSnapshotStore persists the latest [TenantSnapshot].
+//
+// Implementations must be safe for concurrent use. [FileTenantSnapshotStore]
+// is an included implementation.
+type TenantSnapshotStore interface {
+	// Load returns the latest saved snapshot, or nil if none was saved.
+	Load(ctx context.Context) (*TenantSnapshot, error)
+	// Save replaces the saved snapshot with snapshot.
+	Save(ctx context.Context, snapshot *TenantSnapshot) error
+}
+
+// Snapshot returns the current state of r.
+func (r *TenantRegistry) Snapshot() *TenantSnapshot {
+	return &TenantSnapshot{
+		Version: tenantSnapshotVersion,
+		TakenAt: time.Now(),
+		Tenants: r.Tenants(),
+	}
+}
+
+// Restore replaces the state of r with snapshot without notifying
+// subscribers.
+func (r *TenantRegistry) Restore(snapshot *TenantSnapshot) error {
+	if snapshot.Version != tenantSnapshotVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrInvalidTenantSnapshot, snapshot.Version)
+	}
+	tenants := make(map[uuid.UUID]*RegisteredTenant, len(snapshot.Tenants))
+	for _, tenant := range snapshot.Tenants {
+		tenants[tenant.ID] = tenant
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tenants = tenants
+	return nil
+}
+
+// Reconcile restores the state of r from the snapshot in store, if any, and
+// synchronizes it with [TenantRegistry.Sync]. Subscribers are notified of
+// everything that changed since the snapshot was saved, f.e tenants whose
+// authorization was revoked or endpoints that were deleted, as synthetic
+// changes. The new state is saved to store afterwards.
+//
+// Call Reconcile on start instead of [TenantRegistry.Sync], so that changes
+// missed while the application was down are handled like events, and use
+// [TenantRegistry.Persist] to keep the snapshot current.
+func (r *TenantRegistry) Reconcile(ctx context.Context, store TenantSnapshotStore) error {
+	snapshot, err := store.Load(ctx)
+	if err != nil {
+		return err
+	}
+	if snapshot != nil {
+		if err := r.Restore(snapshot); err != nil {
+			return err
+		}
+	}
+	if err := r.Sync(ctx); err != nil {
+		return err
+	}
+	return store.Save(ctx, r.Snapshot())
+}
+
+// Persist saves a snapshot of r to store after every change, until the
+// returned function is called. Errors of store are reported to errorHandler.
+func (r *TenantRegistry) Persist(store TenantSnapshotStore, errorHandler func(err error)) (stop func()) {
+	return r.Subscribe(func(ctx context.Context, _ *TenantChange) {
+		if err := store.Save(ctx, r.Snapshot()); err != nil {
+			errorHandler(err)
+		}
+	})
+}
+
+// FileTenantSnapshotStore is a [TenantSnapshotStore] keeping the snapshot in
+// a JSON file, which is replaced atomically when saving.
+type FileTenantSnapshotStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+var _ TenantSnapshotStore = (*FileTenantSnapshotStore)(nil)
+
+// NewFileTenantSnapshotStore creates a [FileTenantSnapshotStore] keeping the
+// snapshot in the file at path. The directory of path must exist.
+func NewFileTenantSnapshotStore(path string) *FileTenantSnapshotStore {
+	return &FileTenantSnapshotStore{path: path}
+}
+
+// Load implements [TenantSnapshotStore].
+func (s *FileTenantSnapshotStore) Load(_ context.Context) (*TenantSnapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrTenantSnapshotStoreFailed, err)
+	}
+	snapshot := &TenantSnapshot{}
+	if err := json.Unmarshal(data, snapshot); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidTenantSnapshot, err)
+	}
+	return snapshot, nil
+}
+
+// Save implements [TenantSnapshotStore].
+func (s *FileTenantSnapshotStore) Save(_ context.Context, snapshot *TenantSnapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := writeFileAtomically(s.path, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(snapshot)
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrTenantSnapshotStoreFailed, err)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package agrirouter_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DKE-Data/agrirouter-sdk-go"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTenantRegistry_ReconcilesWithSnapshot(t *testing.T) {
+	ctx := context.Background()
+	store := agrirouter.NewFileTenantSnapshotStore(filepath.Join(t.TempDir(), "tenants.json"))
+	kept, revoked, authorized := uuid.New(), uuid.New(), uuid.New()
+	unchanged, renamed, deleted := uuid.New(), uuid.New(), uuid.New()
+
+	before := newFakeAPI(t)
+	serveTenants(t, before, map[uuid.UUID][]any{
+		kept: {
+			tenantEndpoint(kept, unchanged, "unchanged", true),
+			tenantEndpoint(kept, renamed, "renamed", false),
+			tenantEndpoint(kept, deleted, "deleted", false),
+		},
+		revoked: {},
+	})
+	require.NoError(t, agrirouter.NewTenantRegistry(before.client()).Reconcile(ctx, store))
+
+	after := newFakeAPI(t)
+	renamedEndpoint := tenantEndpoint(kept, renamed, "renamed", false)
+	renamedEndpoint["name"] = "new name"
+	serveTenants(t, after, map[uuid.UUID][]any{
+		kept:       {tenantEndpoint(kept, unchanged, "unchanged", true), renamedEndpoint},
+		authorized: {},
+	})
+	registry := agrirouter.NewTenantRegistry(after.client())
+	var changes []*agrirouter.TenantChange
+	registry.Subscribe(func(_ context.Context, change *agrirouter.TenantChange) {
+		changes = append(changes, change)
+	})
+
+	require.NoError(t, registry.Reconcile(ctx, store))
+
+	kinds := map[uuid.UUID]agrirouter.TenantChangeKind{}
+	for _, change := range changes {
+		assert.True(t, change.Synthetic)
+		kinds[change.TenantID] = change.Kind
+	}
+	assert.Equal(t, map[uuid.UUID]agrirouter.TenantChangeKind{
+		kept:       agrirouter.TenantEndpointsChanged,
+		revoked:    agrirouter.TenantRemoved,
+		authorized: agrirouter.TenantAdded,
+	}, kinds)
+
+	snapshot, err := store.Load(ctx)
+	require.NoError(t, err)
+	var tenants []uuid.UUID
+	for _, tenant := range snapshot.Tenants {
+		tenants = append(tenants, tenant.ID)
+	}
+	assert.ElementsMatch(t, []uuid.UUID{kept, authorized}, tenants, "the reconciled state is saved")
+
+	restarted := agrirouter.NewTenantRegistry(after.client())
+	restarted.Subscribe(func(_ context.Context, change *agrirouter.TenantChange) {
+		t.Errorf("unexpected change %s of %s", change.Kind, change.TenantID)
+	})
+	require.NoError(t, restarted.Reconcile(ctx, store))
+}
+
+func TestTenantRegistry_PersistsChanges(t *testing.T) {
+	ctx := context.Background()
+	store := agrirouter.NewFileTenantSnapshotStore(filepath.Join(t.TempDir(), "tenants.json"))
+	api := newFakeAPI(t)
+	serveTenants(t, api, map[uuid.UUID][]any{})
+	registry := agrirouter.NewTenantRegistry(api.client())
+	require.NoError(t, registry.Reconcile(ctx, store))
+	stop := registry.Persist(store, func(err error) { assert.NoError(t, err) })
+	defer stop()
+
+	tenantID := uuid.New()
+	serveTenants(t, api, map[uuid.UUID][]any{tenantID: {}})
+	require.NoError(t, registry.Sync(ctx))
+
+	snapshot, err := store.Load(ctx)
+	require.NoError(t, err)
+	require.Len(t, snapshot.Tenants, 1)
+	assert.Equal(t, tenantID, snapshot.Tenants[0].ID)
+	assert.Equal(t, []string{agrirouter.ScopeEndpointsManage}, snapshot.Tenants[0].Scopes)
+}
+
+func TestFileTenantSnapshotStore_RejectsInvalidSnapshots(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "tenants.json")
+	store := agrirouter.NewFileTenantSnapshotStore(path)
+
+	snapshot, err := store.Load(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, snapshot, "no snapshot was saved yet")
+
+	require.NoError(t, os.WriteFile(path, []byte("{"), 0o600))
+	_, err = store.Load(ctx)
+	assert.ErrorIs(t, err, agrirouter.ErrInvalidTenantSnapshot)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"version": 2}`), 0o600))
+	err = agrirouter.NewTenantRegistry(newFakeAPI(t).client()).Reconcile(ctx, store)
+	assert.ErrorIs(t, err, agrirouter.ErrInvalidTenantSnapshot)
+}